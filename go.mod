@@ -5,9 +5,12 @@ go 1.20
 require (
 	github.com/ProtonMail/gopenpgp/v2 v2.8.0-alpha.1-proton
 	github.com/fatih/color v1.16.0
+	github.com/mitchellh/mapstructure v1.5.0
 	github.com/rodaine/table v1.2.0
 	github.com/schollz/progressbar/v3 v3.14.2
 	golang.org/x/crypto v0.17.0
+	golang.org/x/sync v0.6.0
+	golang.org/x/time v0.5.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
@@ -18,7 +21,6 @@ require (
 	github.com/mattn/go-colorable v0.1.13 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mitchellh/colorstring v0.0.0-20190213212951-d06e56a500db // indirect
-	github.com/mitchellh/mapstructure v1.5.0 // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
 	golang.org/x/sys v0.17.0 // indirect
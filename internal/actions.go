@@ -1,17 +1,22 @@
 package internal
 
 import (
-	"bufio"
-	"bytes"
-	"flag"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"github.com/fatih/color"
 	"github.com/kt-soft-dev/kt-cli/pkg"
-	"github.com/rodaine/table"
 	"golang.org/x/crypto/ssh/terminal"
 	"io"
+	"net/url"
 	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Actions represent the available CLI commands. Each action is a function that can be called from the CLI
@@ -19,208 +24,1719 @@ import (
 // The actions and parameters are defined in the flags.go file.
 // The actions are called from the main.go file and use global state without returning any values.
 
-// ActionPing checks if the API is alive and responds to requests
+// ActionPing checks if the API is alive and responds to requests.
+// In wait mode, it polls the API until it is alive or the timeout is elapsed
 func ActionPing() {
-	if pkg.CheckApiAlive() {
-		Print("API is alive")
-	} else {
-		PrintError("API is not alive")
+	if !*PingWait {
+		if err := pkg.CheckApiAlive(); err != nil {
+			PrintError("API is not alive: %v", err)
+		} else {
+			Print("API is alive")
+		}
+		return
+	}
+
+	deadline := time.Now().Add(*PingTimeout)
+	for attempt := 1; ; attempt++ {
+		err := pkg.CheckApiAlive()
+		if *Debug {
+			Print("Attempt %d: alive=%t, error: %v", attempt, err == nil, err)
+		}
+		if err == nil {
+			Print("API is alive")
+			return
+		}
+
+		if time.Now().Add(*PingInterval).After(deadline) {
+			PrintError("API is not alive after %s: %v", *PingTimeout, err)
+			return
+		}
+		time.Sleep(*PingInterval)
+	}
+}
+
+// HealthReport is the result of the health check shown to the user
+type HealthReport struct {
+	Alive      bool              `json:"alive"`
+	LatencyMs  int64             `json:"latency_ms"`
+	Status     string            `json:"status,omitempty"`
+	Components map[string]string `json:"components,omitempty"`
+}
+
+// ActionHealth prints the status of server components and the ping latency.
+// If the server doesn't provide the detailed health, only the ping result is shown
+func ActionHealth(config *Config) {
+	latency, pingErr := pkg.PingLatency()
+	alive := pingErr == nil
+	report := &HealthReport{Alive: alive, LatencyMs: latency.Milliseconds()}
+
+	health, err := pkg.GetHealth(config.Token)
+	if err == nil {
+		report.Status = health.Status
+		report.Components = health.Components
+	} else if !errors.Is(err, pkg.ErrMethodNotSupported) && alive {
+		PrintError("Failed to get server health: %v", err)
+	}
+
+	if !alive {
+		PrintError("API is not alive: %v", pingErr)
+	}
+
+	if IsJSONMode() {
+		PrintJSON(report)
+		return
+	}
+
+	tbl := NewTable("Component", "Status")
+	tbl.AddRow("api", fmt.Sprintf("alive=%t, latency %s", alive, latency.Round(time.Millisecond)))
+	if report.Status != "" {
+		tbl.AddRow("server", report.Status)
+	}
+
+	names := make([]string, 0, len(report.Components))
+	for name := range report.Components {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tbl.AddRow(name, report.Components[name])
 	}
+
+	tbl.Print()
 }
 
 func ActionDefault(config *Config) {
 	// Usually, in case of empty method and non-empty token,
 	// we should take this as a request to validate and store the token
-	if *Auth != "" {
+	if *Auth != "" && !*Anonymous {
 		_ = CheckTokenAndAssign(config.Token, config)
 		Print("Token is validated and saved")
 		// Config will be saved because of the deferring above (if no -no-save flag is set)
 		return
 	}
 
-	flag.PrintDefaults()
+	PrintUsage()
 }
 
 func ActionGetKeys(config *Config) {
 	_, disk, err := DiskIdOrDefault(config, *GetKeys)
 	if err != nil {
-		PrintError(err.Error())
+		PrintError("%v", err)
 		return
 	}
 
 	cryptoInfo := &pkg.CryptoInfo{
 		EncryptedCryptoKey: disk.CryptoKey,
 		PublicKey:          disk.PublicKey,
-		Password:           *Passwd,
+		Password:           Passwd.Default(),
+		DiskPasswords:      Passwd.DiskPasswords(),
+		Disk:               disk.ID,
 	}
 
 	if !cryptoInfo.IsCryptoReady() {
 		err = cryptoInfo.TryGetReady(config.Token, disk.ID)
 		if err != nil {
-			PrintError(err.Error())
+			PrintError("%v", err)
 			return
 		}
 	}
 
 	err = os.WriteFile(*GetKeysPublicName, []byte(cryptoInfo.PublicKey), 0755)
 	if err != nil {
-		PrintError(err.Error())
+		PrintError("%v", err)
 	}
 
 	err = os.WriteFile(*GetKeysPrivateName, []byte(cryptoInfo.RawCryptoKey), 0755)
 	if err != nil {
-		PrintError(err.Error())
+		PrintError("%v", err)
 	}
 
 	Print("Keys exported: %s, %s", *GetKeysPublicName, *GetKeysPrivateName)
 }
 
-// ActionDownload downloads a file by its ID and saves it to the specified path
-func ActionDownload(config *Config) {
-	savePath := strings.TrimSpace(*DownloadPath)
-	if savePath == "" {
-		PrintError("Save path is required")
+// ActionListDisks lists disks of the account. The default disk goes first
+func ActionListDisks(config *Config) {
+	disks, err := pkg.ListDisks(config.Token)
+	if err != nil {
+		PrintError("%v", err)
 		return
-	} else if savePath == "." {
-		Print("Save path is set to current directory. You can change it by -act.download.path flag")
 	}
 
-	// @todo streaming download for big files
-	var buffer bytes.Buffer
-	writer := bufio.NewWriter(&buffer)
-	name, _, err := pkg.DownloadFile(config.Token, *Download, NewDefaultCryptoInfo(), writer)
+	if IsJSONMode() {
+		if disks == nil {
+			disks = []*pkg.Disk{}
+		}
+		PrintJSON(disks)
+		return
+	}
+
+	if len(disks) == 0 {
+		Print("No disks")
+		return
+	}
+
+	tbl := NewTable("ID", "Title", "Encrypted", "Used", "Quota")
+	for _, disk := range disks {
+		quota := "-"
+		if disk.Quota > 0 {
+			quota = ByteCount(disk.Quota)
+		}
+		tbl.AddRow(disk.ID, disk.Title, disk.Encrypted(), ByteCount(disk.Used), quota)
+	}
+	tbl.Print()
+}
+
+// ActionCreateDisk creates a disk with the title and prints its ID. For an encrypted disk, the key pair is generated
+// and locked with the crypto password, which is taken from the password flags or asked twice.
+// The creation is confirmed when the user can answer
+func ActionCreateDisk(config *Config) {
+	if err := RequireMethod(config, "disks.create", "disk creation"); err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	title := strings.TrimSpace(*DisksCreate)
+	if title == "" {
+		PrintError("Disk title is required")
+		SetExitCode(ExitUsage)
+		return
+	}
+
+	kind := "unencrypted"
+	if *DisksCreateEncrypted {
+		kind = "encrypted"
+	}
+	if *DryRun {
+		Print("Dry run: %s disk %q would be created", kind, title)
+		return
+	}
+	if !*NotInteractive && stdinIsTerminal() && !ConfirmOrAbort(fmt.Sprintf("Create %s disk %q?", kind, title), "Disk creation") {
+		return
+	}
+
+	var publicKey, cryptoKey string
+	var err error
+	if *DisksCreateEncrypted {
+		password := Passwd.Default()
+		if password == "" {
+			password, err = askNewPassword("Crypto password of the disk: ")
+			if err != nil {
+				PrintError("%v, the disk is not created", err)
+				return
+			}
+		}
+
+		publicKey, cryptoKey, err = pkg.GenerateCryptoKeys(title, password)
+		if err != nil {
+			PrintError("Failed to generate the keys: %v", err)
+			return
+		}
+	}
+
+	disk, err := pkg.CreateDisk(config.Token, title, publicKey, cryptoKey)
 	if err != nil {
-		PrintError(err.Error())
+		PrintError("%v", err)
+		return
+	}
+
+	if IsJSONMode() {
+		PrintJSON(disk)
 		return
 	}
 
-	pathInfo, err := os.Stat(savePath)
-	if err == nil && pathInfo.IsDir() {
-		savePath = savePath + string(os.PathSeparator) + name
+	Print("Disk %q is created. Disk ID: %s", title, disk.ID)
+	if *DisksCreateEncrypted {
+		Print("Keep the crypto password safe, files of the disk can't be decrypted without it")
+	}
+}
+
+// askNewPassword asks the new crypto password twice with hidden prompts. An error is returned
+// if the password can't be asked in non-interactive mode or the passwords don't match
+func askNewPassword(prompt string) (string, error) {
+	password := pkg.ScanPassword(prompt)
+	if password == "" {
+		SetExitCode(ExitUsage)
+		return "", errors.New("password is required, it can't be asked in non-interactive mode")
+	}
+	if pkg.ScanPassword("Repeat the password: ") != password {
+		return "", errors.New("passwords don't match")
 	}
 
-	out, err := os.Create(savePath)
+	return password, nil
+}
+
+// ActionChangePassword changes the crypto password of the disk. The current password is taken from
+// the password flags or asked, the new one is always asked twice. Both prompts are hidden
+func ActionChangePassword(config *Config) {
+	_, disk, err := DiskIdOrDefault(config, *ChangePassword)
 	if err != nil {
-		PrintError("Failed to create file %s", savePath)
+		PrintError("%v", err)
+		return
+	}
+
+	oldPassword := Passwd.DiskPasswords()[disk.ID]
+	if oldPassword == "" {
+		oldPassword = Passwd.Default()
+	}
+	if oldPassword == "" {
+		oldPassword = pkg.ScanPassword("Current crypto password: ")
+	}
+	if oldPassword == "" {
+		PrintError("Current password is required, it can't be asked in non-interactive mode")
+		SetExitCode(ExitUsage)
 		return
 	}
-	defer out.Close()
 
-	_, err = io.Copy(out, &buffer)
+	newPassword, err := askNewPassword("New crypto password: ")
 	if err != nil {
-		PrintError("Failed to save file %s", savePath)
+		PrintError("%v, the password is not changed", err)
+		return
 	}
-}
 
-// ActionUpload uploads a file to the cloud. The file can be provided by path or by stdin.
-func ActionUpload(config *Config, isStdIn bool) {
-	*UploadDisk, _, _ = DiskIdOrDefault(config, *UploadDisk)
+	if err = pkg.ChangeCryptoPassword(config.Token, disk.ID, oldPassword, newPassword); err != nil {
+		PrintError("%v", err)
+		return
+	}
 
-	var reader io.Reader
-	var name string
+	Print("Crypto password of disk %s is changed", disk.ID)
+	if _, err = os.Stat(*PrivateKeyFile); err == nil {
+		PrintWarning("Exported key %s is still protected by the old password, export it again with -act.keys", *PrivateKeyFile)
+	}
+	Print("Don't forget to update KT_CLI_PASSWD, -passwd-file and -passwd-env sources with the new password")
+}
 
-	if isStdIn {
-		name = *UploadName
-		if name == "" {
-			PrintError("File name is required for stdin upload. Use -act.upload.name flag")
+// ActionDownload downloads a file by its ID and saves it to the specified path
+func ActionDownload(config *Config) {
+	savePath, err := ValidateSavePath(*DownloadPath)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+	mode, err := ParseFileMode(*DownloadMode)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+	if *DownloadMaxSize != "" {
+		if _, err = ParseByteSize(*DownloadMaxSize); err != nil {
+			PrintError("Invalid -act.download.max-size: %v", err)
+			SetExitCode(ExitUsage)
 			return
 		}
-		reader = os.Stdin
-	} else {
-		path := *Upload
-		if path == "" {
-			path = pkg.ScanOrDefault("Enter file path: ", "")
-			if path == "" {
-				PrintError("File path is required")
-				return
-			}
-		}
+	}
+	if *DownloadResume && (*DownloadTee || *DownloadRange != "") {
+		PrintError("-act.download.resume can't be used with -act.download.tee and -act.download.range")
+		SetExitCode(ExitUsage)
+		return
+	}
+	if *DownloadTee {
+		ReserveStdout()
+	}
+	if savePath == "." {
+		Print("Save path is set to current directory. You can change it by -act.download.path flag")
+	}
 
-		fileInfo, err := os.Stat(path)
-		if err != nil {
-			PrintError("Failed to access file")
+	*Download, err = ResolveFileID(config, *DownloadDisk, *Download)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+	if err = checkDownloadSize(config, *Download); err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	if *DownloadParallel {
+		if *DownloadTee || *DownloadRange != "" || *DownloadResume {
+			PrintWarning("-act.download.parallel is ignored with -act.download.tee, -act.download.range and -act.download.resume")
+		} else {
+			downloadParallel(config, savePath, mode)
 			return
 		}
-		if fileInfo.IsDir() {
-			// @todo directory uploading
-			PrintError("Directory uploading is not supported yet")
+	}
+
+	fileInfo, err := pkg.GetFile(config.Token, *Download)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	opts := &pkg.DownloadOptions{CryptoInfo: NewDefaultCryptoInfo()}
+	name := pkg.DownloadedName(fileInfo.Name)
+	if *DownloadRange != "" {
+		start, end, rangeErr := ParseByteRange(*DownloadRange)
+		if rangeErr != nil {
+			PrintError("%v", rangeErr)
 			return
 		}
+		opts.Range = &pkg.ByteRange{Start: start, End: end}
+		// Ranges are saved as they are stored, without decompression
+		name = fileInfo.Name
+	}
+	if strings.TrimSpace(name) == "" {
+		// Without a name, the file would be saved as the directory itself
+		name = DefaultFileName(fileInfo.ID, fileInfo.Mime)
+	}
 
-		file, err := os.Open(path)
-		if err != nil {
-			PrintError("Failed to open file")
-			return
+	// The extension is added after the download only if the content is needed to detect the type
+	addExt := false
+	if *DownloadAddExt && !HasKnownExtension(name) {
+		if pathInfo, statErr := os.Stat(savePath); statErr == nil && pathInfo.IsDir() {
+			if fileInfo.Mime != "" && !pkg.IsCompressedName(fileInfo.Name) {
+				name = AddExtensionByMime(name, fileInfo.Mime)
+			} else {
+				addExt = true
+			}
 		}
+	}
 
-		if *UploadName != "" {
-			name = *UploadName
-		} else {
-			name = file.Name()
+	savePath, err = ResolveSavePath(savePath, name)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	var out *os.File
+	if *DownloadResume {
+		out, opts.Resume, err = openResumedFile(savePath)
+		if err == nil && opts.Resume > 0 {
+			opts.Restart = func() error {
+				if _, err := out.Seek(0, io.SeekStart); err != nil {
+					return err
+				}
+				return out.Truncate(0)
+			}
 		}
+	}
+	if out == nil && err == nil {
+		out, err = CreateFileWithMode(savePath, mode)
+	}
+	if err != nil {
+		PrintError("Failed to create file %s", savePath)
+		return
+	}
+	defer out.Close()
 
-		reader = file
+	// The content is streamed to the file as it arrives, so big files don't have to fit in memory
+	var writer io.Writer = out
+	if *DownloadTee {
+		writer = io.MultiWriter(writer, os.Stdout)
 	}
 
-	_, err := pkg.UploadFile(config.Token, name, "", *UploadDisk, *UploadFolder, NewDefaultCryptoInfo(), reader)
+	ctx, stop := InterruptContext()
+	defer stop()
+
+	started := time.Now()
+	name, numBytes, err := pkg.DownloadFileWithOptions(ctx, config.Token, *Download, writer, opts)
+	stats := NewTransferStats("download", started, numBytes)
+	stats.FileID = *Download
+	stats.Name = name
 	if err != nil {
-		PrintError(err.Error())
+		PrintError("%v", err)
+		stats.Ok = false
+		stats.Error = err.Error()
+		EmitTransferStats(stats)
+		_ = out.Close()
+		// The interrupted download is kept only if it was asked to be resumable
+		interrupted := isInterrupted(ctx)
+		if opts.Range == nil && pkg.CanResume(fileInfo) && (!interrupted || *DownloadResume) {
+			Print("Incomplete file %s is kept, continue the download with -act.download.resume", savePath)
+		} else {
+			// The incomplete file is not left behind as if it were downloaded
+			_ = os.Remove(savePath)
+		}
 		return
 	}
+
+	if err = out.Close(); err != nil {
+		PrintError("Failed to save file %s", savePath)
+		stats.Ok = false
+		stats.Error = err.Error()
+	} else if addExt {
+		// The type is detected by the start of the saved file, which is the start of the content even if it is resumed
+		withExt := AddExtensionByMime(savePath, DetectFileMime(savePath))
+		if withExt != savePath {
+			if err = os.Rename(savePath, withExt); err != nil {
+				PrintWarning("Failed to add the extension to %s: %v", savePath, err)
+			}
+		}
+	}
+
+	EmitTransferStats(stats)
 }
 
-func ActionFilesList(config *Config) {
-	*FilesList, _, _ = DiskIdOrDefault(config, *FilesList)
+// openResumedFile opens the existing file to append the rest of the download. It returns nil file
+// if there is nothing to resume, so the file is created as usual
+func openResumedFile(path string) (*os.File, int64, error) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() == 0 {
+		return nil, 0, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return file, info.Size(), nil
+}
+
+// checkDownloadSize checks the size of the file by its metadata against -act.download.max-size before downloading.
+// Ranged downloads and -force skip the check. The size of encrypted files is the size of the stored ciphertext,
+// which is close to, but not exactly the size of the saved file
+func checkDownloadSize(config *Config, fileId string) error {
+	if *DownloadMaxSize == "" || *Force || *DownloadRange != "" {
+		return nil
+	}
+
+	limit, err := ParseByteSize(*DownloadMaxSize)
+	if err != nil {
+		return err
+	}
+
+	file, err := pkg.GetFile(config.Token, fileId)
+	if err != nil {
+		return err
+	}
+
+	if int64(file.Size) > limit {
+		note := ""
+		if file.Encrypted {
+			note = " (the size of the encrypted content)"
+		}
+		return fmt.Errorf("file %s is %s%s, which exceeds -act.download.max-size %s; use -force to download it anyway",
+			file.Name, ByteCount(int64(file.Size)), note, ByteCount(limit))
+	}
+
+	return nil
+}
+
+// ActionDownloadLatest downloads the most recently modified file of the folder whose name matches the pattern
+func ActionDownloadLatest(config *Config) {
+	pattern := *DownloadLatest
+	if pattern == "*" {
+		pattern = ""
+	}
 
-	// @todo offsets for big lists
-	filesList, err := pkg.ApiRequest(config.Token, "files.get", map[string]interface{}{"disk": *FilesList, "offset": 0})
+	file, err := FindLatestFile(config, *DownloadDisk, *DownloadLatestFolder, pattern)
 	if err != nil {
-		PrintError(err.Error())
+		PrintError("%v", err)
 		return
 	}
-	if filesList.Error.Code != 0 {
-		PrintError(filesList.Error.Message)
+
+	Print("Latest file is %s (%s), modified %s", file.Name, file.ID, time.Unix(int64(file.Date), 0).Format(time.DateTime))
+	*Download = file.ID
+	ActionDownload(config)
+}
+
+// defaultDownloadParts is the number of parts of -act.download.parallel when -concurrency is not limited
+const defaultDownloadParts = 4
+
+// downloadParallel downloads the file in parts of -concurrency directly into the file at savePath
+func downloadParallel(config *Config, savePath string, mode os.FileMode) {
+	fileInfo, err := pkg.GetFile(config.Token, *Download)
+	if err != nil {
+		PrintError("%v", err)
 		return
 	}
 
-	resp, err := pkg.MapToStruct[pkg.FilesGetResponse](filesList.Result)
+	name := pkg.DownloadedName(fileInfo.Name)
+	if strings.TrimSpace(name) == "" {
+		name = DefaultFileName(fileInfo.ID, fileInfo.Mime)
+	}
+	if *DownloadAddExt && !pkg.IsCompressedName(fileInfo.Name) {
+		name = AddExtensionByMime(name, fileInfo.Mime)
+	}
+
+	savePath, err = ResolveSavePath(savePath, name)
 	if err != nil {
-		PrintError(err.Error())
+		PrintError("%v", err)
 		return
 	}
-	if len(resp.List) == 0 {
-		PrintError("File list is empty")
+
+	out, err := CreateFileWithMode(savePath, mode)
+	if err != nil {
+		PrintError("Failed to create file %s", savePath)
 		return
 	}
+	defer out.Close()
+
+	started := time.Now()
+	opts := &pkg.DownloadOptions{CryptoInfo: NewDefaultCryptoInfo()}
+	parts := *Concurrency
+	if parts <= 0 {
+		// No concurrency limit, but the number of parts still has to be chosen
+		parts = defaultDownloadParts
+	}
+	ctx, stop := InterruptContext()
+	defer stop()
 
-	headerFmt := color.New(color.FgGreen, color.Underline).SprintfFunc()
-	columnFmt := color.New(color.FgYellow).SprintfFunc()
+	name, numBytes, err := pkg.DownloadFileParallel(ctx, config.Token, *Download, out, parts, opts)
+	stats := NewTransferStats("download", started, numBytes)
+	stats.FileID = *Download
+	stats.Name = name
+	if err != nil {
+		PrintError("%v", err)
+		stats.Ok = false
+		stats.Error = err.Error()
+		isInterrupted(ctx)
+		// Parts are written at their offsets, so the incomplete file has holes and can't be resumed
+		_ = out.Close()
+		_ = os.Remove(savePath)
+	}
 
-	tbl := table.New("ID", "Name", "Type", "Size")
-	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt)
+	EmitTransferStats(stats)
+}
 
-	for _, fileInfo := range resp.List {
-		tbl.AddRow(fileInfo.ID, fileInfo.Name, fileInfo.TypeDesc, ByteCount(int64(fileInfo.Size)))
+// ActionCheckCrypto checks that the file can be decrypted with the provided password and keys.
+// Only the keys are fetched, so a wrong password is found out without downloading the file
+func ActionCheckCrypto(config *Config) {
+	fileId, err := ResolveFileID(config, *FilesDisk, *FilesCheckCrypto)
+	if err != nil {
+		PrintError("%v", err)
+		return
 	}
 
-	tbl.Print()
+	file, err := pkg.CheckFileCrypto(config.Token, fileId, NewDefaultCryptoInfo())
+	switch {
+	case file == nil:
+		PrintError("%v", err)
+	case err != nil:
+		PrintError("File %s (%s) can't be decrypted: %v", file.Name, file.ID, err)
+	case !file.Encrypted:
+		Print("File %s (%s) is not encrypted, no keys are needed", file.Name, file.ID)
+	default:
+		Print("File %s (%s) can be decrypted", file.Name, file.ID)
+	}
 }
 
-func ActionApiCall(config *Config) {
-	paramsMap := ParseKeyValues(*Params)
-	resp, err := pkg.ApiRequest(config.Token, *Method, paramsMap)
-	err = GetActualError(resp, err)
+// DownloadURLInfo is the download link shown to the user
+type DownloadURLInfo struct {
+	URL       string `json:"url"`
+	Name      string `json:"name"`
+	Encrypted bool   `json:"encrypted"`
+}
+
+// ActionFileURL prints the download link of the file without downloading it
+func ActionFileURL(config *Config) {
+	fileId, err := ResolveFileID(config, *FilesDisk, *FileURL)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	fileUrl, fileInfo, err := pkg.GetDownloadURL(config.Token, fileId)
 	if err != nil {
-		PrintError(err.Error())
+		PrintError("%v", err)
 		return
 	}
 
-	Print(JsonToString(resp.Result, *Pretty))
+	PrintWarning("The link may be short-lived, use it soon")
+	if fileInfo.Encrypted {
+		PrintWarning("File %s is encrypted, the content downloaded by the link will be encrypted too", fileInfo.Name)
+	}
+	if pkg.IsCompressedName(fileInfo.Name) {
+		PrintWarning("File %s is compressed by the client, the content downloaded by the link is gzip", fileInfo.Name)
+	}
+
+	if IsJSONMode() {
+		PrintJSON(&DownloadURLInfo{URL: fileUrl, Name: fileInfo.Name, Encrypted: fileInfo.Encrypted})
+		return
+	}
+
+	PrintResult(fileUrl)
 }
 
-// ActionAskForToken asks the user to enter the access token. The token is not displayed on the screen.
-func ActionAskForToken(config *Config) {
-	if config.Token != "" && *NotInteractive {
+// ActionDownloadFolder downloads all files of the folder into a tar or zip archive.
+// The archive is written to the download path or to stdout if the path is "-"
+func ActionDownloadFolder(config *Config) {
+	diskId, _, err := DiskIdOrDefault(config, *DownloadDisk)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	mode, err := ParseFileMode(*DownloadMode)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	filter, err := NewFileFilter(*DownloadFolderType, *DownloadFolderSince, *DownloadFolderUntil)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	var writer io.Writer = os.Stdout
+	var archivePath string
+	if *DownloadPath != "-" {
+		savePath, err := ValidateSavePath(*DownloadPath)
+		if err != nil {
+			PrintError("%v", err)
+			return
+		}
+
+		savePath, err = ResolveSavePath(savePath, *DownloadFolder+"."+*DownloadFolderFormat)
+		if err != nil {
+			PrintError("%v", err)
+			return
+		}
+
+		out, err := CreateFileWithMode(savePath, mode)
+		if err != nil {
+			PrintError("Failed to create file %s", savePath)
+			return
+		}
+		defer out.Close()
+
+		writer = out
+		archivePath = savePath
+		Print("Saving archive to %s", savePath)
+	}
+
+	ctx, stop := InterruptContext()
+	defer stop()
+
+	count, err := DownloadFolderArchive(ctx, config.Token, diskId, *DownloadFolder, *DownloadFolderFormat, filter, NewDefaultCryptoInfo(), writer)
+	if err != nil {
+		PrintError("%v", err)
+		if isInterrupted(ctx) && archivePath != "" {
+			// The archive is cut in the middle, so it is not left behind as if it were complete
+			_ = os.Remove(archivePath)
+		}
+		return
+	}
+
+	if count == 0 && !filter.IsEmpty() {
+		PrintWarning("No files match the filters, the archive is empty")
+	}
+
+	// Nothing else must be printed to stdout when the archive is written there
+	if *DownloadPath != "-" {
+		Print("Archive is done: %d files", count)
+	}
+}
+
+// checkUploadCondition checks -act.upload.if-not-exists and -act.upload.if-changed conditions
+// against the file with the same name in the upload folder. Local file is nil for stdin uploads.
+// It returns whether the upload should be skipped and why
+func checkUploadCondition(config *Config, name string, localFile *os.File) (skip bool, reason string, err error) {
+	files, err := pkg.GetAllFolderFiles(config.Token, *UploadDisk, *UploadFolder)
+	if err != nil {
+		return false, "", err
+	}
+
+	var existing *pkg.File
+	for _, file := range files {
+		if file.Name == name {
+			existing = file
+			break
+		}
+	}
+
+	if existing == nil {
+		return false, "file doesn't exist yet", nil
+	}
+	if *UploadIfNotExists {
+		return true, fmt.Sprintf("file %s already exists (ID %s)", name, existing.ID), nil
+	}
+	if localFile == nil {
+		return false, "stdin can't be compared with the existing file", nil
+	}
+
+	// Server hash is the most reliable, size is compared only if the hash is unknown.
+	// Size of encrypted files differs from the local one, so they are always uploaded without a hash.
+	// Hash and size of compressed files are the ones of the gzip content, so the local file is compressed to compare
+	compressed := pkg.IsCompressedName(existing.Name)
+	if existing.Hash != "" {
+		var hash string
+		if compressed {
+			hash, _, err = CompressedSHA256(localFile)
+		} else {
+			hash, err = FileSHA256(localFile)
+		}
+		if err != nil {
+			return false, "", err
+		}
+		if strings.EqualFold(hash, existing.Hash) {
+			return true, fmt.Sprintf("file %s is not changed (ID %s)", name, existing.ID), nil
+		}
+		return false, "checksum differs", nil
+	}
+	if existing.Encrypted {
+		return false, "encrypted file can't be compared by size", nil
+	}
+
+	info, err := localFile.Stat()
+	if err != nil {
+		return false, "", err
+	}
+	size := info.Size()
+	if compressed {
+		if _, size, err = CompressedSHA256(localFile); err != nil {
+			return false, "", err
+		}
+	}
+	if size == int64(existing.Size) {
+		return true, fmt.Sprintf("file %s has the same size (ID %s)", name, existing.ID), nil
+	}
+
+	return false, "size differs", nil
+}
+
+// findUploadDuplicate looks for the file identical to the local one for -act.upload.dedup. The compressed upload
+// is also compared with files uploaded compressed before, which are stored with the hash of the gzip content
+func findUploadDuplicate(config *Config, localFile *os.File, contentHash string, compress bool) (*pkg.File, error) {
+	if contentHash == "" {
+		return nil, errors.New("the file is not hashed")
+	}
+
+	existing, err := FindDuplicate(config, *UploadDisk, *UploadFolder, contentHash)
+	if err != nil || existing != nil || !compress {
+		return existing, err
+	}
+
+	compressedHash, _, err := CompressedSHA256(localFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return FindDuplicate(config, *UploadDisk, *UploadFolder, compressedHash)
+}
+
+// shouldCompressUpload checks if the upload should be compressed according to -act.upload.compress.
+// In auto mode the reader is replaced with the one that keeps the bytes consumed by detection
+func shouldCompressUpload(name string, reader *io.Reader) (bool, error) {
+	switch *UploadCompress {
+	case "", "no":
+		return false, nil
+	case "yes":
+		return true, nil
+	case "auto":
+		compressed, newReader := pkg.IsAlreadyCompressed(name, *reader)
+		*reader = newReader
+		if compressed {
+			Print("File %s is already compressed, uploading as-is", name)
+		}
+		return !compressed, nil
+	default:
+		return false, fmt.Errorf("unknown compression mode %q (no, yes and auto are supported)", *UploadCompress)
+	}
+}
+
+// quotaExceededMessage describes the quota error with the current usage of the disk, if the server reports it
+func quotaExceededMessage(config *Config, diskId string) string {
+	disk, _, err := pkg.GetUserDisk(config.Token, diskId)
+	if err != nil || disk.Quota <= 0 {
+		return "disk quota exceeded"
+	}
+
+	return fmt.Sprintf("disk quota exceeded (used %s of %s)", ByteCount(disk.Used), ByteCount(disk.Quota))
+}
+
+// ActionUpload uploads a file to the cloud. The file can be provided by path or by stdin.
+func ActionUpload(config *Config, isStdIn bool) {
+	var err error
+	*UploadDisk, _, err = DiskIdOrDefault(config, *UploadDisk)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	*UploadFolder, err = ResolveFolder(config, *UploadDisk, *UploadFolder, *UploadMkdir)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	if *UploadFromURL != "" {
+		uploadFromURL(config)
+		return
+	}
+
+	var reader io.Reader
+	var localFile *os.File
+	var name string
+	var contentHash string
+
+	if *UploadStdinTar {
+		ctx, stop := InterruptContext()
+		defer stop()
+
+		batch := NewBatch()
+		batch.Journal("upload-tar", *UploadDisk, *UploadFolder)
+		err := UploadTar(ctx, config.Token, *UploadDisk, *UploadFolder, NewDefaultCryptoInfo(), os.Stdin, batch)
+		if err != nil {
+			batch.Interrupt()
+		}
+		batch.Report()
+		if err != nil {
+			PrintError("%v", err)
+			SetExitCode(ExitFailure)
+			isInterrupted(ctx)
+		}
+		return
+	}
+
+	if isStdIn {
+		name = *UploadName
+		if name == "" {
+			PrintError("File name is required for stdin upload. Use -act.upload.name flag")
+			return
+		}
+		reader = os.Stdin
+		if *UploadDedup {
+			Print("Deduplication is skipped for stdin, because it can't be hashed before the upload")
+		}
+	} else {
+		path := strings.TrimSpace(*Upload)
+		if path == "" {
+			path = pkg.ScanOrDefault("Enter file path: ", "")
+			if path == "" {
+				PrintError("File path is required")
+				return
+			}
+		}
+
+		path = filepath.Clean(path)
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			PrintError("Failed to access file")
+			return
+		}
+		if fileInfo.IsDir() {
+			// @todo directory uploading
+			PrintError("Directory uploading is not supported yet")
+			return
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			PrintError("Failed to open file")
+			return
+		}
+		defer file.Close()
+		localFile = file
+
+		if *UploadName != "" {
+			name = *UploadName
+		} else {
+			name = filepath.Base(path)
+		}
+
+		// The hash is used for the idempotency key and for deduplication
+		contentHash, err = FileSHA256(file)
+		if err != nil {
+			PrintWarning("Failed to hash the file, uploading without the idempotency key: %v", err)
+		}
+
+		reader = file
+	}
+
+	compress, err := shouldCompressUpload(name, &reader)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+	storedName := name
+	if compress {
+		storedName = pkg.CompressedName(name)
+	}
+
+	if *UploadDedup && localFile != nil {
+		existing, err := findUploadDuplicate(config, localFile, contentHash, compress)
+		if err != nil {
+			PrintWarning("Failed to check for duplicates, uploading anyway: %v", err)
+		} else if existing != nil {
+			Print("Identical file already exists, upload is skipped. File ID: %s", existing.ID)
+			return
+		}
+	}
+
+	if *UploadIfNotExists || *UploadIfChanged {
+		skip, reason, err := checkUploadCondition(config, storedName, localFile)
+		if err != nil {
+			PrintError("Failed to check existing files: %v", err)
+			SetExitCode(ExitFailure)
+			return
+		}
+		if skip {
+			Print("Upload is skipped: %s", reason)
+			return
+		}
+		Print("Uploading: %s", reason)
+	}
+
+	counter := &countingReader{reader: reader}
+	opts := &pkg.UploadOptions{
+		Disk:       *UploadDisk,
+		Folder:     *UploadFolder,
+		CryptoInfo: NewDefaultCryptoInfo(),
+		Compress:   compress,
+	}
+	if contentHash != "" {
+		opts.IdempotencyKey = pkg.IdempotencyKey(contentHash, storedName, *UploadDisk, *UploadFolder)
+	}
+
+	ctx, stop := InterruptContext()
+	defer stop()
+
+	started := time.Now()
+	fileId, err := pkg.UploadFileWithOptions(ctx, config.Token, name, counter, opts)
+	stats := NewTransferStats("upload", started, counter.count)
+	stats.FileID = fileId
+	stats.Name = storedName
+	if errors.Is(err, pkg.ErrQuotaExceeded) {
+		PrintError("Upload failed: %s", quotaExceededMessage(config, *UploadDisk))
+		SetExitCode(ExitQuotaExceeded)
+		stats.Ok = false
+		stats.Error = err.Error()
+	} else if err != nil {
+		PrintError("%v", err)
+		stats.Ok = false
+		stats.Error = err.Error()
+		isInterrupted(ctx)
+	}
+
+	EmitTransferStats(stats)
+}
+
+// uploadFromURL uploads the file from -act.upload.from-url into the resolved upload disk and folder.
+// The content is streamed from the URL, so nothing is stored locally
+func uploadFromURL(config *Config) {
+	sourceUrl, err := url.Parse(*UploadFromURL)
+	if err != nil {
+		PrintError("Invalid URL: %v", err)
+		return
+	}
+
+	name := *UploadName
+	if name == "" {
+		name = pkg.URLFileName(sourceUrl)
+	}
+
+	var compress bool
+	switch *UploadCompress {
+	case "", "no":
+	case "yes":
+		compress = true
+	case "auto":
+		// The content can't be peeked before the upload starts, so only the name is checked
+		compress = name == "" || !pkg.IsCompressedName(name)
+	default:
+		PrintError("unknown compression mode %q (no, yes and auto are supported)", *UploadCompress)
+		return
+	}
+
+	opts := &pkg.UploadOptions{
+		Disk:       *UploadDisk,
+		Folder:     *UploadFolder,
+		CryptoInfo: NewDefaultCryptoInfo(),
+		Compress:   compress,
+	}
+
+	ctx, stop := InterruptContext()
+	defer stop()
+
+	started := time.Now()
+	fileId, err := pkg.UploadFromURL(ctx, config.Token, *UploadName, *UploadFromURL, opts)
+	// The content may be fetched by the server, so the number of bytes is not known here
+	stats := NewTransferStats("upload", started, 0)
+	stats.FileID = fileId
+	stats.Name = name
+	if compress && name != "" {
+		stats.Name = pkg.CompressedName(name)
+	}
+	if errors.Is(err, pkg.ErrQuotaExceeded) {
+		PrintError("Upload failed: %s", quotaExceededMessage(config, *UploadDisk))
+		SetExitCode(ExitQuotaExceeded)
+		stats.Ok = false
+		stats.Error = err.Error()
+	} else if err != nil {
+		PrintError("%v", err)
+		stats.Ok = false
+		stats.Error = err.Error()
+		isInterrupted(ctx)
+	}
+
+	EmitTransferStats(stats)
+}
+
+// folderTypeName is the type of folder entries in files lists
+const folderTypeName = "folder"
+
+// folderAsFile converts the folder to the files list entry, so folders and files are shown in the same list
+func folderAsFile(folder *pkg.Folder) *pkg.File {
+	return &pkg.File{
+		ID:       folder.ID,
+		Name:     folder.Name,
+		Disk:     folder.Disk,
+		Folder:   folder.Parent,
+		Type:     folderTypeName,
+		TypeDesc: "Folder",
+	}
+}
+
+// ActionFilesList lists folders and files of the root folder of the provided disk.
+// Folders go first, -act.files.only limits the list to one kind of entries
+func ActionFilesList(config *Config) {
+	var err error
+	*FilesList, _, err = DiskIdOrDefault(config, *FilesList)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	if *FilesOnly != "" && *FilesOnly != "files" && *FilesOnly != "folders" {
+		PrintError("Unknown -act.files.only value %q (files or folders)", *FilesOnly)
+		SetExitCode(ExitUsage)
+		return
+	}
+
+	if *FilesOffset < 0 || *FilesLimit < 0 {
+		PrintError("-act.files.offset and -act.files.limit can't be negative")
+		SetExitCode(ExitUsage)
+		return
+	}
+	if *FilesAll && *FilesLimit > 0 {
+		PrintError("-act.files.all and -act.files.limit can't be used together")
+		SetExitCode(ExitUsage)
+		return
+	}
+
+	if *FilesIdsOnly {
+		// IDs are piped to other commands, which work with files, so folders are listed only if asked explicitly
+		if *FilesOnly == "" {
+			*FilesOnly = "files"
+		}
+		ReserveStdout()
+	}
+
+	// Listing of big disks takes many pages, so it can be stopped by Ctrl-C
+	ctx, stop := InterruptContext()
+	defer stop()
+
+	var files []*pkg.File
+	// All the folders are listed before the first page of files, the offset and the limit are applied to files
+	if *FilesOnly != "files" && *FilesOffset == 0 {
+		folders, err := pkg.GetAllSubfolders(ctx, config.Token, *FilesList, "")
+		if err != nil {
+			PrintError("%v", err)
+			isInterrupted(ctx)
+			return
+		}
+		for _, folder := range folders {
+			files = append(files, folderAsFile(folder))
+		}
+	}
+
+	more, next := 0, 0
+	if *FilesOnly != "folders" {
+		limit := *FilesLimit
+		if *FilesAll {
+			limit = -1
+		}
+		list, total, err := pkg.ListFilesContext(ctx, config.Token, *FilesList, *FilesOffset, limit)
+		if err != nil {
+			PrintError("%v", err)
+			isInterrupted(ctx)
+			return
+		}
+		files = append(files, list...)
+		next = *FilesOffset + len(list)
+		if total > next {
+			more = total - next
+		}
+	}
+
+	// The same list is saved to the file and printed, so the files are fetched only once
+	if *FilesOut != "" {
+		if err := SaveFilesList(*FilesOut, *FilesOutFormat, files); err != nil {
+			PrintError("%v", err)
+		} else {
+			Print("Files list is saved to %s", *FilesOut)
+		}
+	}
+
+	if *FilesIdsOnly {
+		PrintFileIDs(files)
+		return
+	}
+
+	PrintFilesListing(files)
+	if more > 0 {
+		Print("%d more files, list them with -act.files.offset=%d or -act.files.all", more, next)
+	}
+}
+
+// ActionDeleteFile deletes a file by its ID. The file goes to the trash unless the permanent flag is set
+func ActionDeleteFile(config *Config) {
+	fileId, err := ResolveFileID(config, *FilesDisk, *DeleteFile)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	file, err := pkg.GetFile(config.Token, fileId)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	// Files in the trash can be restored, so only the permanent deletion is confirmed
+	if *DeletePermanent {
+		if *DryRun {
+			Print("Dry run: file %s (%s) would be deleted permanently", file.Name, file.ID)
+			return
+		}
+		if !ConfirmOrAbort(fmt.Sprintf("Delete file %s (%s) permanently?", file.Name, file.ID), "Deletion") {
+			return
+		}
+	}
+
+	err = pkg.DeleteFile(config.Token, file.ID, *DeletePermanent)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	if *DeletePermanent {
+		Print("File %s (%s) is deleted permanently", file.Name, file.ID)
+	} else {
+		Print("File %s (%s) is moved to the trash", file.Name, file.ID)
+	}
+}
+
+// ActionDeleteByPattern deletes all files of the folder whose names match the prefix or glob.
+// Matches are shown and confirmed before deleting, unless -yes flag is set
+func ActionDeleteByPattern(config *Config) {
+	diskId, _, err := DiskIdOrDefault(config, *FilesDisk)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	files, err := pkg.GetAllFolderFiles(config.Token, diskId, *FilesFolder)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	var matches []*pkg.File
+	for _, file := range files {
+		matched, err := MatchName(*DeletePattern, file.Name)
+		if err != nil {
+			PrintError("Invalid pattern %q: %v", *DeletePattern, err)
+			return
+		}
+		if matched {
+			matches = append(matches, file)
+		}
+	}
+
+	if len(matches) == 0 {
+		Print("No files match %q", *DeletePattern)
+		return
+	}
+
+	PrintFilesTable(matches)
+	if *DryRun {
+		Print("Dry run: %d files would be deleted", len(matches))
+		return
+	}
+
+	if !ConfirmOrAbort(fmt.Sprintf("Delete %d files?", len(matches)), "Deletion") {
+		return
+	}
+
+	batch := NewBatch()
+	batch.Journal("delete-prefix", diskId, *FilesFolder, *DeletePattern)
+	for _, file := range matches {
+		item := fmt.Sprintf("%s (%s)", file.Name, file.ID)
+		if batch.Completed(item) {
+			continue
+		}
+		err := pkg.DeleteFile(config.Token, file.ID, *DeletePermanent)
+		if err != nil {
+			PrintWarning("Failed to delete %s (%s): %v", file.Name, file.ID, err)
+		}
+		if !batch.Add(item, err) {
+			break
+		}
+	}
+
+	batch.Report()
+}
+
+// ActionMoveMany moves the files listed by IDs or paths (comma-separated or read from stdin) to the destination
+// disk and folder. Files are shown and confirmed before moving, unless -yes flag is set. The list read from stdin
+// takes the whole stdin, so the answer can't be read from it and -yes flag is required then
+func ActionMoveMany(config *Config) {
+	if *MoveMany == "-" && !*Yes && !*DryRun {
+		PrintError("Files read from stdin can't be confirmed interactively, use -yes flag to move them")
+		SetExitCode(ExitUsage)
+		return
+	}
+
+	refs, err := ReadFileRefs(*MoveMany, os.Stdin)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+	if len(refs) == 0 {
+		PrintError("No files to move")
+		SetExitCode(ExitUsage)
+		return
+	}
+
+	diskId, disk, err := DiskIdOrDefault(config, *MoveDisk)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+	folder, err := ResolveFolder(config, diskId, *MoveFolder, false)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	destination := folder
+	if destination == "" {
+		destination = "the disk root"
+	}
+	Print("%d files will be moved to %s of disk %s", len(refs), destination, diskId)
+	if *DryRun {
+		for _, ref := range refs {
+			Print("Dry run: %s would be moved", ref)
+		}
+		return
+	}
+
+	if !ConfirmOrAbort(fmt.Sprintf("Move %d files?", len(refs)), "Moving") {
+		return
+	}
+
+	source, target := NewDefaultCryptoInfo(), NewDiskCryptoInfo(disk)
+	batch := NewBatch()
+	batch.Journal("move-many", diskId, folder, strings.Join(refs, "\n"))
+	for _, ref := range refs {
+		if batch.Completed(ref) {
+			continue
+		}
+		fileId, err := ResolveFileID(config, *FilesDisk, ref)
+		if err == nil {
+			fileId, err = pkg.MoveFile(config.Token, fileId, diskId, folder, source, target)
+		}
+		if err != nil {
+			PrintWarning("Failed to move %s: %v", ref, err)
+		} else {
+			Print("Moved %s: %s", ref, fileId)
+		}
+		if !batch.Add(ref, err) {
+			break
+		}
+	}
+
+	batch.Report()
+}
+
+// ActionCreateFolder creates the folder by its path from the disk root, including all missing parent folders
+func ActionCreateFolder(config *Config) {
+	diskId, _, err := DiskIdOrDefault(config, *FilesDisk)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	folderPath := "/" + strings.Trim(*CreateFolder, "/")
+	folderId, err := ResolveFolder(config, diskId, folderPath, true)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	Print("Folder %s is ready. Folder ID: %s", folderPath, folderId)
+}
+
+// ActionTrashList lists files in the trash of the provided disk
+func ActionTrashList(config *Config) {
+	if err := RequireMethod(config, "trash.get", "trash"); err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	diskId, _, err := DiskIdOrDefault(config, *TrashList)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	list, err := pkg.ListTrash(config.Token, diskId)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+	PrintFiles(list)
+}
+
+// ActionRestore restores a file from the trash by its ID
+func ActionRestore(config *Config) {
+	if err := RequireMethod(config, "trash.restore", "trash"); err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	err := pkg.RestoreFile(config.Token, *TrashRestore)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	Print("File %s is restored", *TrashRestore)
+}
+
+// ActionEmptyTrash permanently deletes all the files in the trash of the provided disk
+func ActionEmptyTrash(config *Config) {
+	if err := RequireMethod(config, "trash.empty", "trash"); err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	diskId, _, err := DiskIdOrDefault(config, *TrashEmpty)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	if *DryRun {
+		Print("Dry run: trash of disk %s would be emptied", diskId)
+		return
+	}
+	if !ConfirmOrAbort(fmt.Sprintf("Permanently delete all files in the trash of disk %s?", diskId), "Emptying the trash") {
+		return
+	}
+
+	err = pkg.EmptyTrash(config.Token, diskId)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	Print("Trash is emptied")
+}
+
+// ActionListShares lists public links to files of the disk, so they can be audited and revoked
+func ActionListShares(config *Config) {
+	if err := RequireMethod(config, "shares.get", "listing shared links"); err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	diskId, _, err := DiskIdOrDefault(config, *SharesList)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	shares, err := pkg.ListShares(config.Token, diskId)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	if IsJSONMode() {
+		if shares == nil {
+			shares = []*pkg.Share{}
+		}
+		PrintJSON(shares)
+		return
+	}
+
+	if len(shares) == 0 {
+		Print("No shared links")
+		return
+	}
+
+	tbl := NewTable("ID", "File", "URL", "Expires", "Accesses")
+	for _, share := range shares {
+		expires, accesses := share.Expires, "-"
+		if expires == "" {
+			expires = "never"
+		}
+		if share.Accesses != nil {
+			accesses = strconv.Itoa(*share.Accesses)
+		}
+		tbl.AddRow(share.ID, fmt.Sprintf("%s (%s)", share.Name, share.File), share.URL, expires, accesses)
+	}
+	tbl.Print()
+}
+
+// ActionRevokeShare revokes the public link by its ID after the confirmation
+func ActionRevokeShare(config *Config) {
+	if err := RequireMethod(config, "shares.revoke", "revoking shared links"); err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	if !ConfirmOrAbort(fmt.Sprintf("Revoke link %s?", *SharesRevoke), "Revoking") {
+		return
+	}
+
+	if err := pkg.RevokeShare(config.Token, *SharesRevoke); err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	Print("Link %s is revoked", *SharesRevoke)
+}
+
+// ActionCopy copies a file to another disk and/or folder.
+// The server copies the file by itself when it can, otherwise the file is transferred through the client
+// and re-encrypted with the destination disk's key
+func ActionCopy(config *Config) {
+	diskId, disk, err := DiskIdOrDefault(config, *CopyDisk)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	fileId, err := pkg.CopyFile(config.Token, *Copy, diskId, *CopyFolder, NewDefaultCryptoInfo(), NewDiskCryptoInfo(disk))
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	Print("File copied. File ID: %s", fileId)
+}
+
+// VerifyReport is the result of comparing the local file with the file on the server
+type VerifyReport struct {
+	FileID     string `json:"file_id"`
+	Path       string `json:"path"`
+	Match      bool   `json:"match"`
+	LocalSize  int64  `json:"local_size"`
+	RemoteSize int64  `json:"remote_size"`
+	LocalHash  string `json:"local_hash"`
+	RemoteHash string `json:"remote_hash"`
+	// Method is "server-hash" if the server hash is compared, or "download" if the content is downloaded and hashed
+	Method string `json:"method"`
+}
+
+// ActionVerify compares the local file with the file on the server by SHA-256 hashes and sizes.
+// Plaintext is always compared: the server hash is used for files stored as-is, while encrypted and compressed
+// files are downloaded, decrypted and decompressed to hash their original content, because the server hashes ciphertext
+func ActionVerify(config *Config) {
+	if *VerifyPath == "" {
+		PrintError("Local file path is required. Use -act.verify.path flag")
+		SetExitCode(ExitUsage)
+		return
+	}
+
+	local, err := os.Open(filepath.Clean(*VerifyPath))
+	if err != nil {
+		PrintError("Failed to open local file: %v", err)
+		return
+	}
+	defer local.Close()
+
+	localInfo, err := local.Stat()
+	if err != nil {
+		PrintError("Failed to access local file: %v", err)
+		return
+	}
+
+	localHash, err := FileSHA256(local)
+	if err != nil {
+		PrintError("Failed to hash local file: %v", err)
+		return
+	}
+
+	fileId, err := ResolveFileID(config, *FilesDisk, *Verify)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	remote, err := pkg.GetFile(config.Token, fileId)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	report := &VerifyReport{
+		FileID:     remote.ID,
+		Path:       *VerifyPath,
+		LocalSize:  localInfo.Size(),
+		RemoteSize: int64(remote.Size),
+		LocalHash:  localHash,
+		RemoteHash: strings.ToLower(remote.Hash),
+		Method:     "server-hash",
+	}
+
+	if remote.Encrypted || pkg.IsCompressedName(remote.Name) || remote.Hash == "" {
+		Print("Downloading %s to hash its original content", remote.Name)
+		hash := sha256.New()
+		_, numBytes, err := pkg.DownloadFileWithOptions(context.Background(), config.Token, remote.ID, hash, &pkg.DownloadOptions{CryptoInfo: NewDefaultCryptoInfo()})
+		if err != nil {
+			PrintError("Failed to download file: %v", err)
+			return
+		}
+
+		report.Method = "download"
+		report.RemoteSize = numBytes
+		report.RemoteHash = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	report.Match = report.LocalSize == report.RemoteSize && report.LocalHash == report.RemoteHash
+	if !report.Match {
+		SetExitCode(ExitFailure)
+	}
+
+	if IsJSONMode() {
+		PrintJSON(report)
+		return
+	}
+
+	tbl := NewTable("", "Local", "Remote")
+	tbl.AddRow("Size", ByteCount(report.LocalSize), ByteCount(report.RemoteSize))
+	tbl.AddRow("SHA-256", report.LocalHash, report.RemoteHash)
+	tbl.Print()
+
+	if report.Match {
+		Print("Files match (compared by %s)", report.Method)
+	} else {
+		PrintError("Files don't match (compared by %s)", report.Method)
+	}
+}
+
+// ActionServerInfo prints the server version and the list of supported methods
+func ActionServerInfo(config *Config) {
+	info, err := GetServerInfo(config, true)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	if IsJSONMode() {
+		PrintJSON(info)
+		return
+	}
+
+	if info.Version == "" && len(info.Methods) == 0 {
+		Print("Server doesn't report its version and capabilities")
+		return
+	}
+
+	Print("Server version: %s", info.Version)
+	tbl := NewTable("Method")
+	for _, method := range info.Methods {
+		tbl.AddRow(method)
+	}
+	tbl.Print()
+}
+
+// SelfUpdateReport is the result of the self-update shown to the user
+type SelfUpdateReport struct {
+	Current string `json:"current"`
+	Latest  string `json:"latest"`
+	Asset   string `json:"asset,omitempty"`
+	Updated bool   `json:"updated"`
+}
+
+// ActionSelfUpdate replaces the running binary with the latest release for the OS and architecture.
+// The download is checked against the checksums of the release. In dry run, only the available version is reported
+func ActionSelfUpdate() {
+	release, err := GetLatestRelease(*SelfUpdateURL)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	report := &SelfUpdateReport{Current: Version, Latest: release.Version}
+	defer func() {
+		if IsJSONMode() {
+			PrintJSON(report)
+		}
+	}()
+
+	if !IsNewerVersion(release.Version, Version) {
+		Print("Current version %s is up to date", Version)
+		return
+	}
+
+	report.Asset = BinaryAssetName(runtime.GOOS, runtime.GOARCH)
+	asset := release.Asset(report.Asset)
+	if asset == nil {
+		PrintError("Release %s has no binary for %s/%s", release.Version, runtime.GOOS, runtime.GOARCH)
+		return
+	}
+
+	if *DryRun {
+		Print("Version %s is available (current is %s), would download %s", release.Version, Version, asset.Name)
+		return
+	}
+
+	executable, err := currentExecutable()
+	if err != nil {
+		PrintError("Failed to find the executable: %v", err)
+		return
+	}
+
+	checksum, err := releaseChecksum(release, asset.Name)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	newBinary, err := downloadRelease(asset, checksum, executable)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	if err = replaceExecutable(newBinary, executable); err != nil {
+		_ = os.Remove(newBinary)
+		PrintError("Failed to replace %s: %v", executable, err)
+		return
+	}
+
+	report.Updated = true
+	Print("Updated %s from %s to %s", executable, Version, release.Version)
+}
+
+func ActionApiCall(config *Config) {
+	paramsMap := ParamList.Merge(ParseKeyValuesSep(*Params, *ParamsSep))
+	resp, err := pkg.ApiRequest(config.Token, ResolveMethodAlias(*Method), paramsMap)
+	err = GetActualError(resp, err)
+	if err != nil {
+		PrintError("%v", err)
+		return
+	}
+
+	result := resp.Result
+	if *Fields != "" {
+		result = ProjectFields(result, strings.Split(*Fields, ","), *OmitMissing)
+	}
+
+	if IsJSONMode() {
+		PrintJSON(result)
+		return
+	}
+
+	PrintResult(JsonToString(result, *Pretty))
+}
+
+// ActionAskForToken asks the user to enter the access token. The token is not displayed on the screen.
+func ActionAskForToken(config *Config) {
+	if config.Token != "" && *NotInteractive {
+		return
+	}
+
+	// Piped stdin can't hide the input, and it may carry the uploaded content, so it is never read here
+	if !terminal.IsTerminal(int(os.Stdin.Fd())) {
+		PrintWarning("Can't ask for the access token: stdin is not a terminal. Continuing without a token; " +
+			"use -token -, -token-file, KT_TOKEN_FILE or KT_CLI_TOKEN environment variable to provide it")
 		return
 	}
 
@@ -229,12 +1745,12 @@ func ActionAskForToken(config *Config) {
 		"\n When you enter your password, the characters will not be displayed." +
 		"\n This is a security measure to prevent it from being stored in SSH logs.\n")
 	fmt.Print("Access token: ")
-	password, err := terminal.ReadPassword(0)
+	password, err := terminal.ReadPassword(int(os.Stdin.Fd()))
 	if err == nil && len(password) > 0 {
 		if CheckTokenAndAssign(string(password), config) != nil {
 			config.Token = string(password)
 		}
 	} else {
-		PrintError(err.Error())
+		PrintError("%v", err)
 	}
 }
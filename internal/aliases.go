@@ -0,0 +1,60 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+)
+
+// MethodAlias is a friendly name of a commonly used API method, so it can be called without knowing the method name
+type MethodAlias struct {
+	// Name is the alias accepted instead of the method name
+	Name string
+	// Method is the API method called by the alias
+	Method string
+	// Params describes the parameters of the method
+	Params string
+	// Description is a one-line description of what the method does
+	Description string
+}
+
+// methodAliases is the registry of aliases in the order they are shown in the help
+var methodAliases = []*MethodAlias{
+	{Name: "me", Method: "auth.getMe", Description: "Show the current user"},
+	{Name: "disks", Method: "disks.get", Description: "List disks with their keys and quotas"},
+	{Name: "files", Method: "files.get", Params: "disk, folder, offset, limit", Description: "List files and folders of a folder"},
+	{Name: "file", Method: "files.getById", Params: "file", Description: "Show a file"},
+	{Name: "find-hash", Method: "files.findByHash", Params: "disk, hash", Description: "Find files by SHA-256 hash of the content"},
+	{Name: "link", Method: "files.download", Params: "file", Description: "Get a download link of a file"},
+	{Name: "copy", Method: "files.copy", Params: "file, disk, folder", Description: "Copy a file on the server"},
+	{Name: "move", Method: "files.move", Params: "file, disk, folder", Description: "Move a file on the server"},
+	{Name: "delete", Method: "files.delete", Params: "file, permanent", Description: "Delete a file"},
+	{Name: "mkdir", Method: "folders.create", Params: "disk, parent, name", Description: "Create a folder"},
+	{Name: "trash", Method: "trash.get", Params: "disk, offset", Description: "List files in the trash"},
+	{Name: "restore", Method: "trash.restore", Params: "file", Description: "Restore a file from the trash"},
+	{Name: "job", Method: "jobs.get", Params: "job", Description: "Show the status of a background job"},
+	{Name: "health", Method: "system.health", Description: "Show server health"},
+	{Name: "info", Method: "system.info", Description: "Show server version and supported methods"},
+}
+
+// ResolveMethodAlias returns the API method of the alias. Other names are returned as-is,
+// so raw method names always work
+func ResolveMethodAlias(name string) string {
+	for _, alias := range methodAliases {
+		if alias.Name == name {
+			return alias.Method
+		}
+	}
+
+	return name
+}
+
+// printMethodAliases prints the aliases with their methods and parameters
+func printMethodAliases(out io.Writer) {
+	for _, alias := range methodAliases {
+		method := alias.Method
+		if alias.Params != "" {
+			method += " (" + alias.Params + ")"
+		}
+		_, _ = fmt.Fprintf(out, "  %-10s %-40s %s\n", alias.Name, method, alias.Description)
+	}
+}
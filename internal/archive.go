@@ -0,0 +1,256 @@
+package internal
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// sanitizeArchivePath cleans the archive entry path and makes sure it stays inside the archive root
+func sanitizeArchivePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	if strings.HasPrefix(name, "/") || hasDriveLetter(name) {
+		return "", fmt.Errorf("entry %q has an absolute path", name)
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", fmt.Errorf("entry %q points outside of the archive", name)
+	}
+
+	return cleaned, nil
+}
+
+// UploadTar uploads every regular file of the tar stream as a separate file, recreating folders of the archive
+// inside the root folder. Directories are created on demand, symlinks and other special entries are skipped.
+// Results of entries are added to the batch, the error is returned only if the archive can't be read
+// or the context is done
+func UploadTar(ctx context.Context, token string, disk string, root string, cryptoInfo *pkg.CryptoInfo, reader io.Reader, batch *Batch) error {
+	archive := tar.NewReader(reader)
+	folders := NewFolderResolver(token, disk, root, true)
+
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %w", err)
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			if header.Typeflag != tar.TypeDir {
+				Print("Skipped %s: not a regular file", header.Name)
+			}
+			continue
+		}
+
+		if batch.Completed(header.Name) {
+			Print("Skipped %s: uploaded before", header.Name)
+			continue
+		}
+
+		fileId, err := uploadTarEntry(ctx, token, disk, folders, cryptoInfo, header.Name, archive)
+		if err != nil {
+			PrintWarning("Failed %s: %v", header.Name, err)
+		} else {
+			Print("Uploaded %s: %s", header.Name, fileId)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !batch.Add(header.Name, err) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// uploadTarEntry uploads the content of the archive entry into its folder and returns the id of the new file
+func uploadTarEntry(ctx context.Context, token string, disk string, folders *FolderResolver, cryptoInfo *pkg.CryptoInfo, name string, content io.Reader) (string, error) {
+	entryPath, err := sanitizeArchivePath(name)
+	if err != nil {
+		return "", err
+	}
+
+	folder, err := folders.Resolve(path.Dir(entryPath))
+	if err != nil {
+		return "", err
+	}
+
+	return pkg.UploadFileWithOptions(ctx, token, path.Base(entryPath), content, &pkg.UploadOptions{Disk: disk, Folder: folder, CryptoInfo: cryptoInfo})
+}
+
+// archiveWriter is a common interface for tar and zip archives
+type archiveWriter interface {
+	// WriteFile adds the file to the archive, the content is read by the callback.
+	// The size is the length of the content, or -1 if it is not known in advance
+	WriteFile(name string, modified time.Time, size int64, write func(io.Writer) error) error
+	Close() error
+}
+
+// tarArchive writes tar archives. Tar needs the size of each entry before its content, so the content of known size
+// is streamed right after the header. Otherwise (decrypted size is not known in advance) it is spooled
+// into a temporary file first, so big files are not kept in memory
+type tarArchive struct {
+	writer *tar.Writer
+}
+
+func (a *tarArchive) WriteFile(name string, modified time.Time, size int64, write func(io.Writer) error) error {
+	if size < 0 {
+		return a.writeSpooled(name, modified, write)
+	}
+
+	if err := a.writeHeader(name, modified, size); err != nil {
+		return err
+	}
+
+	// The tar writer fails if the content is longer than the header says, and the next header fails if it is shorter
+	return write(a.writer)
+}
+
+// writeSpooled writes the content of unknown size into a temporary file, then adds it to the archive
+func (a *tarArchive) writeSpooled(name string, modified time.Time, write func(io.Writer) error) error {
+	spool, err := os.CreateTemp("", "kt-cli-archive-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = spool.Close()
+		_ = os.Remove(spool.Name())
+	}()
+
+	if err = write(spool); err != nil {
+		return err
+	}
+
+	size, err := spool.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if err = a.writeHeader(name, modified, size); err != nil {
+		return err
+	}
+
+	_, err = pkg.CopyBuffered(a.writer, spool)
+	return err
+}
+
+func (a *tarArchive) writeHeader(name string, modified time.Time, size int64) error {
+	return a.writer.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  modified,
+		Typeflag: tar.TypeReg,
+	})
+}
+
+func (a *tarArchive) Close() error {
+	return a.writer.Close()
+}
+
+// zipArchive writes zip archives, files are streamed into it without buffering
+type zipArchive struct {
+	writer *zip.Writer
+}
+
+func (a *zipArchive) WriteFile(name string, modified time.Time, _ int64, write func(io.Writer) error) error {
+	entry, err := a.writer.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+
+	return write(entry)
+}
+
+func (a *zipArchive) Close() error {
+	return a.writer.Close()
+}
+
+// newArchiveWriter creates the archive writer of the format ("tar" or "zip")
+func newArchiveWriter(format string, writer io.Writer) (archiveWriter, error) {
+	switch format {
+	case "tar":
+		return &tarArchive{writer: tar.NewWriter(writer)}, nil
+	case "zip":
+		return &zipArchive{writer: zip.NewWriter(writer)}, nil
+	default:
+		return nil, fmt.Errorf("unknown archive format %q (tar and zip are supported)", format)
+	}
+}
+
+// archiveFolder adds all the files of the folder and its subfolders passing the filter to the archive, keeping relative paths.
+// Folders are listed page by page to the end
+func archiveFolder(ctx context.Context, token string, disk string, folder string, prefix string, filter *FileFilter, cryptoInfo *pkg.CryptoInfo, archive archiveWriter) (int, error) {
+	files, folders, err := pkg.GetAllFolderContents(ctx, token, disk, folder)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, file := range filter.Filter(files) {
+		safeName, err := SanitizeFileName(pkg.DownloadedName(file.Name))
+		if err != nil {
+			PrintError("Skipped %s: %v", file.ID, err)
+			continue
+		}
+
+		entryName := path.Join(prefix, safeName)
+		err = archive.WriteFile(entryName, time.Unix(int64(file.Date), 0), pkg.DownloadedSize(file), func(writer io.Writer) error {
+			_, _, err := pkg.DownloadFileWithOptions(ctx, token, file.ID, writer, &pkg.DownloadOptions{CryptoInfo: cryptoInfo})
+			return err
+		})
+		if err != nil {
+			return count, fmt.Errorf("failed to archive %s: %w", entryName, err)
+		}
+		count++
+	}
+
+	for _, subfolder := range folders {
+		safeName, err := SanitizeFileName(subfolder.Name)
+		if err != nil {
+			PrintError("Skipped folder %s: %v", subfolder.ID, err)
+			continue
+		}
+
+		added, err := archiveFolder(ctx, token, disk, subfolder.ID, path.Join(prefix, safeName), filter, cryptoInfo, archive)
+		count += added
+		if err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// DownloadFolderArchive downloads all the files of the folder and its subfolders passing the filter (nil for all files)
+// into a tar or zip archive. Encrypted files are decrypted before archiving. It returns the number of archived files.
+// The context stops the download, the archive is incomplete then
+func DownloadFolderArchive(ctx context.Context, token string, disk string, folder string, format string, filter *FileFilter, cryptoInfo *pkg.CryptoInfo, writer io.Writer) (int, error) {
+	archive, err := newArchiveWriter(format, writer)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := archiveFolder(ctx, token, disk, folder, "", filter, cryptoInfo, archive)
+	if err != nil {
+		_ = archive.Close()
+		return count, err
+	}
+
+	return count, archive.Close()
+}
@@ -7,7 +7,7 @@ import "github.com/kt-soft-dev/kt-cli/pkg"
 func CheckTokenAndAssign(token string, config *Config) error {
 	id, err := CheckToken(token)
 	if err != nil {
-		PrintError(err.Error())
+		PrintError("%v", err)
 		return nil
 	}
 
@@ -0,0 +1,149 @@
+package internal
+
+// Batch item statuses
+const (
+	BatchStatusOk      = "ok"
+	BatchStatusFailed  = "failed"
+	BatchStatusSkipped = "skipped"
+)
+
+// BatchItem is the result of a single item of a batch action
+type BatchItem struct {
+	Item   string `json:"item"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// BatchReport is the summary of a batch action printed in JSON mode
+type BatchReport struct {
+	Items   []*BatchItem `json:"items"`
+	Ok      int          `json:"ok"`
+	Failed  int          `json:"failed"`
+	Skipped int          `json:"skipped,omitempty"`
+	Stopped bool         `json:"stopped,omitempty"`
+}
+
+// Batch collects results of actions working with many items (files, archive entries),
+// so they are reported the same way: a summary table at the end and the exit code by the number of failures
+type Batch struct {
+	report      BatchReport
+	journal     *BatchJournal
+	interrupted bool
+}
+
+// NewBatch creates an empty batch
+func NewBatch() *Batch {
+	return &Batch{report: BatchReport{Items: []*BatchItem{}}}
+}
+
+// Journal makes the batch resumable: completed items are recorded in the journal of the batch identified
+// by the action and its arguments, and with -resume flag items completed by the interrupted run are skipped.
+// The batch works without the journal if it can't be opened
+func (b *Batch) Journal(action string, args ...string) {
+	journal, err := OpenBatchJournal(BatchKey(action, args...), *Resume)
+	if err != nil {
+		PrintWarning("Failed to open the batch journal, the batch can't be resumed: %v", err)
+		return
+	}
+
+	b.journal = journal
+	if journal.Completed() > 0 {
+		Print("Resuming the batch, %d items are already done", journal.Completed())
+	}
+}
+
+// Completed checks if the item was completed by the interrupted run, so it must be skipped.
+// Such items are reported as skipped
+func (b *Batch) Completed(item string) bool {
+	if b.journal == nil || !b.journal.IsCompleted(item) {
+		return false
+	}
+
+	b.report.Items = append(b.report.Items, &BatchItem{Item: item, Status: BatchStatusSkipped})
+	b.report.Skipped++
+	return true
+}
+
+// Add records the result of the item. It returns false if the batch must stop, because the item failed
+// and -fail-fast flag is set
+func (b *Batch) Add(item string, err error) bool {
+	if err == nil {
+		b.report.Items = append(b.report.Items, &BatchItem{Item: item, Status: BatchStatusOk})
+		b.report.Ok++
+		if b.journal != nil {
+			if err := b.journal.Record(item); err != nil {
+				PrintWarning("Failed to record %s in the batch journal: %v", item, err)
+			}
+		}
+		return true
+	}
+
+	b.report.Items = append(b.report.Items, &BatchItem{Item: item, Status: BatchStatusFailed, Error: err.Error()})
+	b.report.Failed++
+	if *FailFast {
+		b.report.Stopped = true
+		return false
+	}
+
+	return true
+}
+
+// Interrupt marks the batch as not finished, because its items can't be read to the end (e.g. the input broke),
+// so the journal is kept for -resume even if all the processed items are done
+func (b *Batch) Interrupt() {
+	b.interrupted = true
+}
+
+// Failed returns the number of failed items
+func (b *Batch) Failed() int {
+	return b.report.Failed
+}
+
+// Report prints the summary of the batch and sets the exit code: ExitFailure if all items failed
+// and ExitPartialFailure if only some of them failed. Skipped items count as done.
+// The journal is removed if the batch is fully successful and kept for -resume otherwise
+func (b *Batch) Report() {
+	if IsJSONMode() {
+		PrintJSON(&b.report)
+	} else if len(b.report.Items) > 0 {
+		tbl := NewTable("Item", "Status", "Error")
+		for _, item := range b.report.Items {
+			tbl.AddRow(item.Item, item.Status, item.Error)
+		}
+		tbl.Print()
+	}
+
+	if b.report.Skipped > 0 {
+		Print("Done: %d ok, %d failed, %d skipped as done before", b.report.Ok, b.report.Failed, b.report.Skipped)
+	} else {
+		Print("Done: %d ok, %d failed", b.report.Ok, b.report.Failed)
+	}
+	if b.report.Stopped {
+		Print("Stopped after the first failure (-fail-fast), the rest is not processed")
+	}
+	b.closeJournal()
+
+	switch {
+	case b.report.Failed == 0:
+	case b.report.Ok+b.report.Skipped == 0:
+		SetExitCode(ExitFailure)
+	default:
+		SetExitCode(ExitPartialFailure)
+	}
+}
+
+// closeJournal closes the journal and tells how to resume the batch which is not fully successful
+func (b *Batch) closeJournal() {
+	if b.journal == nil {
+		return
+	}
+
+	success := b.report.Failed == 0 && !b.interrupted
+	if err := b.journal.Close(success); err != nil {
+		PrintWarning("Failed to close the batch journal: %v", err)
+	}
+	if !success {
+		Print("Progress is saved in %s, run the same command with -resume to skip completed items", b.journal.Path())
+	}
+	b.journal = nil
+}
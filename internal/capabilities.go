@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"time"
+)
+
+// serverInfoTTL is how long the server info is cached in the config
+const serverInfoTTL = 24 * time.Hour
+
+// ServerInfoCache is the server info stored in the config with the time it was received
+type ServerInfoCache struct {
+	pkg.ServerInfo `yaml:",inline"`
+	CheckedAt      int64 `yaml:"checked_at"`
+}
+
+// GetServerInfo returns the server version and capabilities. They are cached in the config for a day,
+// so the server is not asked every run. Nil is returned if the server doesn't report them
+func GetServerInfo(config *Config, refresh bool) (*pkg.ServerInfo, error) {
+	cache := config.Server
+	if !refresh && cache != nil && time.Since(time.Unix(cache.CheckedAt, 0)) < serverInfoTTL {
+		return &cache.ServerInfo, nil
+	}
+
+	info, err := pkg.GetServerInfo(config.Token)
+	if errors.Is(err, pkg.ErrMethodNotSupported) {
+		// Remember that the server can't tell its capabilities to not ask it again
+		info, err = &pkg.ServerInfo{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	config.Server = &ServerInfoCache{ServerInfo: *info, CheckedAt: time.Now().Unix()}
+	return info, nil
+}
+
+// RequireMethod checks that the server supports the method needed by the feature.
+// It gives a precise message instead of a cryptic method-not-found error from the server.
+// If capabilities can't be received, the check is skipped and the server decides by itself
+func RequireMethod(config *Config, method string, feature string) error {
+	info, err := GetServerInfo(config, false)
+	if err != nil {
+		return nil
+	}
+
+	if !info.Supports(method) {
+		return fmt.Errorf("this server doesn't support %s (method %s is not available)", feature, method)
+	}
+
+	return nil
+}
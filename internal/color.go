@@ -0,0 +1,68 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/fatih/color"
+	"golang.org/x/crypto/ssh/terminal"
+	"io"
+	"os"
+)
+
+// Color modes of -color flag
+const (
+	ColorAuto   = "auto"
+	ColorAlways = "always"
+	ColorNever  = "never"
+)
+
+// colorMode is the singleton with the color mode for all the output: tables, errors and warnings
+var colorMode = ColorAuto
+
+// SetColorMode sets the color mode. In auto mode, the output is colored only if it goes to a terminal
+// and NO_COLOR environment variable is not set
+func SetColorMode(mode string) error {
+	switch mode {
+	case ColorAuto, ColorAlways, ColorNever:
+	default:
+		return fmt.Errorf("unknown -color value %q (auto, always or never)", mode)
+	}
+
+	colorMode = mode
+	errorLogger.SetPrefix(colorize(os.Stderr, color.New(color.FgRed), "[ERROR] "))
+	warningLogger.SetPrefix(colorize(os.Stderr, color.New(color.FgYellow), "[WARN] "))
+	return nil
+}
+
+// useColor checks if the output to the writer should be colored
+func useColor(writer io.Writer) bool {
+	switch colorMode {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+
+	if _, ok := os.LookupEnv("NO_COLOR"); ok {
+		return false
+	}
+
+	file, ok := writer.(*os.File)
+	return ok && terminal.IsTerminal(int(file.Fd()))
+}
+
+// colorize formats the text with the color if the output to the writer should be colored
+func colorize(writer io.Writer, c *color.Color, text string) string {
+	return colorFor(writer, c).Sprint(text)
+}
+
+// colorFor enables or disables the color for the output to the writer. The color library decides by stdout only,
+// which is wrong for stderr and the -out file, so the decision is always made here
+func colorFor(writer io.Writer, c *color.Color) *color.Color {
+	if useColor(writer) {
+		c.EnableColor()
+	} else {
+		c.DisableColor()
+	}
+
+	return c
+}
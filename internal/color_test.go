@@ -0,0 +1,83 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureOutput redirects stdout, stderr, the loggers and the results to the file, which is not a terminal,
+// and returns everything printed by print in the color mode
+func captureOutput(t *testing.T, mode string, print func()) string {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "output")
+	file, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldStdout, oldStderr, oldResultWriter, oldColorMode := os.Stdout, os.Stderr, resultWriter, colorMode
+	os.Stdout, os.Stderr, resultWriter = file, file, file
+	errorLogger.SetOutput(file)
+	warningLogger.SetOutput(file)
+	defer func() {
+		os.Stdout, os.Stderr, resultWriter = oldStdout, oldStderr, oldResultWriter
+		errorLogger.SetOutput(os.Stderr)
+		warningLogger.SetOutput(os.Stderr)
+		_ = SetColorMode(oldColorMode)
+		SetExitCode(ExitSuccess)
+		_ = file.Close()
+	}()
+
+	if err := SetColorMode(mode); err != nil {
+		t.Fatal(err)
+	}
+	print()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRedirectedOutputHasNoColor(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		noColor   bool
+		wantColor bool
+	}{
+		{name: "auto mode", mode: ColorAuto},
+		{name: "auto mode with NO_COLOR", mode: ColorAuto, noColor: true},
+		{name: "never mode", mode: ColorNever},
+		{name: "always mode", mode: ColorAlways, wantColor: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.noColor {
+				t.Setenv("NO_COLOR", "1")
+			}
+
+			output := captureOutput(t, test.mode, func() {
+				PrintError("failed to delete %s", "file1")
+				PrintWarning("disk is almost full")
+				tbl := NewTable("ID", "Name")
+				tbl.AddRow("file1", "notes.txt")
+				tbl.Print()
+			})
+
+			for _, want := range []string{"[ERROR]", "failed to delete file1", "[WARN]", "disk is almost full", "notes.txt"} {
+				if !strings.Contains(output, want) {
+					t.Errorf("output doesn't contain %q: %q", want, output)
+				}
+			}
+			if hasColor := strings.Contains(output, "\x1b["); hasColor != test.wantColor {
+				t.Errorf("output has ANSI codes: %v, want %v: %q", hasColor, test.wantColor, output)
+			}
+		})
+	}
+}
@@ -9,6 +9,72 @@ import (
 type Config struct {
 	UserID string `yaml:"user_id"`
 	Token  string `yaml:"token"`
+	// DefaultDisk is used instead of the account default disk when no disk is set by flags
+	DefaultDisk string `yaml:"default_disk,omitempty"`
+	// RememberDisk makes the last explicitly used disk the default one for the next runs (see LastDisk)
+	RememberDisk bool `yaml:"remember_disk,omitempty"`
+	// LastDisk is the last explicitly used disk, it is kept only if RememberDisk is set
+	LastDisk string `yaml:"last_disk,omitempty"`
+	// Defaults are the values of flags used when the flags are not set on the command line (see ApplyConfigDefaults)
+	Defaults map[string]string `yaml:"defaults,omitempty"`
+	// Server is the cached server version and capabilities
+	Server *ServerInfoCache `yaml:"server,omitempty"`
+
+	// expanded keeps the original values of fields with environment variables, so they are saved as-is
+	expanded map[string]expandedValue
+}
+
+// expandedValue is the value of the config field before and after environment variables expansion
+type expandedValue struct {
+	raw   string
+	value string
+}
+
+// expandableFields returns the string fields where environment variables are expanded.
+// The token is never expanded to avoid leaking it through the environment by mistake
+func (c *Config) expandableFields() map[string]*string {
+	return map[string]*string{
+		"user_id":      &c.UserID,
+		"default_disk": &c.DefaultDisk,
+	}
+}
+
+// expandEnv replaces ${VAR} and $VAR in expandable fields with values of environment variables.
+// "$$" is the escaped literal "$"
+func (c *Config) expandEnv() {
+	c.expanded = map[string]expandedValue{}
+	for name, field := range c.expandableFields() {
+		value := ExpandEnv(*field)
+		if value != *field {
+			c.expanded[name] = expandedValue{raw: *field, value: value}
+			*field = value
+		}
+	}
+}
+
+// withRawValues returns the copy of the config with expanded fields restored to their original values,
+// unless they were changed after loading
+func (c *Config) withRawValues() *Config {
+	copied := *c
+	for name, field := range copied.expandableFields() {
+		if expanded, ok := c.expanded[name]; ok && *field == expanded.value {
+			*field = expanded.raw
+		}
+	}
+
+	return &copied
+}
+
+// ExpandEnv replaces ${VAR} and $VAR in the string with values of environment variables like os.ExpandEnv,
+// but "$$" is kept as the literal "$"
+func ExpandEnv(value string) string {
+	return os.Expand(value, func(name string) string {
+		if name == "$" {
+			return "$"
+		}
+
+		return os.Getenv(name)
+	})
 }
 
 // CreateDefaultConfig creates an empty configuration
@@ -16,7 +82,8 @@ func CreateDefaultConfig() *Config {
 	return &Config{}
 }
 
-// LoadConfig loads the configuration from a YAML file or creates the empty one
+// LoadConfig loads the configuration from a YAML file or creates the empty one.
+// The file is validated first, so wrong fields are reported precisely
 func LoadConfig(filename string) (*Config, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
@@ -25,18 +92,27 @@ func LoadConfig(filename string) (*Config, error) {
 		return defaultConf, nil
 	}
 
+	warnings, err := ValidateConfig(filename, data)
+	for _, warning := range warnings {
+		PrintWarning(warning)
+	}
+	if err != nil {
+		return nil, err
+	}
+
 	var config Config
 	err = yaml.Unmarshal(data, &config)
 	if err != nil {
 		return nil, err
 	}
 
+	config.expandEnv()
 	return &config, nil
 }
 
 // SaveConfig saves the configuration to a YAML file
 func SaveConfig(config *Config, filename string) error {
-	data, err := yaml.Marshal(config)
+	data, err := yaml.Marshal(config.withRawValues())
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// configSchema is the expected kind of every top-level field of the config file
+var configSchema = map[string]string{
+	"user_id":       "string",
+	"token":         "string",
+	"default_disk":  "string",
+	"remember_disk": "boolean",
+	"last_disk":     "string",
+	"defaults":      "mapping",
+	"server":        "mapping",
+}
+
+// ConfigError describes the wrong field of the config file. Line is 0 if it is unknown
+type ConfigError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e *ConfigError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+	}
+
+	return fmt.Sprintf("%s: %s", e.File, e.Message)
+}
+
+// ValidateConfig checks the types of fields of the config file content. The first wrong field is returned as
+// ConfigError, unknown fields (probably typos) are returned as warnings
+func ValidateConfig(filename string, data []byte) (warnings []string, err error) {
+	var fields map[string]interface{}
+	if err := yaml.Unmarshal(data, &fields); err != nil {
+		return nil, &ConfigError{File: filename, Message: strings.TrimPrefix(err.Error(), "yaml: ")}
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		expected, known := configSchema[name]
+		if !known {
+			warning := &ConfigError{File: filename, Line: configFieldLine(data, name), Message: fmt.Sprintf("unknown field %s is ignored", name)}
+			warnings = append(warnings, warning.Error())
+			continue
+		}
+
+		if actual := yamlKind(fields[name]); actual != expected && actual != "null" {
+			return warnings, &ConfigError{
+				File:    filename,
+				Line:    configFieldLine(data, name),
+				Message: fmt.Sprintf("%s must be a %s, got %s", name, expected, actual),
+			}
+		}
+	}
+
+	return warnings, nil
+}
+
+// yamlKind returns the human-readable kind of the decoded YAML value
+func yamlKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case int, int64, uint64, float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "list"
+	case map[interface{}]interface{}:
+		return "mapping"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// configFieldLine returns the line number of the top-level field in the config file, or 0 if it is not found
+func configFieldLine(data []byte, name string) int {
+	pattern := regexp.MustCompile(`^["']?` + regexp.QuoteMeta(name) + `["']?\s*:`)
+	for i, line := range strings.Split(string(data), "\n") {
+		if pattern.MatchString(line) {
+			return i + 1
+		}
+	}
+
+	return 0
+}
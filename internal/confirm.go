@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"golang.org/x/crypto/ssh/terminal"
+	"os"
+	"strings"
+)
+
+// stdinIsTerminal checks if the user can answer the prompt
+var stdinIsTerminal = func() bool {
+	return terminal.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// Confirm asks the user to confirm a destructive operation and returns true if it is confirmed.
+// The -yes flag confirms without asking. Without it, the operation is refused in -no-interactive mode
+// and when stdin is not a terminal, so a destructive operation never proceeds silently
+func Confirm(prompt string) bool {
+	if *Yes {
+		return true
+	}
+	if *NotInteractive || !stdinIsTerminal() {
+		return false
+	}
+
+	answer := pkg.ScanOrDefault(prompt+" (y/n): ", "n")
+	return strings.EqualFold(strings.TrimSpace(answer), "y")
+}
+
+// ConfirmOrAbort asks like Confirm. If the operation is not confirmed, it reports the abort of the operation
+// (like "Deletion") and sets the failure exit code
+func ConfirmOrAbort(prompt string, operation string) bool {
+	if Confirm(prompt) {
+		return true
+	}
+
+	PrintError("%s is aborted (use -yes flag to confirm in non-interactive mode)", operation)
+	SetExitCode(ExitFailure)
+	return false
+}
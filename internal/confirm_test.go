@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setConfirmMode sets the flags and the terminal check used by Confirm, the answer is written to stdin.
+// Everything is restored when the test is done
+func setConfirmMode(t *testing.T, yes bool, notInteractive bool, terminal bool, answer string) {
+	t.Helper()
+
+	oldYes, oldNotInteractive, oldIsTerminal := *Yes, *NotInteractive, stdinIsTerminal
+	oldStdin, oldStdout := os.Stdin, os.Stdout
+	t.Cleanup(func() {
+		*Yes, *NotInteractive, stdinIsTerminal = oldYes, oldNotInteractive, oldIsTerminal
+		os.Stdin, os.Stdout = oldStdin, oldStdout
+		pkg.SetInteractiveMode(false)
+		SetExitCode(ExitSuccess)
+	})
+
+	*Yes, *NotInteractive = yes, notInteractive
+	stdinIsTerminal = func() bool {
+		return terminal
+	}
+	pkg.SetInteractiveMode(!notInteractive)
+
+	stdin := filepath.Join(t.TempDir(), "stdin")
+	if err := os.WriteFile(stdin, []byte(answer), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(stdin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = file.Close()
+	})
+	os.Stdin = file
+
+	// The prompt is not checked, so it is hidden
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = devNull.Close()
+	})
+	os.Stdout = devNull
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		name           string
+		yes            bool
+		notInteractive bool
+		terminal       bool
+		answer         string
+		want           bool
+	}{
+		{name: "yes flag", yes: true, want: true},
+		{name: "yes flag in non-interactive mode", yes: true, notInteractive: true, want: true},
+		{name: "non-interactive mode", notInteractive: true, terminal: true, answer: "y\n", want: false},
+		{name: "stdin is not a terminal", terminal: false, answer: "y\n", want: false},
+		{name: "confirmed", terminal: true, answer: "y\n", want: true},
+		{name: "confirmed in upper case", terminal: true, answer: "Y\n", want: true},
+		{name: "refused", terminal: true, answer: "n\n", want: false},
+		{name: "other answer", terminal: true, answer: "yes\n", want: false},
+		{name: "empty answer", terminal: true, answer: "\n", want: false},
+		{name: "no answer", terminal: true, answer: "", want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setConfirmMode(t, test.yes, test.notInteractive, test.terminal, test.answer)
+
+			if got := Confirm("Delete the file?"); got != test.want {
+				t.Errorf("Confirm() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestConfirmOrAbort(t *testing.T) {
+	tests := []struct {
+		name           string
+		yes            bool
+		notInteractive bool
+		want           bool
+		wantExitCode   int
+	}{
+		{name: "confirmed", yes: true, want: true, wantExitCode: ExitSuccess},
+		{name: "aborted", notInteractive: true, want: false, wantExitCode: ExitFailure},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setConfirmMode(t, test.yes, test.notInteractive, false, "")
+
+			if got := ConfirmOrAbort("Delete the file?", "Deletion"); got != test.want {
+				t.Errorf("ConfirmOrAbort() = %v, want %v", got, test.want)
+			}
+			if ExitCode() != test.wantExitCode {
+				t.Errorf("exit code is %d, want %d", ExitCode(), test.wantExitCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+)
+
+// configDefaultFlags are the flags which may have default values in the defaults section of the config file.
+// Only options are listed, so stored defaults never start an action by themselves
+var configDefaultFlags = map[string]bool{
+	"concurrency":           true,
+	"act.download.path":     true,
+	"act.download.disk":     true,
+	"act.download.mode":     true,
+	"act.download.parallel": true,
+	"act.download.add-ext":  true,
+	"act.upload.disk":       true,
+	"act.upload.folder":     true,
+	"act.upload.compress":   true,
+	"act.upload.mkdir":      true,
+	"act.files.disk":        true,
+}
+
+// ApplyConfigDefaults sets the flags from the defaults section of the config, unless they are set
+// on the command line. Environment variables in the values are expanded. Flags which can't have defaults
+// are reported as warnings and ignored, wrong values are errors
+func ApplyConfigDefaults(config *Config) error {
+	if len(config.Defaults) == 0 {
+		return nil
+	}
+
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	names := make([]string, 0, len(config.Defaults))
+	for name := range config.Defaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !configDefaultFlags[name] {
+			PrintWarning("Default value of %s in the config is ignored: the flag can't have a default", name)
+			continue
+		}
+		if explicit[name] {
+			continue
+		}
+
+		if err := flag.Set(name, ExpandEnv(config.Defaults[name])); err != nil {
+			return fmt.Errorf("invalid default value of %s in the config: %w", name, err)
+		}
+	}
+
+	return nil
+}
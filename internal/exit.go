@@ -0,0 +1,30 @@
+package internal
+
+const (
+	// ExitSuccess is the exit code when everything is done
+	ExitSuccess = 0
+	// ExitFailure is the exit code when the action failed
+	ExitFailure = 1
+	// ExitUsage is the exit code when the command line is invalid
+	ExitUsage = 2
+	// ExitQuotaExceeded is the exit code when the upload failed because the disk is full
+	ExitQuotaExceeded = 3
+	// ExitPartialFailure is the exit code when some items of a batch action failed, but not all of them
+	ExitPartialFailure = 4
+	// ExitInterrupted is the exit code when the transfer is stopped by the interrupt (Ctrl-C), like shells report SIGINT
+	ExitInterrupted = 130
+)
+
+// exitCode is the singleton with the exit code the program should finish with
+var exitCode = ExitSuccess
+
+// SetExitCode sets the exit code the program finishes with. Actions don't exit by themselves,
+// so deferred operations like saving the config are always done
+func SetExitCode(code int) {
+	exitCode = code
+}
+
+// ExitCode returns the exit code set by actions
+func ExitCode() int {
+	return exitCode
+}
@@ -0,0 +1,127 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"path"
+	"strings"
+	"time"
+)
+
+// FileFilter selects files by their MIME type and modification date. Zero filter matches all the files
+type FileFilter struct {
+	// Types are MIME patterns like "image/*" or "application/pdf", or file types like "image"
+	Types []string
+	// Since and Until limit the modification date, zero values mean no limit
+	Since time.Time
+	Until time.Time
+}
+
+// filterDateLayouts are the accepted formats of dates in filters
+var filterDateLayouts = []string{time.RFC3339, "2006-01-02"}
+
+// ParseFilterDate parses the date in RFC3339 or YYYY-MM-DD format. Empty string is a zero time
+func ParseFilterDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	for _, layout := range filterDateLayouts {
+		if date, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %q (use YYYY-MM-DD or RFC3339 format)", value)
+}
+
+// NewFileFilter creates the filter from comma-separated types and dates from flags.
+// The until date without time includes the whole day
+func NewFileFilter(types string, since string, until string) (*FileFilter, error) {
+	filter := &FileFilter{}
+	for _, fileType := range strings.Split(types, ",") {
+		fileType = strings.ToLower(strings.TrimSpace(fileType))
+		if fileType == "" {
+			continue
+		}
+		if _, err := path.Match(fileType, ""); err != nil {
+			return nil, fmt.Errorf("invalid type pattern %q: %w", fileType, err)
+		}
+		filter.Types = append(filter.Types, fileType)
+	}
+
+	var err error
+	filter.Since, err = ParseFilterDate(since)
+	if err != nil {
+		return nil, err
+	}
+
+	filter.Until, err = ParseFilterDate(until)
+	if err != nil {
+		return nil, err
+	}
+	if len(until) == len("2006-01-02") {
+		filter.Until = filter.Until.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+
+	return filter, nil
+}
+
+// IsEmpty checks if the filter matches all the files
+func (f *FileFilter) IsEmpty() bool {
+	return f == nil || (len(f.Types) == 0 && f.Since.IsZero() && f.Until.IsZero())
+}
+
+// Match checks if the file passes the filter
+func (f *FileFilter) Match(file *pkg.File) bool {
+	if f.IsEmpty() {
+		return true
+	}
+
+	modified := time.Unix(int64(file.Date), 0)
+	if !f.Since.IsZero() && modified.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && modified.After(f.Until) {
+		return false
+	}
+
+	return f.matchType(file)
+}
+
+// Filter returns the files passing the filter. It must get the whole listing of the folder
+// (e.g. from pkg.GetAllFolderContents), otherwise matching files of the next pages are missed
+func (f *FileFilter) Filter(files []*pkg.File) []*pkg.File {
+	if f.IsEmpty() {
+		return files
+	}
+
+	var matched []*pkg.File
+	for _, file := range files {
+		if f.Match(file) {
+			matched = append(matched, file)
+		}
+	}
+
+	return matched
+}
+
+// matchType checks if the MIME type or the type of the file matches any of the filter types
+func (f *FileFilter) matchType(file *pkg.File) bool {
+	if len(f.Types) == 0 {
+		return true
+	}
+
+	mime := strings.ToLower(file.Mime)
+	fileType := strings.ToLower(file.Type)
+	for _, pattern := range f.Types {
+		if matched, _ := path.Match(pattern, mime); matched {
+			return true
+		}
+		if pattern == fileType {
+			return true
+		}
+	}
+
+	return false
+}
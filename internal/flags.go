@@ -1,8 +1,14 @@
 package internal
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"io"
 	"os"
+	"strings"
+	"time"
 )
 
 var (
@@ -10,46 +16,288 @@ var (
 	Debug = flag.Bool("Debug", false, "Enable Debug mode")
 	// Params - Set parameters for API method if called
 	Params = flag.String("params", "", "Set API method key=value parameters separated by space (format: k=v k=v k=v...)")
+	// ParamsSep - Separator of key=value pairs in params
+	ParamsSep = flag.String("params.sep", "", "Set separator of -params pairs instead of whitespace (e.g. \";\" for values with spaces)")
+	// ParamList - Set API method parameters one by one, they override -params
+	ParamList = keyValueListFlag("param", "Set API method parameter (format: key=value); can be repeated and overrides -params")
+	// Fields - Print only these fields of API method result
+	Fields = flag.String("fields", "", "Print only listed fields of API method result, nested fields are separated by dots (format: a,b.c)")
+	// OmitMissing - Skip fields that are absent in the result instead of printing them as null
+	OmitMissing = flag.Bool("omit-missing", false, "Skip -fields that are missing in the result instead of printing null")
 
 	// Global flags
 
-	ConfigFilename = flag.String("config", "config.yaml", "Set config file path")
-	PrintModeFlag  = flag.Int("output", ModeLog, "Output mode (0 - log with timestamp, 1 - plain log, 2 - no newline)")
-	NotInteractive = flag.Bool("no-interactive", false, "Do not ask for any input, use default values")
-	NoConfigSave   = flag.Bool("no-save", false, "Do not save the config file on exit (including token)")
-	Auth           = flag.String("token", "", "Set auth token for future requests (will be saved in config file; also you can use environment variable KT_CLI_TOKEN)")
-	Pretty         = flag.Bool("pretty", false, "Pretty-print JSON responses")
-	Passwd         = flag.String("passwd", "", "Set password for encryption/decryption. Also you can use environment variable KT_CLI_PASSWD")
-	PublicKeyFile  = flag.String("public", "public_key.pub", "Set public key file path for encryption/decryption (will be downloaded from the server if empty)")
-	PrivateKeyFile = flag.String("private", "private_key.asc", "Set private key file path for encryption/decryption (will be downloaded and decrypted from the server if empty)")
+	ConfigFilename    = flag.String("config", "config.yaml", "Set config file path")
+	PrintModeFlag     = printModeFlag("output", ModeLog, "Output mode (0 or log - log with timestamp, 1 or plain - plain log, 2 or nonewline - no newline, 3 or json - JSON results)")
+	LogFormat         = flag.String("log-format", LogFormatText, "Format of messages, warnings and errors: text, or json for JSON lines with time, level, message and fields on stderr (secrets are redacted)")
+	ColorFlag         = flag.String("color", ColorAuto, "Color tables, errors and warnings: auto (only for terminals, unless NO_COLOR is set), always or never")
+	StrictDisk        = flag.Bool("strict-disk", false, "Require explicit disk ID (or \".\" for default disk) instead of choosing the default disk silently")
+	RememberDisk      = flag.Bool("remember-disk", false, "Remember the last explicitly used disk and use it when no disk is set (saved in the config file)")
+	NoRememberDisk    = flag.Bool("no-remember-disk", false, "Stop remembering the last used disk and forget it")
+	NotInteractive    = flag.Bool("no-interactive", false, "Do not ask for any input, use default values")
+	NoProgress        = flag.Bool("no-progress", false, "Do not show the progress of uploads and downloads")
+	NoConfig          = flag.Bool("no-config", false, "Do not read or write the config file at all, use only flags and environment variables (implies -no-save)")
+	NoConfigSave      = flag.Bool("no-save", false, "Do not save the config file on exit (including token)")
+	Offline           = flag.Bool("offline", false, "Fail immediately on any network access; only local operations work")
+	Anonymous         = flag.Bool("anonymous", false, "Send requests without a token; config file is neither read nor saved and token is never asked")
+	Auth              = flag.String("token", "", "Set auth token for future requests, \"-\" to read it from the first line of stdin (will be saved in config file; also you can use environment variable KT_CLI_TOKEN)")
+	TokenFile         = flag.String("token-file", "", "Read auth token from the file (also you can use environment variable KT_TOKEN_FILE)")
+	Out               = flag.String("out", "", "Write results (API responses, lists, tables) to the file instead of stdout, creating parent directories")
+	PickFirst         = flag.Bool("first", false, "Pick the first file if several files match the file path")
+	PickLatest        = flag.Bool("latest", false, "Pick the latest modified file if several files match the file path")
+	Yes               = flag.Bool("yes", false, "Confirm destructive operations without asking")
+	FailFast          = flag.Bool("fail-fast", false, "Stop batch actions (like deleting by pattern) on the first failed item")
+	Resume            = flag.Bool("resume", false, "Skip items of batch actions completed by the interrupted run of the same command")
+	Force             = flag.Bool("force", false, "Override safety limits, like -act.download.max-size")
+	DryRun            = flag.Bool("dry-run", false, "Show what would be done without doing it")
+	Pretty            = flag.Bool("pretty", false, "Pretty-print JSON responses")
+	Passwd            = passwordListFlag("passwd", "Deprecated, exposes the password in the process list; use -passwd-file or -passwd-env. Set password for encryption/decryption; repeat as disk:password for passwords of other disks (\":password\" sets the default one containing \":\"). Also you can use environment variable KT_CLI_PASSWD")
+	PasswdFile        = flag.String("passwd-file", "", "Read the crypto password from the file; every line is a value of -passwd (e.g. disk:password)")
+	PasswdEnv         = flag.String("passwd-env", "", "Read the crypto password from the environment variable with this name")
+	PublicKeyFile     = flag.String("public", "public_key.pub", "Set public key file path for encryption/decryption (will be downloaded from the server if empty)")
+	PrivateKeyFile    = flag.String("private", "private_key.asc", "Set private key file path for encryption/decryption (will be downloaded and decrypted from the server if empty)")
+	RawPrivateKeyFile = flag.String("private-raw", "", "Set path to the already decrypted private key, bypassing password key derivation (for external key management)")
+	Stats             = flag.Bool("stats", false, "Print transfer statistics as a JSON line after upload/download")
+	StatsFile         = flag.String("stats-file", "", "Append transfer statistics as JSON lines to the file instead of stdout")
+	MaxIdleConns      = flag.Int("max-idle-conns", pkg.DefaultTransportSettings.MaxIdleConns, "Set number of idle keep-alive connections kept for reuse (0 - no limit)")
+	MaxConnsHost      = flag.Int("max-conns-per-host", pkg.DefaultTransportSettings.MaxConnsPerHost, "Set limit of simultaneous connections to the API host (0 - no limit)")
+	IoBufferSize      = flag.Int("io.buffer-size", pkg.DefaultCopyBufferSize, "Set size of the copy buffer for uploads and downloads in bytes (bigger may be faster on fast links)")
+	Concurrency       = flag.Int("concurrency", 4, "Set limit of simultaneous requests (API calls and transfers) in the whole run (0 - no limit)")
+	ApiRps            = flag.Float64("api.rps", 0, "Limit API calls per second for the whole run (0 - no limit)")
+	ApiAttempts       = flag.Int("api.attempts", pkg.DefaultRetryPolicy.MaxAttempts, "Set how many times an API call failed by a connection error or a server error (5xx) is tried (1 - no retries)")
+	ApiRetryTime      = flag.Duration("api.retry-time", pkg.DefaultRetryPolicy.MaxElapsed, "Set how long a failed API call is retried (0 - no limit)")
+	JobTimeout        = flag.Duration("job-timeout", 10*time.Minute, "Set how long to wait for uploads and copies processed by the server in the background")
+	TraceFile         = flag.String("trace-file", "", "Append API requests and responses to the file as JSON lines (secrets are redacted)")
 
 	// Actions to perform
 
-	Method = flag.String("act.method", "", "Call API method")
+	Method = flag.String("act.method", "", "Call API method by its name or alias (e.g. files for files.get, see the aliases below)")
 	Ping   = flag.Bool("act.ping", false, "Check if API is alive")
 
+	ServerInfo = flag.Bool("act.server-info", false, "Show server version and supported API methods")
+
+	Health = flag.Bool("act.health", false, "Show server components status and ping latency")
+
+	SelfUpdate    = flag.Bool("act.self-update", false, "Update the binary to the latest release (checksum is verified, -dry-run only reports the version)")
+	SelfUpdateURL = flag.String("act.self-update.url", DefaultReleaseURL, "Set the release endpoint used by the self-update")
+
+	PingWait     = flag.Bool("act.ping.wait", false, "Wait until API is alive, polling it on interval (exits with non-zero code on timeout)")
+	PingTimeout  = flag.Duration("act.ping.timeout", 30*time.Second, "Set how long to wait for API to be alive")
+	PingInterval = flag.Duration("act.ping.interval", time.Second, "Set interval between API checks while waiting")
+
+	DisksList            = flag.Bool("act.disks", false, "List disks with their encryption and quotas")
+	DisksCreate          = flag.String("act.disks.create", "", "Create a disk with the title and print its ID")
+	DisksCreateEncrypted = flag.Bool("act.disks.create.encrypted", false, "Encrypt the created disk: keys are generated and locked with the crypto password (taken from password flags or asked)")
+
 	GetKeys            = flag.String("act.keys", "", "Download keys for the provided disk (\".\" for default disk)")
 	GetKeysPublicName  = flag.String("act.keys.public", "public_key.pub", "Set public key name for download")
 	GetKeysPrivateName = flag.String("act.keys.private", "private_key.asc", "Set private key name for download")
+	ChangePassword     = flag.String("act.keys.change-password", "", "Change the crypto password of the provided disk (\".\" for default disk); the passwords are asked")
+
+	Download             = flag.String("act.download", "", "Download file by file ID or by path from the disk root (e.g. /Backups/report.pdf)")
+	DownloadPath         = flag.String("act.download.path", ".", "Set path to save downloaded file")
+	DownloadTee          = flag.Bool("act.download.tee", false, "Also write the downloaded content to stdout while saving it to the file")
+	DownloadNoDecompress = flag.Bool("act.download.no-decompress", false, "Save files compressed by -act.upload.compress as-is, without decompression")
+	DownloadAddExt       = flag.Bool("act.download.add-ext", false, "Append the extension by the file MIME type if the name has no known extension (when saving to a directory)")
+	DownloadRawNames     = flag.Bool("act.download.raw-names", false, "Save files with names as they are on the server, without replacing characters invalid on this system")
+	DownloadParallel     = flag.Bool("act.download.parallel", false, "Download a big non-encrypted file in -concurrency parts at once (if the server supports ranged downloads)")
+	DownloadMaxSize      = flag.String("act.download.max-size", "", "Abort the download if the file is bigger than the size (e.g. 500MB or 2G; -force overrides it)")
+	DownloadResume       = flag.Bool("act.download.resume", false, "Continue the interrupted download of a non-encrypted file into the existing file instead of starting over")
+	DownloadRange        = flag.String("act.download.range", "", "Download only the byte range of a non-encrypted file (format: start-end or start-)")
+	DownloadMode         = flag.String("act.download.mode", "0644", "Set permissions of the saved file in octal format (e.g. 0600 for sensitive content)")
+	DownloadLatest       = flag.String("act.download.latest", "", "Download the latest modified file whose name matches the prefix or glob (\"*\" for any file)")
+	DownloadLatestFolder = flag.String("act.download.latest.folder", "", "Set folder of -act.download.latest by ID or path from the disk root (disk root if empty)")
+	DownloadDisk         = flag.String("act.download.disk", "", "Set disk for folder download and file paths (\".\" or empty for default disk)")
 
-	Download     = flag.String("act.download", "", "Download file by file ID")
-	DownloadPath = flag.String("act.download.path", ".", "Set path to save downloaded file")
+	DownloadFolder       = flag.String("act.download.folder", "", "Download all files of the folder by folder ID into an archive (saved to -act.download.path, \"-\" for stdout)")
+	DownloadFolderFormat = flag.String("act.download.folder.format", "tar", "Set archive format for folder download (tar or zip)")
+	DownloadFolderType   = flag.String("act.download.folder.type", "", "Archive only files of these comma-separated MIME types or file types (e.g. image/*,application/pdf)")
+	DownloadFolderSince  = flag.String("act.download.folder.since", "", "Archive only files modified since the date (YYYY-MM-DD or RFC3339)")
+	DownloadFolderUntil  = flag.String("act.download.folder.until", "", "Archive only files modified until the date, inclusive (YYYY-MM-DD or RFC3339)")
 
-	Upload       = flag.String("act.upload", "", "Upload file by path; stdin is also supported")
-	UploadName   = flag.String("act.upload.name", "", "Set file name for upload (required for stdin)")
-	UploadDisk   = flag.String("act.upload.disk", "", "Set disk for upload")
-	UploadFolder = flag.String("act.upload.folder", "", "Set folder for upload")
+	Upload            = flag.String("act.upload", "", "Upload file by path; stdin is also supported")
+	UploadName        = flag.String("act.upload.name", "", "Set file name for upload (required for stdin)")
+	UploadDisk        = flag.String("act.upload.disk", "", "Set disk for upload (\".\" or empty for default disk)")
+	UploadFolder      = flag.String("act.upload.folder", "", "Set folder for upload by ID or by path from the disk root (e.g. /Backups/2024)")
+	UploadCompress    = flag.String("act.upload.compress", "no", "Compress the file with gzip before upload and encryption (no, yes, or auto to skip already compressed files)")
+	UploadMkdir       = flag.Bool("act.upload.mkdir", false, "Create missing folders of -act.upload.folder path")
+	UploadDedup       = flag.Bool("act.upload.dedup", false, "Skip upload if an identical file (by SHA-256 checksum) already exists on the disk")
+	UploadIfNotExists = flag.Bool("act.upload.if-not-exists", false, "Skip upload if a file with the same name exists in the upload folder")
+	UploadIfChanged   = flag.Bool("act.upload.if-changed", false, "Upload only if the file with the same name in the upload folder differs by checksum or size")
+	UploadStdinTar    = flag.Bool("act.upload.stdin-tar", false, "Read a tar archive from stdin and upload each file separately, recreating its folders")
+	UploadFromURL     = flag.String("act.upload.from-url", "", "Upload the file from the http(s) URL; the server fetches it if possible, otherwise it is streamed through the CLI")
 
-	FilesList = flag.String("act.files", "", "List files in provided disk")
+	Verify     = flag.String("act.verify", "", "Compare the local file with the file on the server by file ID")
+	VerifyPath = flag.String("act.verify.path", "", "Set path of the local file to verify")
+
+	FilesList        = flag.String("act.files", "", "List files in provided disk")
+	FilesOnly        = flag.String("act.files.only", "", "List only files or only folders (files or folders; both if empty)")
+	FilesOffset      = flag.Int("act.files.offset", 0, "Skip the number of files at the beginning of the list")
+	FilesLimit       = flag.Int("act.files.limit", 0, "List up to the number of files, requesting as many pages as needed (0 - a single page of the server's size)")
+	FilesAll         = flag.Bool("act.files.all", false, "List all the files, requesting pages until the end")
+	FilesIdsOnly     = flag.Bool("act.files.ids-only", false, "Print only IDs of the listed files, one per line (for piping to other commands)")
+	FilesOut         = flag.String("act.files.out", "", "Also save the files list to the file, besides printing it")
+	FilesOutFormat   = flag.String("act.files.out.format", "", "Set format of -act.files.out file (json or csv; detected by the extension if empty)")
+	DeleteFile       = flag.String("act.files.delete", "", "Delete file by file ID (moves it to the trash if the server supports it)")
+	DeletePermanent  = flag.Bool("act.files.delete.permanent", false, "Delete file permanently instead of moving it to the trash")
+	DeletePattern    = flag.String("act.files.delete.prefix", "", "Delete all files of the folder whose names match the prefix or glob (e.g. \"report-\" or \"*.tmp\")")
+	MoveMany         = flag.String("act.files.move-many", "", "Move files by comma-separated IDs or paths (\"-\" to read them from stdin, one per line)")
+	MoveDisk         = flag.String("act.files.move.disk", "", "Set destination disk of -act.files.move-many (\".\" or empty for default disk)")
+	MoveFolder       = flag.String("act.files.move.folder", "", "Set destination folder of -act.files.move-many by ID or path from the disk root (disk root if empty)")
+	FileURL          = flag.String("act.files.url", "", "Print download link of the file by file ID without downloading it")
+	FilesCheckCrypto = flag.String("act.files.check-crypto", "", "Check that the file by file ID can be decrypted with the password and keys, without downloading it")
+	CreateFolder     = flag.String("act.files.mkdir", "", "Create folder by path from the disk root, including missing parent folders (e.g. /Backups/2024)")
+	FilesDisk        = flag.String("act.files.disk", "", "Set disk for file operations (\".\" or empty for default disk)")
+	FilesFolder      = flag.String("act.files.folder", "", "Set folder for file operations (disk root if empty)")
+
+	TrashList    = flag.String("act.trash.list", "", "List files in the trash of provided disk (\".\" for default disk)")
+	TrashRestore = flag.String("act.trash.restore", "", "Restore file from the trash by file ID")
+	SharesList   = flag.String("act.shares.list", "", "List public links to files of provided disk (\".\" for default disk)")
+	SharesRevoke = flag.String("act.shares.revoke", "", "Revoke public link by its ID")
+	TrashEmpty   = flag.String("act.trash.empty", "", "Permanently delete all files in the trash of provided disk (\".\" for default disk)")
+
+	Copy       = flag.String("act.copy", "", "Copy file by file ID to another disk and/or folder")
+	CopyDisk   = flag.String("act.copy.disk", "", "Set destination disk for copy (\".\" or empty for default disk)")
+	CopyFolder = flag.String("act.copy.folder", "", "Set destination folder for copy")
 	// @todo method to replace files contents
 )
 
 // ScanEnv scans environment variables as replacement for the flags that are not set
-func ScanEnv() {
+// The token is taken from -token flag first, then from the token file, then from KT_CLI_TOKEN variable.
+// An error is returned if the token file is set but can't be read
+func ScanEnv() error {
+	if *Auth == "-" {
+		token, err := ReadTokenLine(os.Stdin)
+		if err != nil {
+			return err
+		}
+		*Auth = token
+		tokenFromStdin = true
+	}
+	if *TokenFile == "" {
+		*TokenFile = os.Getenv("KT_TOKEN_FILE")
+	}
+	if *Auth == "" && *TokenFile != "" {
+		token, err := ReadTokenFile(*TokenFile)
+		if err != nil {
+			return err
+		}
+		*Auth = token
+	}
 	if *Auth == "" {
 		*Auth = os.Getenv("KT_CLI_TOKEN")
 	}
-	if *Passwd == "" {
-		*Passwd = os.Getenv("KT_CLI_PASSWD")
+	if Passwd.IsSet() {
+		PrintWarning("-passwd exposes the password in the process list and shell history, use -passwd-file, -passwd-env or the password prompt instead")
+	}
+	if !Passwd.IsSet() && *PasswdFile != "" {
+		passwords, err := ReadPasswordFile(*PasswdFile)
+		if err != nil {
+			return err
+		}
+		for _, password := range passwords {
+			_ = Passwd.Set(password)
+		}
+	}
+	if !Passwd.IsSet() && *PasswdEnv != "" {
+		password := os.Getenv(*PasswdEnv)
+		if password == "" {
+			return fmt.Errorf("environment variable %s of -passwd-env is empty", *PasswdEnv)
+		}
+		_ = Passwd.Set(password)
+	}
+	if !Passwd.IsSet() && os.Getenv("KT_CLI_PASSWD") != "" {
+		_ = Passwd.Set(os.Getenv("KT_CLI_PASSWD"))
+	}
+
+	return nil
+}
+
+// tokenFromStdin is set if the token is read from stdin by "-token -"
+var tokenFromStdin bool
+
+// IsTokenFromStdin checks if the token is read from stdin by "-token -", so it has to be validated like the entered one
+func IsTokenFromStdin() bool {
+	return tokenFromStdin
+}
+
+// ReadTokenLine reads the token from the first line of the reader. The reader is read byte by byte,
+// so the rest of stdin is left for the action (e.g. the uploaded content). Like for the token file,
+// the content is never included into errors
+func ReadTokenLine(reader io.Reader) (string, error) {
+	var line []byte
+	buffer := make([]byte, 1)
+	for {
+		n, err := reader.Read(buffer)
+		if n > 0 {
+			if buffer[0] == '\n' {
+				break
+			}
+			line = append(line, buffer[0])
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read token from stdin: %w", err)
+		}
+	}
+
+	token := strings.TrimSpace(string(line))
+	if token == "" {
+		return "", errors.New("token is not found in the first line of stdin")
 	}
+
+	return token, nil
+}
+
+// ReadTokenFile reads the token from the file, trimming whitespaces and newlines around it.
+// The content is never included into errors, so the token doesn't leak into logs
+func ReadTokenFile(filename string) (string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to read token file %s: %w", filename, err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", filename)
+	}
+
+	return token, nil
+}
+
+// ReadPasswordFile reads crypto passwords from the file, one value of -passwd per line.
+// Empty lines are skipped. Like for the token file, the content is never included into errors
+func ReadPasswordFile(filename string) ([]string, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read password file %s: %w", filename, err)
+	}
+
+	var passwords []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			passwords = append(passwords, line)
+		}
+	}
+	if len(passwords) == 0 {
+		return nil, fmt.Errorf("password file %s is empty", filename)
+	}
+
+	return passwords, nil
+}
+
+// keyValueListFlag defines a repeatable key=value flag
+func keyValueListFlag(name string, usage string) *KeyValueList {
+	list := &KeyValueList{}
+	flag.Var(list, name, usage)
+	return list
+}
+
+// passwordListFlag defines a repeatable password flag
+func passwordListFlag(name string, usage string) *PasswordList {
+	list := &PasswordList{}
+	flag.Var(list, name, usage)
+	return list
 }
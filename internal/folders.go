@@ -0,0 +1,204 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"path"
+	"strings"
+	"time"
+)
+
+// FolderResolver finds folder ids by their paths relative to the root folder, optionally creating
+// missing folders on the way. Resolved ids are remembered, so each folder is looked up only once
+type FolderResolver struct {
+	token   string
+	disk    string
+	create  bool
+	folders map[string]string
+}
+
+// NewFolderResolver creates the resolver for paths relative to the root folder (disk root if it is empty)
+func NewFolderResolver(token string, disk string, root string, create bool) *FolderResolver {
+	return &FolderResolver{token: token, disk: disk, create: create, folders: map[string]string{".": root}}
+}
+
+// Resolve returns the id of the folder by its relative path like "Backups/2024"
+func (r *FolderResolver) Resolve(dir string) (string, error) {
+	dir = path.Clean(strings.Trim(dir, "/"))
+	if dir == "" {
+		dir = "."
+	}
+	if id, ok := r.folders[dir]; ok {
+		return id, nil
+	}
+
+	parent, err := r.Resolve(path.Dir(dir))
+	if err != nil {
+		return "", err
+	}
+
+	name := path.Base(dir)
+	id, err := r.findChild(parent, name)
+	if err != nil {
+		return "", err
+	}
+
+	if id == "" {
+		if !r.create {
+			return "", fmt.Errorf("folder %s doesn't exist", dir)
+		}
+
+		id, err = pkg.CreateFolder(r.token, r.disk, parent, name)
+		if err != nil {
+			return "", fmt.Errorf("failed to create folder %s: %w", dir, err)
+		}
+	}
+
+	r.folders[dir] = id
+	return id, nil
+}
+
+// findChild returns the id of the subfolder with the name or empty string if there is no such folder.
+// Pages of the parent are requested until the subfolder is found or the listing ends
+func (r *FolderResolver) findChild(parent string, name string) (string, error) {
+	id := ""
+	err := pkg.WalkFolderContents(context.Background(), r.token, r.disk, parent, func(_ []*pkg.File, folders []*pkg.Folder) bool {
+		for _, folder := range folders {
+			if folder.Name == name {
+				id = folder.ID
+				return false
+			}
+		}
+		return true
+	})
+
+	return id, err
+}
+
+// IsFolderPath checks if the folder is set by its path (like "/Backups/2024") rather than by its id
+func IsFolderPath(folder string) bool {
+	return strings.HasPrefix(folder, "/")
+}
+
+// ResolveFolder returns the folder id. Folder paths are resolved from the disk root,
+// and missing folders are created if create is true. Folder ids are returned as-is
+func ResolveFolder(config *Config, disk string, folder string, create bool) (string, error) {
+	if !IsFolderPath(folder) {
+		return folder, nil
+	}
+
+	return NewFolderResolver(config.Token, disk, "", create).Resolve(folder)
+}
+
+// ErrAmbiguousName is returned when several files of the folder have the requested name
+var ErrAmbiguousName = errors.New("several files have the same name")
+
+// ResolveFileID returns the file id by its reference. A reference starting with "/" is the file path from the disk root
+// (like /Backups/2024/report.pdf), others are file ids returned as-is. If several files have the same name,
+// the candidates are shown and ErrAmbiguousName is returned, unless -first or -latest flag picks one of them.
+// Both flags together are a usage error
+func ResolveFileID(config *Config, disk string, ref string) (string, error) {
+	if *PickFirst && *PickLatest {
+		SetExitCode(ExitUsage)
+		return "", errors.New("-first and -latest flags can't be used together")
+	}
+	if !IsFolderPath(ref) {
+		return ref, nil
+	}
+
+	dir, name := path.Split(strings.TrimRight(ref, "/"))
+	if name == "" {
+		return "", fmt.Errorf("file name is missing in %q", ref)
+	}
+
+	disk, _, err := DiskIdOrDefault(config, disk)
+	if err != nil {
+		return "", err
+	}
+
+	folder, err := ResolveFolder(config, disk, dir, false)
+	if err != nil {
+		return "", err
+	}
+
+	files, err := pkg.GetAllFolderFiles(config.Token, disk, folder)
+	if err != nil {
+		return "", err
+	}
+
+	var matches []*pkg.File
+	for _, file := range files {
+		if file.Name == name {
+			matches = append(matches, file)
+		}
+	}
+
+	switch {
+	case len(matches) == 0:
+		return "", fmt.Errorf("file %s: %w", ref, pkg.ErrFileNotFound)
+	case len(matches) == 1:
+		return matches[0].ID, nil
+	case *PickFirst:
+		return matches[0].ID, nil
+	case *PickLatest:
+		return latestFile(matches).ID, nil
+	}
+
+	PrintWarning("Files named %s:", ref)
+	for _, file := range matches {
+		PrintWarning("  %s  %s  modified %s", file.ID, ByteCount(int64(file.Size)), time.Unix(int64(file.Date), 0).Format(time.DateTime))
+	}
+
+	return "", fmt.Errorf("%w: %d files are named %s, use the file ID or -first/-latest flag", ErrAmbiguousName, len(matches), ref)
+}
+
+// FindLatestFile returns the most recently modified file of the folder whose name matches the pattern
+// (see MatchName, empty pattern matches all files). The folder is an ID or a path from the disk root.
+// pkg.ErrFileNotFound is returned if no file matches
+func FindLatestFile(config *Config, disk string, folder string, pattern string) (*pkg.File, error) {
+	disk, _, err := DiskIdOrDefault(config, disk)
+	if err != nil {
+		return nil, err
+	}
+
+	folder, err = ResolveFolder(config, disk, folder, false)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := pkg.GetAllFolderFiles(config.Token, disk, folder)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []*pkg.File
+	for _, file := range files {
+		matched, err := MatchName(pattern, file.Name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		if matched {
+			matches = append(matches, file)
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no files match %q: %w", pattern, pkg.ErrFileNotFound)
+	}
+
+	return latestFile(matches), nil
+}
+
+// latestFile returns the most recently modified file of the non-empty list
+func latestFile(files []*pkg.File) *pkg.File {
+	latest := files[0]
+	for _, file := range files[1:] {
+		if file.Date > latest.Date {
+			latest = file
+		}
+	}
+
+	return latest
+}
@@ -0,0 +1,175 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ActionGroup describes a group of flags related to one action. It is used to print the help grouped by actions
+type ActionGroup struct {
+	// Name is the short name of the group shown in the help
+	Name string
+	// Description is a one-line description of what the action does
+	Description string
+	// Example is a usage example; "%s" is replaced with the program name
+	Example string
+	// Prefixes are names of the action flags. Flags named like "prefix" or "prefix.*" belong to the group
+	Prefixes []string
+	// Flags are other flags that belong to the group, but don't share its prefix
+	Flags []string
+}
+
+// actionGroups is the registry of actions in the order they are shown in the help.
+// Flags that don't belong to any group are shown as global ones
+var actionGroups = []*ActionGroup{
+	{
+		Name:        "download",
+		Description: "Download a file by its ID",
+		Example:     "%s -act.download=<file id> -act.download.path=./downloads",
+		Prefixes:    []string{"act.download"},
+	},
+	{
+		Name:        "upload",
+		Description: "Upload a file by its path or from stdin",
+		Example:     "%s -act.upload=./report.pdf -act.upload.folder=<folder id>",
+		Prefixes:    []string{"act.upload"},
+	},
+	{
+		Name:        "files",
+		Description: "List, move, delete, restore and share files",
+		Example:     "%s -act.files=.",
+		Prefixes:    []string{"act.files", "act.trash", "act.shares"},
+	},
+	{
+		Name:        "verify",
+		Description: "Compare a local copy with a file on the server",
+		Example:     "%s -act.verify=<file id> -act.verify.path=./report.pdf",
+		Prefixes:    []string{"act.verify"},
+	},
+	{
+		Name:        "copy",
+		Description: "Copy a file to another disk or folder",
+		Example:     "%s -act.copy=<file id> -act.copy.disk=<disk id>",
+		Prefixes:    []string{"act.copy"},
+	},
+	{
+		Name:        "disks",
+		Description: "List and create disks of the account",
+		Example:     "%s -act.disks.create=Backups -act.disks.create.encrypted",
+		Prefixes:    []string{"act.disks"},
+	},
+	{
+		Name:        "keys",
+		Description: "Export encryption keys of a disk or change its crypto password",
+		Example:     "%s -act.keys=. -act.keys.public=public.pub -act.keys.private=private.asc",
+		Prefixes:    []string{"act.keys"},
+	},
+	{
+		Name:        "api",
+		Description: "Call any API method directly, by its name or alias",
+		Example:     "%s -act.method=me -fields=id,email",
+		Prefixes:    []string{"act.method"},
+		Flags:       []string{"params", "param", "params.sep", "fields", "omit-missing", "pretty"},
+	},
+	{
+		Name:        "ping",
+		Description: "Check if the API is alive and healthy",
+		Example:     "%s -act.ping -act.ping.wait -act.ping.timeout=1m",
+		Prefixes:    []string{"act.ping", "act.health", "act.server-info"},
+	},
+	{
+		Name:        "self-update",
+		Description: "Update the binary to the latest release",
+		Example:     "%s -act.self-update -dry-run",
+		Prefixes:    []string{"act.self-update"},
+	},
+}
+
+// Contains checks if the flag belongs to the group
+func (g *ActionGroup) Contains(name string) bool {
+	for _, prefix := range g.Prefixes {
+		if name == prefix || strings.HasPrefix(name, prefix+".") {
+			return true
+		}
+	}
+
+	for _, flagName := range g.Flags {
+		if name == flagName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findActionGroup returns the group the flag belongs to or nil for global flags
+func findActionGroup(name string) *ActionGroup {
+	for _, group := range actionGroups {
+		if group.Contains(name) {
+			return group
+		}
+	}
+
+	return nil
+}
+
+// PrintUsage prints flags grouped by actions with descriptions and examples.
+// It replaces the flat flag.PrintDefaults output and is used as flag.Usage
+func PrintUsage() {
+	out := flag.CommandLine.Output()
+	program := filepath.Base(os.Args[0])
+
+	grouped := make(map[*ActionGroup][]*flag.Flag)
+	var global []*flag.Flag
+	flag.VisitAll(func(f *flag.Flag) {
+		group := findActionGroup(f.Name)
+		if group == nil {
+			global = append(global, f)
+			return
+		}
+		grouped[group] = append(grouped[group], f)
+	})
+
+	_, _ = fmt.Fprintf(out, "Usage: %s <command> [arguments] [flags]\n\nCommands:\n", program)
+	for _, command := range subcommands {
+		_, _ = fmt.Fprintf(out, "  %-30s %s\n", strings.TrimSpace(command.Name+" "+command.Args), command.Description)
+	}
+
+	_, _ = fmt.Fprintf(out, "\nRun %s <command> -help to see flags of the command. "+
+		"Legacy -act.* flags below are still supported, but deprecated\n\nGlobal flags:\n", program)
+	for _, f := range global {
+		printFlag(out, f)
+	}
+
+	for _, group := range actionGroups {
+		_, _ = fmt.Fprintf(out, "\n%s - %s\n", group.Name, group.Description)
+		_, _ = fmt.Fprintf(out, "  Example: "+group.Example+"\n", program)
+		for _, f := range grouped[group] {
+			printFlag(out, f)
+		}
+	}
+
+	_, _ = fmt.Fprintf(out, "\nAPI method aliases (e.g. %s api files -param disk=<disk id>), raw method names work too:\n", program)
+	printMethodAliases(out)
+}
+
+// printFlag prints a single flag the same way flag.PrintDefaults does
+func printFlag(out io.Writer, f *flag.Flag) {
+	name, usage := flag.UnquoteUsage(f)
+
+	line := "  -" + f.Name
+	if name != "" {
+		line += " " + name
+	}
+	line += "\n    \t" + strings.ReplaceAll(usage, "\n", "\n    \t")
+
+	if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" {
+		line += fmt.Sprintf(" (default %q)", f.DefValue)
+	}
+
+	_, _ = fmt.Fprintln(out, line)
+}
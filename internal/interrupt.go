@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+)
+
+// InterruptContext returns the context cancelled by the interrupt (Ctrl-C), so the transfer in flight stops
+// and the action cleans up its partial output instead of being killed. Only the first interrupt is caught,
+// the next one kills the process as usual, e.g. if the transfer hangs. Call stop when the transfer is done
+func InterruptContext() (ctx context.Context, stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-signals:
+			signal.Stop(signals)
+			PrintWarning("Interrupted, stopping (interrupt again to exit immediately)")
+			cancel()
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+			cancel()
+		})
+	}
+}
+
+// isInterrupted checks if the action failed because the context is cancelled by the interrupt.
+// The exit code is set to ExitInterrupted then
+func isInterrupted(ctx context.Context) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+
+	SetExitCode(ExitInterrupted)
+	return true
+}
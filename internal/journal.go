@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// journalEntry is a line of the batch journal: the item completed successfully
+type journalEntry struct {
+	Item string `json:"item"`
+}
+
+// BatchJournal records completed items of a batch, so the batch interrupted by a crash or a kill
+// can be resumed without redoing them. Journals are JSON lines files in BatchJournalDir named by the batch key
+type BatchJournal struct {
+	path      string
+	file      *os.File
+	completed map[string]bool
+}
+
+// BatchJournalDir returns the directory with journals of batches: "ktcloud/batches" in the user cache directory
+func BatchJournalDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "ktcloud", "batches"), nil
+}
+
+// BatchKey identifies the batch by the action and its arguments, so only the same batch is resumed
+func BatchKey(action string, args ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(append([]string{action}, args...), "\x00")))
+	return action + "-" + hex.EncodeToString(hash[:8])
+}
+
+// OpenBatchJournal opens the journal of the batch. With resume, items completed by the previous run are loaded,
+// otherwise the previous journal is discarded and the batch starts over
+func OpenBatchJournal(key string, resume bool) (*BatchJournal, error) {
+	dir, err := BatchJournalDir()
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	journal := &BatchJournal{path: filepath.Join(dir, key+".jsonl"), completed: make(map[string]bool)}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	if resume {
+		if err = journal.load(); err != nil {
+			return nil, err
+		}
+	} else {
+		flags |= os.O_TRUNC
+	}
+
+	journal.file, err = os.OpenFile(journal.path, flags, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return journal, nil
+}
+
+// load reads the completed items. A missing journal means there is nothing to resume.
+// The last line may be cut by the crash, so lines that can't be parsed are ignored
+func (j *BatchJournal) load() error {
+	file, err := os.Open(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry journalEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			j.completed[entry.Item] = true
+		}
+	}
+
+	return scanner.Err()
+}
+
+// Path returns the path of the journal file
+func (j *BatchJournal) Path() string {
+	return j.path
+}
+
+// Completed returns the number of items completed by the previous run
+func (j *BatchJournal) Completed() int {
+	return len(j.completed)
+}
+
+// IsCompleted checks if the item was completed by the previous run
+func (j *BatchJournal) IsCompleted(item string) bool {
+	return j.completed[item]
+}
+
+// Record appends the completed item to the journal. Each item is written at once,
+// so the journal is up to date whenever the process dies
+func (j *BatchJournal) Record(item string) error {
+	line, err := json.Marshal(&journalEntry{Item: item})
+	if err != nil {
+		return err
+	}
+
+	_, err = j.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the journal. The journal of the fully successful batch is removed, there is nothing to resume
+func (j *BatchJournal) Close(success bool) error {
+	err := j.file.Close()
+	if success {
+		if removeErr := os.Remove(j.path); removeErr != nil && !errors.Is(removeErr, os.ErrNotExist) {
+			return removeErr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,102 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"os"
+	"strings"
+	"time"
+)
+
+// Log formats of -log-format flag
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// logFormat is the singleton with the format of messages, warnings and errors
+var logFormat = LogFormatText
+
+// SetLogFormat sets the format of messages. In JSON format every message, warning and error is printed to stderr
+// as a JSON line with the time, the level, the message and the fields, for log aggregators
+func SetLogFormat(format string) error {
+	switch format {
+	case LogFormatText, LogFormatJSON:
+	default:
+		return fmt.Errorf("unknown -log-format value %q (text or json)", format)
+	}
+
+	logFormat = format
+	return nil
+}
+
+// isJSONLog checks if messages are printed as JSON lines
+func isJSONLog() bool {
+	return logFormat == LogFormatJSON
+}
+
+// secretValues are the values never printed in JSON logs, like the token (see RegisterSecret)
+var secretValues []string
+
+// RegisterSecret adds the value to the secrets redacted from JSON logs. Empty values are ignored
+func RegisterSecret(value string) {
+	if value != "" {
+		secretValues = append(secretValues, value)
+	}
+}
+
+// redactedValue replaces secrets in JSON logs
+const redactedValue = "[REDACTED]"
+
+// redactSecrets replaces known secrets (the token and the passwords) in the text
+func redactSecrets(text string) string {
+	secrets := append([]string{*Auth, Passwd.Default()}, secretValues...)
+	for _, password := range Passwd.DiskPasswords() {
+		secrets = append(secrets, password)
+	}
+
+	for _, secret := range secrets {
+		if secret != "" && secret != "-" {
+			text = strings.ReplaceAll(text, secret, redactedValue)
+		}
+	}
+
+	return text
+}
+
+// isSecretField checks if the field may hold a secret by its name
+func isSecretField(name string) bool {
+	name = strings.ToLower(name)
+	return strings.Contains(name, "token") || strings.Contains(name, "passw") || strings.Contains(name, "secret")
+}
+
+// printLogLine prints the message with its level and fields as a JSON line to stderr. Secrets are redacted
+// both in the message and in the fields
+func printLogLine(level string, text string, fields pkg.Fields) {
+	line := map[string]interface{}{}
+	for name, value := range fields {
+		if isSecretField(name) {
+			value = redactedValue
+		} else if str, ok := value.(string); ok {
+			value = redactSecrets(str)
+		}
+		line[name] = value
+	}
+	line["time"] = time.Now().Format(time.RFC3339)
+	line["level"] = level
+	line["message"] = redactSecrets(text)
+
+	data, _ := json.Marshal(line)
+	_, _ = fmt.Fprintln(os.Stderr, string(data))
+}
+
+// PrintWithFields prints the message like Print. In JSON log format, the fields are added to the JSON line
+func PrintWithFields(fields pkg.Fields, content string, params ...interface{}) {
+	if isJSONLog() {
+		printLogLine("info", fmt.Sprintf(content, params...), fields)
+		return
+	}
+
+	Print(content, params...)
+}
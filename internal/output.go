@@ -1,10 +1,20 @@
 package internal
 
 import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"github.com/fatih/color"
 	"github.com/kt-soft-dev/kt-cli/pkg"
+	"github.com/rodaine/table"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 const (
@@ -14,8 +24,57 @@ const (
 	ModePlain
 	// ModeNoNewline is printing like plain but without a newline
 	ModeNoNewline
+	// ModeJSON is printing data as JSON to stdout, and messages as JSON lines to stderr,
+	// so stdout contains only machine-readable results
+	ModeJSON
 )
 
+// printModeNames are the names of print modes accepted by -output flag in addition to numbers
+var printModeNames = map[string]int{
+	"log":       ModeLog,
+	"plain":     ModePlain,
+	"nonewline": ModeNoNewline,
+	"json":      ModeJSON,
+}
+
+// printModeValue is the flag value for print mode. It accepts both numbers and names of modes
+type printModeValue int
+
+func (v *printModeValue) String() string {
+	if v == nil {
+		return "0"
+	}
+
+	return strconv.Itoa(int(*v))
+}
+
+func (v *printModeValue) Set(value string) error {
+	if mode, ok := printModeNames[strings.ToLower(value)]; ok {
+		*v = printModeValue(mode)
+		return nil
+	}
+
+	mode, err := strconv.Atoi(value)
+	if err != nil || mode < ModeLog || mode > ModeJSON {
+		return fmt.Errorf("unknown output mode %q", value)
+	}
+
+	*v = printModeValue(mode)
+	return nil
+}
+
+// printModeFlag defines the flag for print mode and returns the pointer to the chosen mode
+func printModeFlag(name string, value int, usage string) *int {
+	mode := value
+	flag.Var((*printModeValue)(&mode), name, usage)
+	return &mode
+}
+
+// IsJSONMode checks if the results should be printed as JSON
+func IsJSONMode() bool {
+	return printMode == ModeJSON
+}
+
 // printMode is the singleton represents current way of printing messages
 var printMode = ModeLog
 
@@ -24,36 +83,379 @@ var printMode = ModeLog
 func SetPrintMode(mode int) {
 	printMode = mode
 	pkg.SetLogger(Print)
+	pkg.SetFieldsLogger(PrintWithFields)
+}
+
+// messageWriter receives messages printed in plain modes. It is stdout by default,
+// and stderr when stdout is reserved for the content (see ReserveStdout)
+var messageWriter io.Writer = os.Stdout
+
+// ReserveStdout moves messages and other decorations to stderr, so stdout carries only the raw content
+// of the action (like a downloaded file) and can be safely piped
+func ReserveStdout() {
+	messageWriter = os.Stderr
+}
+
+// isStdoutReserved checks if stdout is reserved for the content by ReserveStdout
+func isStdoutReserved() bool {
+	return messageWriter != io.Writer(os.Stdout)
 }
 
 // Print prints the content with optional parameters in the way defined by printMode
 func Print(content string, params ...interface{}) {
 	text := fmt.Sprintf(content, params...)
+	if isJSONLog() {
+		printLogLine("info", text, nil)
+		return
+	}
 
 	switch printMode {
 	case ModePlain:
-		fmt.Println(text)
+		_, _ = fmt.Fprintln(messageWriter, text)
 	case ModeNoNewline:
-		fmt.Print(text)
+		_, _ = fmt.Fprint(messageWriter, text)
+	case ModeJSON:
+		printJSONMessage(os.Stderr, "message", text)
 	default:
 		log.Println(text)
 	}
 }
 
+// printJSONMessage prints the message as a JSON line with the key
+func printJSONMessage(writer io.Writer, key string, text string) {
+	data, _ := json.Marshal(map[string]string{key: text})
+	_, _ = fmt.Fprintln(writer, string(data))
+}
+
+// resultWriter receives results of actions (API responses, tables, JSON data), but not messages.
+// It is stdout by default, and the output file if -out flag is set
+var resultWriter io.Writer = os.Stdout
+
+// OpenResultFile makes results to be written to the file instead of stdout, creating its parent directories.
+// The returned closer must be called to flush the file and restore stdout
+func OpenResultFile(filename string) (io.Closer, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", filename, err)
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", filename, err)
+	}
+
+	resultWriter = file
+	return resultCloser{file}, nil
+}
+
+// resultCloser restores stdout as the result writer and closes the result file
+type resultCloser struct {
+	file *os.File
+}
+
+func (c resultCloser) Close() error {
+	resultWriter = os.Stdout
+	if err := c.file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", c.file.Name(), err)
+	}
+
+	return nil
+}
+
+// isResultRedirected checks if results go to the output file
+func isResultRedirected() bool {
+	return resultWriter != io.Writer(os.Stdout)
+}
+
+// writeResult writes the text to the result writer and reports failures
+func writeResult(text string) {
+	if _, err := fmt.Fprintln(resultWriter, text); err != nil {
+		PrintError("Failed to write result: %v", err)
+		SetExitCode(ExitFailure)
+	}
+}
+
+// PrintResult prints the text result of an action. It is printed like any other message,
+// unless results are redirected to the output file, where it is written as-is
+func PrintResult(text string) {
+	if isResultRedirected() {
+		writeResult(text)
+		return
+	}
+
+	Print(text)
+}
+
+// PrintJSON prints the data as JSON to stdout (or the output file) as-is, without timestamps or any other decorations
+func PrintJSON(data interface{}) {
+	var jsonData []byte
+	var err error
+	if *Pretty {
+		jsonData, err = json.MarshalIndent(data, "", "    ")
+	} else {
+		jsonData, err = json.Marshal(data)
+	}
+	if err != nil {
+		PrintError("Failed to encode result: %v", err)
+		return
+	}
+
+	writeResult(string(jsonData))
+}
+
 // errorLogger is the singleton for logging errors
 var errorLogger = log.New(os.Stderr, "[ERROR] ", log.LstdFlags|log.Lmsgprefix)
 
+// warningLogger is the singleton for logging warnings
+var warningLogger = log.New(os.Stderr, "[WARN] ", log.LstdFlags|log.Lmsgprefix)
+
+// PrintWarning prints the warning to stderr, so it doesn't mix with results even in plain modes
+func PrintWarning(warning string, params ...interface{}) {
+	text := fmt.Sprintf(warning, params...)
+	if isJSONLog() {
+		printLogLine("warning", text, nil)
+		return
+	}
+
+	switch printMode {
+	case ModePlain:
+		_, _ = fmt.Fprintln(os.Stderr, text)
+	case ModeNoNewline:
+		_, _ = fmt.Fprint(os.Stderr, text)
+	case ModeJSON:
+		printJSONMessage(os.Stderr, "warning", text)
+	default:
+		warningLogger.Println(text)
+	}
+}
+
+// jsonError is the error printed to stderr in JSON mode. Code is the API error code, or 0 for other errors
+type jsonError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
 // PrintError prints the error message with optional parameters in the way defined by printMode
-// It's a wrapper around fmt.Print that respects printMode
+// It's a wrapper around fmt.Print that respects printMode. The program finishes with a failure exit code after it.
+// In JSON mode the code of pkg.ApiError from params is printed along with the message
 func PrintError(err string, params ...interface{}) {
 	text := fmt.Sprintf(err, params...)
+	if ExitCode() == ExitSuccess {
+		SetExitCode(ExitFailure)
+	}
+	if isJSONLog() {
+		var fields pkg.Fields
+		if code := apiErrorCode(params); code != 0 {
+			fields = pkg.Fields{"code": code}
+		}
+		printLogLine("error", text, fields)
+		return
+	}
 
 	switch printMode {
 	case ModePlain:
 		_, _ = fmt.Fprintln(os.Stderr, text)
 	case ModeNoNewline:
 		_, _ = fmt.Fprint(os.Stderr, text)
+	case ModeJSON:
+		data, _ := json.Marshal(map[string]jsonError{"error": {Code: apiErrorCode(params), Message: text}})
+		_, _ = fmt.Fprintln(os.Stderr, string(data))
 	default:
 		errorLogger.Println(text)
 	}
 }
+
+// apiErrorCode returns the code of the first pkg.ApiError found in params, or 0 if there is no such error
+func apiErrorCode(params []interface{}) int {
+	for _, param := range params {
+		err, ok := param.(error)
+		if !ok {
+			continue
+		}
+
+		var apiErr *pkg.ApiError
+		if errors.As(err, &apiErr) {
+			return apiErr.Code
+		}
+	}
+
+	return 0
+}
+
+// PrintFiles prints the list of files as a table, or as a JSON array in JSON mode.
+// Empty list is a valid result, so it is reported as a neutral message rather than an error
+func PrintFiles(list []*pkg.File) {
+	if IsJSONMode() {
+		if list == nil {
+			list = []*pkg.File{}
+		}
+		PrintJSON(list)
+		return
+	}
+
+	if len(list) == 0 {
+		Print("No files")
+		return
+	}
+
+	PrintFilesTable(list)
+}
+
+// FilesSummary is the footer of a files list: the number of entries and the total size of the files
+type FilesSummary struct {
+	Files     int   `json:"files"`
+	Folders   int   `json:"folders"`
+	TotalSize int64 `json:"total_size"`
+}
+
+// FilesListing is the files list with its summary, printed in JSON mode
+type FilesListing struct {
+	Items   []*pkg.File  `json:"items"`
+	Summary FilesSummary `json:"summary"`
+}
+
+// SummarizeFiles counts files and folders of the list and sums the sizes of the files
+func SummarizeFiles(list []*pkg.File) FilesSummary {
+	var summary FilesSummary
+	for _, fileInfo := range list {
+		if fileInfo.Type == folderTypeName {
+			summary.Folders++
+			continue
+		}
+		summary.Files++
+		summary.TotalSize += int64(fileInfo.Size)
+	}
+
+	return summary
+}
+
+// PrintFilesListing prints the list like PrintFiles, followed by the summary footer.
+// In JSON mode, the list and the summary are printed as a single FilesListing object
+func PrintFilesListing(list []*pkg.File) {
+	summary := SummarizeFiles(list)
+	if IsJSONMode() {
+		if list == nil {
+			list = []*pkg.File{}
+		}
+		PrintJSON(&FilesListing{Items: list, Summary: summary})
+		return
+	}
+
+	PrintFiles(list)
+	if len(list) == 0 {
+		return
+	}
+
+	footer := fmt.Sprintf("%d files, total %s", summary.Files, ByteCount(summary.TotalSize))
+	if summary.Folders > 0 {
+		footer = fmt.Sprintf("%d folders, %s", summary.Folders, footer)
+	}
+	Print("%s", footer)
+}
+
+// PrintFileIDs prints only IDs of the files, one per line, without any decorations, so they can be piped
+func PrintFileIDs(list []*pkg.File) {
+	for _, fileInfo := range list {
+		writeResult(fileInfo.ID)
+	}
+}
+
+// NewTable creates a table with the standard formatting of the client
+func NewTable(columns ...interface{}) table.Table {
+	headerFmt := colorFor(resultWriter, color.New(color.FgGreen, color.Underline)).SprintfFunc()
+	columnFmt := colorFor(resultWriter, color.New(color.FgYellow)).SprintfFunc()
+
+	tbl := table.New(columns...)
+	tbl.WithHeaderFormatter(headerFmt).WithFirstColumnFormatter(columnFmt).WithWriter(resultWriter)
+	return tbl
+}
+
+// PrintFilesTable prints the list of files as a table. It is the standard way to show files to the user
+func PrintFilesTable(list []*pkg.File) {
+	tbl := NewTable("ID", "Name", "Type", "Size")
+
+	for _, fileInfo := range list {
+		tbl.AddRow(fileInfo.ID, fileInfo.Name, fileInfo.TypeDesc, ByteCount(int64(fileInfo.Size)))
+	}
+
+	tbl.Print()
+}
+
+// StartTrace opens the trace file and makes the library write API exchange to it.
+// The returned closer stops tracing and closes the file
+func StartTrace(filename string) (io.Closer, error) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg.SetTraceWriter(file)
+	return traceCloser{file}, nil
+}
+
+// traceCloser disables tracing before closing the trace file
+type traceCloser struct {
+	file *os.File
+}
+
+func (c traceCloser) Close() error {
+	pkg.SetTraceWriter(nil)
+	return c.file.Close()
+}
+
+// filesCSVHeader is the header row of files lists saved as CSV
+var filesCSVHeader = []string{"id", "name", "type", "mime", "size", "date", "folder", "disk", "encrypted"}
+
+// SaveFilesList saves the list of files to the file as JSON or CSV. Empty format is detected by the file extension
+// (.csv for CSV, JSON otherwise). It doesn't touch stdout, so it can be used along with printing the list
+func SaveFilesList(filename string, format string, list []*pkg.File) error {
+	if format == "" {
+		format = "json"
+		if strings.EqualFold(filepath.Ext(filename), ".csv") {
+			format = "csv"
+		}
+	}
+	if format != "json" && format != "csv" {
+		return fmt.Errorf("unknown files list format %q (json and csv are supported)", format)
+	}
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", filename, err)
+	}
+	defer file.Close()
+
+	if format == "json" {
+		if list == nil {
+			list = []*pkg.File{}
+		}
+		err = json.NewEncoder(file).Encode(list)
+	} else {
+		err = writeFilesCSV(file, list)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+
+	return file.Close()
+}
+
+// writeFilesCSV writes the list of files as CSV with the header row
+func writeFilesCSV(writer io.Writer, list []*pkg.File) error {
+	csvWriter := csv.NewWriter(writer)
+	if err := csvWriter.Write(filesCSVHeader); err != nil {
+		return err
+	}
+
+	for _, file := range list {
+		err := csvWriter.Write([]string{
+			file.ID, file.Name, file.Type, file.Mime, strconv.Itoa(file.Size), strconv.Itoa(file.Date),
+			file.Folder, file.Disk, strconv.FormatBool(file.Encrypted),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
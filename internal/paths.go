@@ -0,0 +1,246 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ValidateSavePath checks the save path before downloading, so the user doesn't wait for the whole download
+// just to find out that the file can't be saved. It returns the cleaned path
+func ValidateSavePath(savePath string) (string, error) {
+	savePath = strings.TrimSpace(savePath)
+	if savePath == "" {
+		return "", errors.New("save path is required")
+	}
+
+	isDir := strings.HasSuffix(savePath, "/") || strings.HasSuffix(savePath, string(os.PathSeparator))
+	savePath = filepath.Clean(savePath)
+
+	_, err := os.Stat(savePath)
+	if err == nil {
+		return savePath, nil
+	}
+	if isDir {
+		return "", fmt.Errorf("directory %s doesn't exist", savePath)
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	// The file doesn't exist yet, but its directory must
+	parentInfo, err := os.Stat(filepath.Dir(savePath))
+	if err != nil || !parentInfo.IsDir() {
+		return "", fmt.Errorf("directory %s doesn't exist", filepath.Dir(savePath))
+	}
+
+	return savePath, nil
+}
+
+// ResolveSavePath returns the path to save the file with the provided name to.
+// If the save path is a directory, the file is saved into it with the name, otherwise the save path is used as-is.
+// The name usually comes from the server, so it is sanitized first
+func ResolveSavePath(savePath string, name string) (string, error) {
+	pathInfo, err := os.Stat(savePath)
+	if err != nil || !pathInfo.IsDir() {
+		return savePath, nil
+	}
+
+	safeName, err := SanitizeFileName(name)
+	if err != nil {
+		return "", err
+	}
+	if !*DownloadRawNames {
+		if escaped := EscapeFileName(safeName); escaped != safeName {
+			Print("File name %q is changed to %q to be valid on this system", safeName, escaped)
+			safeName = escaped
+		}
+	}
+
+	target := filepath.Join(savePath, safeName)
+	if !isInsideDir(savePath, target) {
+		return "", fmt.Errorf("file name %q points outside of %s", name, savePath)
+	}
+
+	return target, nil
+}
+
+// SanitizeFileName turns the name into a plain file name without any path components.
+// The name usually comes from the server, so a malicious or buggy one must not be able to point outside
+// the target directory: absolute paths are rejected, and directories are stripped from relative ones.
+// Both kinds of separators are handled regardless of the OS, because the name may come from any system
+func SanitizeFileName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if filepath.IsAbs(name) || strings.HasPrefix(name, "/") || strings.HasPrefix(name, `\`) || hasDriveLetter(name) {
+		return "", fmt.Errorf("file name %q is an absolute path", name)
+	}
+
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "" || name == "." || name == ".." || name == "/" {
+		return "", fmt.Errorf("invalid file name %q", name)
+	}
+
+	return name, nil
+}
+
+// windowsIllegalChars are the characters not allowed in file names on Windows
+const windowsIllegalChars = `<>:"|?*`
+
+// windowsReservedNames are the device names which can't be used as file names on Windows, with any extension
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// EscapeFileName makes the plain file name (see SanitizeFileName) valid on the host OS.
+// Invalid UTF-8 sequences and control characters are replaced with "_" everywhere. On Windows, the characters
+// illegal there are replaced too, trailing dots and spaces are removed and reserved device names get "_" prefix
+func EscapeFileName(name string) string {
+	return escapeFileName(name, runtime.GOOS)
+}
+
+// escapeFileName escapes the name for the OS like EscapeFileName
+func escapeFileName(name string, goos string) string {
+	name = strings.ToValidUTF8(name, "_")
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || (goos == "windows" && strings.ContainsRune(windowsIllegalChars, r)) {
+			return '_'
+		}
+		return r
+	}, name)
+
+	if goos != "windows" {
+		return name
+	}
+
+	name = strings.TrimRight(name, ". ")
+	if name == "" {
+		return "_"
+	}
+
+	base := strings.ToUpper(strings.TrimSpace(strings.SplitN(name, ".", 2)[0]))
+	if windowsReservedNames[base] {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// isInsideDir checks that the target path doesn't escape the directory
+func isInsideDir(dir string, target string) bool {
+	rel, err := filepath.Rel(dir, target)
+	if err != nil {
+		return false
+	}
+
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator)) && !filepath.IsAbs(rel)
+}
+
+// hasDriveLetter checks if the name starts with a Windows drive like "C:", which is checked on every OS
+func hasDriveLetter(name string) bool {
+	if len(name) < 2 || name[1] != ':' {
+		return false
+	}
+
+	letter := name[0] | 0x20
+	return letter >= 'a' && letter <= 'z'
+}
+
+// ParseFileMode parses the file permissions in octal format like "0644" or "600"
+func ParseFileMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(strings.TrimSpace(value), 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid file mode %q, expected octal permissions like 0644", value)
+	}
+
+	return os.FileMode(mode), nil
+}
+
+// CreateFileWithMode creates or truncates the file and sets exactly the provided permissions.
+// Unlike os.Create, the result doesn't depend on umask, and permissions of an existing file are changed too
+func CreateFileWithMode(filename string, mode os.FileMode) (*os.File, error) {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = file.Chmod(mode); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// preferredExtensions are extensions for MIME types with several common extensions
+var preferredExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"text/plain":      ".txt",
+	"text/html":       ".html",
+	"video/mpeg":      ".mpeg",
+	"audio/mpeg":      ".mp3",
+	"application/xml": ".xml",
+}
+
+// HasKnownExtension checks if the name has an extension of a known MIME type
+func HasKnownExtension(name string) bool {
+	ext := filepath.Ext(name)
+	return ext != "" && mime.TypeByExtension(ext) != ""
+}
+
+// DefaultFileName is the name for files without a name on the server: "file-<id>" with the extension
+// of the MIME type, if it is known
+func DefaultFileName(fileId string, mimeType string) string {
+	return AddExtensionByMime("file-"+fileId, mimeType)
+}
+
+// DetectFileMime detects the MIME type of the file by its first bytes. Empty type is returned if the file can't be read
+func DetectFileMime(path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return ""
+	}
+
+	return http.DetectContentType(head[:n])
+}
+
+// AddExtensionByMime appends the extension of the MIME type to the name if it has no known extension.
+// The name is returned as-is if the MIME type is unknown
+func AddExtensionByMime(name string, mimeType string) string {
+	if HasKnownExtension(name) {
+		return name
+	}
+
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return name
+	}
+
+	ext, ok := preferredExtensions[mediaType]
+	if !ok {
+		extensions, err := mime.ExtensionsByType(mediaType)
+		if err != nil || len(extensions) == 0 {
+			return name
+		}
+		ext = extensions[0]
+	}
+
+	return name + ext
+}
@@ -0,0 +1,321 @@
+package internal
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestValidateSavePath(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "existing.txt")
+	if err := os.WriteFile(existing, []byte("content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{name: "existing directory", path: dir, want: dir},
+		{name: "existing directory with slash", path: dir + "/", want: dir},
+		{name: "existing file", path: existing, want: existing},
+		{name: "new file in existing directory", path: filepath.Join(dir, "new.txt"), want: filepath.Join(dir, "new.txt")},
+		{name: "path is cleaned", path: "  " + dir + "/sub/../new.txt ", want: filepath.Join(dir, "new.txt")},
+		{name: "empty path", path: " ", wantErr: true},
+		{name: "missing directory", path: filepath.Join(dir, "missing") + "/", wantErr: true},
+		{name: "file in missing directory", path: filepath.Join(dir, "missing", "new.txt"), wantErr: true},
+		{name: "file under a file", path: filepath.Join(existing, "new.txt"), wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ValidateSavePath(test.path)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("ValidateSavePath(%q) = %q, want an error", test.path, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ValidateSavePath(%q) failed: %v", test.path, err)
+			}
+			if got != test.want {
+				t.Errorf("ValidateSavePath(%q) = %q, want %q", test.path, got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveSavePath(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "target.txt")
+
+	tests := []struct {
+		name     string
+		savePath string
+		fileName string
+		want     string
+		wantErr  bool
+	}{
+		{name: "directory gets the file name", savePath: dir, fileName: "report.pdf", want: filepath.Join(dir, "report.pdf")},
+		{name: "file path is used as-is", savePath: file, fileName: "report.pdf", want: file},
+		{name: "directories of the name are stripped", savePath: dir, fileName: "../../etc/passwd", want: filepath.Join(dir, "passwd")},
+		{name: "absolute name is rejected", savePath: dir, fileName: "/etc/passwd", wantErr: true},
+		{name: "dot name is rejected", savePath: dir, fileName: "..", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ResolveSavePath(test.savePath, test.fileName)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("ResolveSavePath(%q, %q) = %q, want an error", test.savePath, test.fileName, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveSavePath(%q, %q) failed: %v", test.savePath, test.fileName, err)
+			}
+			if got != test.want {
+				t.Errorf("ResolveSavePath(%q, %q) = %q, want %q", test.savePath, test.fileName, got, test.want)
+			}
+		})
+	}
+}
+
+func TestSanitizeFileName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{name: "report.pdf", want: "report.pdf"},
+		{name: "  spaced.txt  ", want: "spaced.txt"},
+		{name: "dir/report.pdf", want: "report.pdf"},
+		{name: "../../etc/passwd", want: "passwd"},
+		{name: `..\..\windows\win.ini`, want: "win.ini"},
+		{name: "/etc/passwd", wantErr: true},
+		{name: `\\server\share\file`, wantErr: true},
+		{name: `C:\Windows\win.ini`, wantErr: true},
+		{name: "c:file", wantErr: true},
+		{name: "", wantErr: true},
+		{name: ".", wantErr: true},
+		{name: "..", wantErr: true},
+		{name: "dir/..", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := SanitizeFileName(test.name)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("SanitizeFileName(%q) = %q, want an error", test.name, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SanitizeFileName(%q) failed: %v", test.name, err)
+			}
+			if got != test.want {
+				t.Errorf("SanitizeFileName(%q) = %q, want %q", test.name, got, test.want)
+			}
+		})
+	}
+}
+
+func TestIsInsideDir(t *testing.T) {
+	dir := filepath.Join("base", "dir")
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{target: filepath.Join(dir, "file.txt"), want: true},
+		{target: filepath.Join(dir, "sub", "file.txt"), want: true},
+		{target: filepath.Join(dir, "..", "file.txt"), want: false},
+		{target: filepath.Join("base", "dir2", "file.txt"), want: false},
+		{target: filepath.Join(dir, "..file.txt"), want: true},
+	}
+
+	for _, test := range tests {
+		if got := isInsideDir(dir, test.target); got != test.want {
+			t.Errorf("isInsideDir(%q, %q) = %v, want %v", dir, test.target, got, test.want)
+		}
+	}
+}
+
+func TestParseFileMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    os.FileMode
+		wantErr bool
+	}{
+		{value: "0644", want: 0644},
+		{value: "600", want: 0600},
+		{value: " 0400 ", want: 0400},
+		{value: "0777", want: 0777},
+		{value: "0", want: 0},
+		{value: "1777", wantErr: true},
+		{value: "0800", wantErr: true},
+		{value: "rw-r--r--", wantErr: true},
+		{value: "", wantErr: true},
+		{value: "-644", wantErr: true},
+	}
+
+	for _, test := range tests {
+		got, err := ParseFileMode(test.value)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseFileMode(%q) = %o, want an error", test.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseFileMode(%q) failed: %v", test.value, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseFileMode(%q) = %o, want %o", test.value, got, test.want)
+		}
+	}
+}
+
+func TestCreateFileWithMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("permissions are not supported on Windows")
+	}
+
+	tests := []struct {
+		name     string
+		existing bool
+		mode     os.FileMode
+	}{
+		{name: "new private file", mode: 0600},
+		{name: "new file ignoring umask", mode: 0666},
+		{name: "existing file gets the mode", existing: true, mode: 0640},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "file.txt")
+			if test.existing {
+				if err := os.WriteFile(filename, []byte("old content"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			file, err := CreateFileWithMode(filename, test.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = file.Close()
+
+			info, err := os.Stat(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != test.mode {
+				t.Errorf("mode is %o, want %o", info.Mode().Perm(), test.mode)
+			}
+			if info.Size() != 0 {
+				t.Errorf("file is not truncated, size is %d", info.Size())
+			}
+		})
+	}
+}
+
+func TestDefaultFileName(t *testing.T) {
+	tests := []struct {
+		fileId   string
+		mimeType string
+		want     string
+	}{
+		{fileId: "abc", mimeType: "", want: "file-abc"},
+		{fileId: "abc", mimeType: "image/jpeg", want: "file-abc.jpg"},
+		{fileId: "abc", mimeType: "text/plain; charset=utf-8", want: "file-abc.txt"},
+		{fileId: "abc", mimeType: "application/pdf", want: "file-abc.pdf"},
+		{fileId: "abc", mimeType: "application/x-unknown-type", want: "file-abc"},
+		{fileId: "abc", mimeType: "not a mime type", want: "file-abc"},
+	}
+
+	for _, test := range tests {
+		if got := DefaultFileName(test.fileId, test.mimeType); got != test.want {
+			t.Errorf("DefaultFileName(%q, %q) = %q, want %q", test.fileId, test.mimeType, got, test.want)
+		}
+	}
+}
+
+func TestAddExtensionByMime(t *testing.T) {
+	tests := []struct {
+		name     string
+		mimeType string
+		want     string
+	}{
+		{name: "photo", mimeType: "image/jpeg", want: "photo.jpg"},
+		{name: "photo.jpeg", mimeType: "image/jpeg", want: "photo.jpeg"},
+		{name: "photo.png", mimeType: "image/jpeg", want: "photo.png"},
+		{name: "report.v2", mimeType: "application/pdf", want: "report.v2.pdf"},
+		{name: "page", mimeType: "text/html; charset=utf-8", want: "page.html"},
+		{name: "data", mimeType: "", want: "data"},
+	}
+
+	for _, test := range tests {
+		if got := AddExtensionByMime(test.name, test.mimeType); got != test.want {
+			t.Errorf("AddExtensionByMime(%q, %q) = %q, want %q", test.name, test.mimeType, got, test.want)
+		}
+	}
+}
+
+func TestHasKnownExtension(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "report.pdf", want: true},
+		{name: "photo.JPG", want: true},
+		{name: "backup.2024.json", want: true},
+		{name: "noextension", want: false},
+		{name: "version.v2", want: false},
+		{name: ".hidden", want: false},
+	}
+
+	for _, test := range tests {
+		if got := HasKnownExtension(test.name); got != test.want {
+			t.Errorf("HasKnownExtension(%q) = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestEscapeFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		goos string
+		want string
+	}{
+		{name: "report.pdf", goos: "windows", want: "report.pdf"},
+		{name: "a:b<c>d|e.txt", goos: "windows", want: "a_b_c_d_e.txt"},
+		{name: `what?"*.txt`, goos: "windows", want: "what___.txt"},
+		{name: "a:b<c>d|e.txt", goos: "linux", want: "a:b<c>d|e.txt"},
+		{name: "tab\there\x00.txt", goos: "linux", want: "tab_here_.txt"},
+		{name: "bell\x07\x1b[31m.txt", goos: "windows", want: "bell__[31m.txt"},
+		{name: "bad\xff\xfeutf8.txt", goos: "linux", want: "bad_utf8.txt"},
+		{name: "юникод.txt", goos: "windows", want: "юникод.txt"},
+		{name: "trailing. . ", goos: "windows", want: "trailing"},
+		{name: "trailing. ", goos: "linux", want: "trailing. "},
+		{name: "...", goos: "windows", want: "_"},
+		{name: "CON", goos: "windows", want: "_CON"},
+		{name: "nul.txt", goos: "windows", want: "_nul.txt"},
+		{name: "com1.tar.gz", goos: "windows", want: "_com1.tar.gz"},
+		{name: "console.txt", goos: "windows", want: "console.txt"},
+		{name: "CON", goos: "linux", want: "CON"},
+	}
+
+	for _, test := range tests {
+		if got := escapeFileName(test.name, test.goos); got != test.want {
+			t.Errorf("escapeFileName(%q, %q) = %q, want %q", test.name, test.goos, got, test.want)
+		}
+	}
+}
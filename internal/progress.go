@@ -0,0 +1,170 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"github.com/schollz/progressbar/v3"
+	"golang.org/x/crypto/ssh/terminal"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// progressInterval is how often the progress is printed as a line in non-interactive mode
+const progressInterval = 10 * time.Second
+
+// progressLogger prints the line-based progress to stderr, so it never mixes with the content on stdout
+var progressLogger = log.New(os.Stderr, "", log.LstdFlags)
+
+// transferProgress is the state of a single transfer shown to the user
+type transferProgress struct {
+	started time.Time
+	// bar is the redrawn bar, nil in line-based mode
+	bar *progressbar.ProgressBar
+	// printed is the time of the last progress line, zero if no line is printed yet
+	printed time.Time
+}
+
+// progressReporter shows the progress of uploads and downloads on stderr. In a terminal it is a redrawn bar
+// with the percentage and the rate. In non-interactive mode, when stderr is not a terminal and in JSON modes,
+// a line is printed every progressInterval instead, so logs of CI jobs are not spammed
+type progressReporter struct {
+	redraw    bool
+	mutex     sync.Mutex
+	transfers map[string]*transferProgress
+}
+
+// ProgressCallbacks returns the library callbacks which report the progress of transfers.
+// They are empty if the progress is disabled by -no-progress
+func ProgressCallbacks() pkg.Callbacks {
+	if *NoProgress {
+		return pkg.Callbacks{}
+	}
+
+	reporter := &progressReporter{
+		redraw:    !*NotInteractive && !isJSONLog() && !IsJSONMode() && terminal.IsTerminal(int(os.Stderr.Fd())),
+		transfers: make(map[string]*transferProgress),
+	}
+
+	return pkg.Callbacks{
+		OnTransferStart:    reporter.start,
+		OnProgress:         reporter.progress,
+		OnTransferComplete: reporter.complete,
+	}
+}
+
+// transferKey identifies the transfer. The file ID of uploads is known only at the end, so it is not used
+func transferKey(event pkg.TransferEvent) string {
+	return event.Kind + "\x00" + event.Name
+}
+
+func (r *progressReporter) start(event pkg.TransferEvent) {
+	state := &transferProgress{started: time.Now()}
+	if r.redraw {
+		state.bar = progressbar.NewOptions64(event.Total,
+			progressbar.OptionSetWriter(os.Stderr),
+			progressbar.OptionSetDescription(transferVerb(event)+" "+event.Name),
+			progressbar.OptionShowBytes(true),
+			progressbar.OptionShowCount(),
+			progressbar.OptionSetWidth(30),
+			progressbar.OptionThrottle(100*time.Millisecond),
+			progressbar.OptionOnCompletion(func() {
+				_, _ = fmt.Fprintln(os.Stderr)
+			}),
+		)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.transfers[transferKey(event)] = state
+}
+
+func (r *progressReporter) progress(event pkg.TransferEvent, done int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	state := r.transfers[transferKey(event)]
+	if state == nil {
+		return
+	}
+
+	if state.bar != nil {
+		_ = state.bar.Set64(done)
+		return
+	}
+
+	last := state.printed
+	if last.IsZero() {
+		last = state.started
+	}
+	if time.Since(last) >= progressInterval {
+		state.printed = time.Now()
+		printProgressLine(event, done, time.Since(state.started), false)
+	}
+}
+
+func (r *progressReporter) complete(event pkg.TransferEvent, done int64, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	key := transferKey(event)
+	state := r.transfers[key]
+	if state == nil {
+		return
+	}
+	delete(r.transfers, key)
+
+	switch {
+	case state.bar != nil && err == nil:
+		_ = state.bar.Finish()
+	case state.bar != nil:
+		// The error is printed by the action, the bar is removed so it doesn't look complete
+		_ = state.bar.Clear()
+	case !state.printed.IsZero() && err == nil:
+		// Short transfers are not reported at all, long ones end with the summary line
+		printProgressLine(event, done, time.Since(state.started), true)
+	}
+}
+
+// transferVerb describes the transfer for the progress
+func transferVerb(event pkg.TransferEvent) string {
+	if event.Kind == "upload" {
+		return "Uploading"
+	}
+
+	return "Downloading"
+}
+
+// printProgressLine prints the progress of the transfer as a line: the percentage if the total is known,
+// the transferred bytes and the average rate. In JSON log format, the numbers are also added as fields
+func printProgressLine(event pkg.TransferEvent, done int64, elapsed time.Duration, finished bool) {
+	rate := int64(0)
+	if elapsed > 0 {
+		rate = int64(float64(done) / elapsed.Seconds())
+	}
+
+	var text strings.Builder
+	if finished {
+		text.WriteString(strings.TrimSuffix(transferVerb(event), "ing") + "ed")
+	} else {
+		text.WriteString(transferVerb(event))
+	}
+	text.WriteString(" " + event.Name + ": ")
+	if event.Total > 0 && !finished {
+		text.WriteString(fmt.Sprintf("%d%%, %s of %s", done*100/event.Total, ByteCount(done), ByteCount(event.Total)))
+	} else {
+		text.WriteString(ByteCount(done))
+	}
+	text.WriteString(fmt.Sprintf(" (%s/s)", ByteCount(rate)))
+
+	switch {
+	case isJSONLog():
+		printLogLine("info", text.String(), pkg.Fields{"kind": event.Kind, "name": event.Name, "bytes": done, "total": event.Total, "rate": rate})
+	case IsJSONMode():
+		printJSONMessage(os.Stderr, "progress", text.String())
+	default:
+		progressLogger.Println(text.String())
+	}
+}
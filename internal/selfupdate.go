@@ -0,0 +1,243 @@
+package internal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is the version of the build. Release builds set it by the linker flag
+// (-X github.com/kt-soft-dev/kt-cli/internal.Version=v0.3), other builds are "dev"
+var Version = "dev"
+
+// DefaultReleaseURL is the endpoint with the latest release of the CLI
+const DefaultReleaseURL = "https://api.github.com/repos/bssth/kt-cli/releases/latest"
+
+// checksumsAsset is the release asset with SHA-256 checksums of the binaries in the sha256sum format
+const checksumsAsset = "checksums.txt"
+
+// updateClient downloads releases. Binaries are small, so the timeout covers the whole download
+var updateClient = &http.Client{Timeout: 5 * time.Minute}
+
+// Release is the latest release of the CLI
+type Release struct {
+	Version string          `json:"tag_name"`
+	Assets  []*ReleaseAsset `json:"assets"`
+}
+
+// ReleaseAsset is a file attached to the release
+type ReleaseAsset struct {
+	Name string `json:"name"`
+	URL  string `json:"browser_download_url"`
+}
+
+// Asset returns the asset by its name or nil if the release doesn't have it
+func (r *Release) Asset(name string) *ReleaseAsset {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset
+		}
+	}
+
+	return nil
+}
+
+// BinaryAssetName returns the name of the release binary for the OS and architecture, as built by the Taskfile
+func BinaryAssetName(goos string, goarch string) string {
+	name := "ktcloud_" + goos + "_" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+
+	return name
+}
+
+// GetLatestRelease fetches the latest release from the release endpoint
+func GetLatestRelease(releaseUrl string) (*Release, error) {
+	response, err := updateClient.Get(releaseUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to check the latest release: %s", response.Status)
+	}
+
+	var release Release
+	if err = json.NewDecoder(response.Body).Decode(&release); err != nil {
+		return nil, fmt.Errorf("failed to read the latest release: %w", err)
+	}
+	if release.Version == "" {
+		return nil, errors.New("release endpoint doesn't report the version")
+	}
+
+	return &release, nil
+}
+
+// IsNewerVersion checks if the version is newer than the current one. Versions are compared by their numeric
+// parts ("v0.10" is newer than "v0.9"). Development builds are older than any release
+func IsNewerVersion(version string, current string) bool {
+	if current == "dev" {
+		return true
+	}
+
+	latestParts := versionParts(version)
+	currentParts := versionParts(current)
+	for i := 0; i < len(latestParts) || i < len(currentParts); i++ {
+		var latest, cur int
+		if i < len(latestParts) {
+			latest = latestParts[i]
+		}
+		if i < len(currentParts) {
+			cur = currentParts[i]
+		}
+		if latest != cur {
+			return latest > cur
+		}
+	}
+
+	return false
+}
+
+// versionParts splits the version like "v1.2.3" or "1.2.3-rc1" into its numeric parts.
+// Suffixes after the numbers are ignored
+func versionParts(version string) []int {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+ "); i >= 0 {
+		version = version[:i]
+	}
+
+	var parts []int
+	for _, part := range strings.Split(version, ".") {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			break
+		}
+		parts = append(parts, number)
+	}
+
+	return parts
+}
+
+// releaseChecksum returns the expected SHA-256 of the asset from the checksums asset of the release.
+// Updates without a checksum are refused, so a broken or tampered download never replaces the binary
+func releaseChecksum(release *Release, assetName string) (string, error) {
+	asset := release.Asset(checksumsAsset)
+	if asset == nil {
+		return "", fmt.Errorf("release %s has no %s, the download can't be verified", release.Version, checksumsAsset)
+	}
+
+	response, err := updateClient.Get(asset.URL)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download %s: %s", checksumsAsset, response.Status)
+	}
+
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		// Lines are "<hex>  <name>", binary mode names are prefixed with "*"
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == assetName {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("%s has no checksum of %s", checksumsAsset, assetName)
+}
+
+// downloadRelease downloads the asset to a temporary file next to the executable and checks its SHA-256.
+// The file is in the same directory, so it can be renamed over the executable atomically.
+// The caller removes the file if it is not used
+func downloadRelease(asset *ReleaseAsset, checksum string, executable string) (string, error) {
+	info, err := os.Stat(executable)
+	if err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(executable), ".ktcloud-update-*")
+	if err != nil {
+		return "", err
+	}
+	tmpName := tmp.Name()
+
+	err = func() error {
+		defer tmp.Close()
+
+		response, err := updateClient.Get(asset.URL)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+
+		if response.StatusCode != http.StatusOK {
+			return fmt.Errorf("failed to download %s: %s", asset.Name, response.Status)
+		}
+
+		hash := sha256.New()
+		if _, err = io.Copy(io.MultiWriter(tmp, hash), response.Body); err != nil {
+			return err
+		}
+		if sum := hex.EncodeToString(hash.Sum(nil)); sum != checksum {
+			return fmt.Errorf("checksum of %s doesn't match: expected %s, got %s", asset.Name, checksum, sum)
+		}
+
+		return tmp.Chmod(info.Mode().Perm())
+	}()
+	if err != nil {
+		_ = os.Remove(tmpName)
+		return "", err
+	}
+
+	return tmpName, nil
+}
+
+// replaceExecutable puts the new binary in place of the executable. On Windows, the running executable can't be
+// overwritten, but can be renamed, so it is moved aside first and left for the next update to remove
+func replaceExecutable(newBinary string, executable string) error {
+	if runtime.GOOS != "windows" {
+		return os.Rename(newBinary, executable)
+	}
+
+	old := executable + ".old"
+	_ = os.Remove(old)
+	if err := os.Rename(executable, old); err != nil {
+		return err
+	}
+	if err := os.Rename(newBinary, executable); err != nil {
+		// Restore the previous binary, so the command keeps working
+		_ = os.Rename(old, executable)
+		return err
+	}
+
+	return nil
+}
+
+// currentExecutable returns the path of the running binary with symlinks resolved,
+// so the binary itself is replaced and not the link to it
+func currentExecutable() (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.EvalSymlinks(executable)
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// TransferStats is the machine-readable summary of a single upload or download.
+// It is printed as one JSON line, so it can be easily consumed by monitoring tools
+type TransferStats struct {
+	Action     string  `json:"action"`
+	FileID     string  `json:"file_id,omitempty"`
+	Name       string  `json:"name,omitempty"`
+	Bytes      int64   `json:"bytes"`
+	DurationMs int64   `json:"duration_ms"`
+	Throughput float64 `json:"throughput_bps"`
+	Retries    int     `json:"retries"`
+	Ok         bool    `json:"ok"`
+	Error      string  `json:"error,omitempty"`
+}
+
+// retryCount is the number of API calls retried by the library during the run
+var retryCount int64
+
+// CountRetry counts the retry for the transfer stats, it is the OnRetry callback of the library
+func CountRetry(operation string, attempt int, err error) {
+	atomic.AddInt64(&retryCount, 1)
+}
+
+// NewTransferStats creates stats for the transfer finished now. Retries are the ones done during the run,
+// which is a single transfer
+func NewTransferStats(action string, started time.Time, bytes int64) *TransferStats {
+	duration := time.Since(started)
+	stats := &TransferStats{
+		Action:     action,
+		Bytes:      bytes,
+		DurationMs: duration.Milliseconds(),
+		Retries:    int(atomic.LoadInt64(&retryCount)),
+		Ok:         true,
+	}
+
+	if seconds := duration.Seconds(); seconds > 0 {
+		stats.Throughput = float64(bytes) / seconds
+	}
+
+	return stats
+}
+
+// EmitTransferStats prints the stats as a JSON line to stdout or appends it to the stats file.
+// Nothing is printed if statistics are not requested by flags
+func EmitTransferStats(stats *TransferStats) {
+	if !*Stats && *StatsFile == "" {
+		return
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		PrintError("Failed to encode transfer stats: %v", err)
+		return
+	}
+
+	if *StatsFile == "" {
+		// Stats line goes to stdout as-is, without timestamps, so it stays parseable in any output mode.
+		// If stdout carries the content, the line goes to stderr not to corrupt it
+		if isStdoutReserved() {
+			_, _ = fmt.Fprintln(os.Stderr, string(data))
+		} else {
+			fmt.Println(string(data))
+		}
+		return
+	}
+
+	file, err := os.OpenFile(*StatsFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		PrintError("Failed to open stats file %s", *StatsFile)
+		return
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	if err != nil {
+		PrintError("Failed to write stats file %s", *StatsFile)
+	}
+}
+
+// countingReader counts bytes read through it. It is used to measure uploads of unknown size
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,193 @@
+package internal
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Subcommand maps a command like "download <id>" to the legacy -act.* flag of its action.
+// Legacy flags keep working, but subcommands are the preferred way to call actions.
+// Each subcommand has its own flag set, which accepts all the global flags and the flags of its action
+// without the action prefix (e.g. "download -path ." instead of "-act.download.path .")
+type Subcommand struct {
+	// Name is the command name, nested commands are separated by space (e.g. "files list")
+	Name string
+	// Args describes the positional argument in the usage
+	Args string
+	// Description is a one-line description of the command
+	Description string
+	// ActionFlag is the legacy flag that is set to the positional argument
+	ActionFlag string
+	// DefaultArg is used if the positional argument is omitted. Empty means the argument is required
+	DefaultArg string
+	// OptionalArg allows to omit the positional argument without default value
+	OptionalArg bool
+	// Prefix is the prefix of action flags that are available without it
+	Prefix string
+}
+
+// subcommands is the registry of available subcommands in the order they are shown in the help
+var subcommands = []*Subcommand{
+	{Name: "download folder", Args: "<folder id>", Description: "Download a folder as a tar or zip archive", ActionFlag: "act.download.folder", Prefix: "act.download"},
+	{Name: "download latest", Args: "<prefix or glob>", Description: "Download the latest modified file matching the pattern", ActionFlag: "act.download.latest", Prefix: "act.download"},
+	{Name: "download", Args: "<file id>", Description: "Download a file", ActionFlag: "act.download", Prefix: "act.download"},
+	{Name: "upload", Args: "[path]", Description: "Upload a file by its path or from stdin", ActionFlag: "act.upload", OptionalArg: true, Prefix: "act.upload"},
+	{Name: "files list", Args: "[disk id]", Description: "List files of the disk", ActionFlag: "act.files", DefaultArg: ".", Prefix: "act.files"},
+	{Name: "files mkdir", Args: "<path>", Description: "Create a folder with missing parent folders", ActionFlag: "act.files.mkdir", Prefix: "act.files"},
+	{Name: "files check-crypto", Args: "<file id>", Description: "Check that a file can be decrypted, without downloading it", ActionFlag: "act.files.check-crypto", Prefix: "act.files"},
+	{Name: "files url", Args: "<file id>", Description: "Print download link of a file", ActionFlag: "act.files.url", Prefix: "act.files"},
+	{Name: "files delete-prefix", Args: "<prefix or glob>", Description: "Delete all files of the folder matching the pattern", ActionFlag: "act.files.delete.prefix", Prefix: "act.files"},
+	{Name: "files move-many", Args: "<ids or ->", Description: "Move files to another folder or disk", ActionFlag: "act.files.move-many", Prefix: "act.files"},
+	{Name: "files delete", Args: "<file id>", Description: "Delete a file", ActionFlag: "act.files.delete", Prefix: "act.files.delete"},
+	{Name: "trash list", Args: "[disk id]", Description: "List files in the trash", ActionFlag: "act.trash.list", DefaultArg: ".", Prefix: "act.trash"},
+	{Name: "trash restore", Args: "<file id>", Description: "Restore a file from the trash", ActionFlag: "act.trash.restore", Prefix: "act.trash"},
+	{Name: "trash empty", Args: "[disk id]", Description: "Empty the trash", ActionFlag: "act.trash.empty", DefaultArg: ".", Prefix: "act.trash"},
+	{Name: "shares list", Args: "[disk id]", Description: "List public links to files", ActionFlag: "act.shares.list", DefaultArg: ".", Prefix: "act.shares"},
+	{Name: "shares revoke", Args: "<link id>", Description: "Revoke a public link", ActionFlag: "act.shares.revoke", Prefix: "act.shares"},
+	{Name: "verify", Args: "<file id>", Description: "Compare a local file with a file on the server", ActionFlag: "act.verify", Prefix: "act.verify"},
+	{Name: "copy", Args: "<file id>", Description: "Copy a file to another disk or folder", ActionFlag: "act.copy", Prefix: "act.copy"},
+	{Name: "disks create", Args: "<title>", Description: "Create a disk, optionally encrypted", ActionFlag: "act.disks.create", Prefix: "act.disks.create"},
+	{Name: "disks", Description: "List disks with their encryption and quotas", ActionFlag: "act.disks", DefaultArg: "true", Prefix: "act.disks"},
+	{Name: "keys change-password", Args: "[disk id]", Description: "Change the crypto password of the disk", ActionFlag: "act.keys.change-password", DefaultArg: ".", Prefix: "act.keys"},
+	{Name: "keys", Args: "[disk id]", Description: "Export encryption keys of the disk", ActionFlag: "act.keys", DefaultArg: ".", Prefix: "act.keys"},
+	{Name: "api", Args: "<method>", Description: "Call any API method", ActionFlag: "act.method", Prefix: "act.method"},
+	{Name: "ping", Description: "Check if the API is alive", ActionFlag: "act.ping", DefaultArg: "true", Prefix: "act.ping"},
+	{Name: "server-info", Description: "Show server version and supported methods", ActionFlag: "act.server-info", DefaultArg: "true", Prefix: "act.server-info"},
+	{Name: "health", Description: "Show server health and ping latency", ActionFlag: "act.health", DefaultArg: "true", Prefix: "act.health"},
+	{Name: "self-update", Description: "Update the binary to the latest release", ActionFlag: "act.self-update", DefaultArg: "true", Prefix: "act.self-update"},
+}
+
+// findSubcommand finds the subcommand by the first arguments. It returns the number of arguments used by its name
+func findSubcommand(args []string) (*Subcommand, int) {
+	for _, command := range subcommands {
+		words := strings.Fields(command.Name)
+		if len(args) < len(words) {
+			continue
+		}
+
+		matched := true
+		for i, word := range words {
+			if args[i] != word {
+				matched = false
+				break
+			}
+		}
+
+		if matched {
+			return command, len(words)
+		}
+	}
+
+	return nil, 0
+}
+
+// ParseCommandLine parses the arguments either as a subcommand or as legacy flags.
+// The result is always stored in the global flags, so the rest of the program doesn't care how the action was called
+func ParseCommandLine(args []string) error {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return flag.CommandLine.Parse(args)
+	}
+
+	command, used := findSubcommand(args)
+	if command == nil {
+		return fmt.Errorf("unknown command %q, run with -help to see available commands", strings.Join(args, " "))
+	}
+
+	// Mark the global flags as parsed, so flag.Parsed works as usual
+	_ = flag.CommandLine.Parse(nil)
+
+	set := command.FlagSet()
+	var positional []string
+	rest := args[used:]
+	for {
+		if err := set.Parse(rest); err != nil {
+			return err
+		}
+		if set.NArg() == 0 {
+			break
+		}
+
+		// Flags are allowed after the positional arguments too
+		positional = append(positional, set.Arg(0))
+		rest = set.Args()[1:]
+	}
+
+	if len(positional) > 1 {
+		return fmt.Errorf("too many arguments for %q: %s", command.Name, strings.Join(positional, " "))
+	}
+
+	value := command.DefaultArg
+	if len(positional) == 1 {
+		value = positional[0]
+	} else if value == "" && !command.OptionalArg {
+		set.Usage()
+		return fmt.Errorf("%s is required for %q", command.Args, command.Name)
+	}
+
+	if value == "" {
+		return nil
+	}
+
+	return flag.CommandLine.Set(command.ActionFlag, value)
+}
+
+// FlagSet creates the flag set of the subcommand. It contains all the global flags and the flags
+// of its action without the prefix. All values are forwarded to the global flags
+func (c *Subcommand) FlagSet() *flag.FlagSet {
+	set := flag.NewFlagSet(c.Name, flag.ExitOnError)
+
+	var actionFlags []*flag.Flag
+	flag.VisitAll(func(f *flag.Flag) {
+		set.Var(&forwardValue{name: f.Name, target: f.Value}, f.Name, f.Usage)
+		if strings.HasPrefix(f.Name, c.Prefix+".") {
+			actionFlags = append(actionFlags, f)
+		}
+	})
+
+	for _, f := range actionFlags {
+		short := strings.TrimPrefix(f.Name, c.Prefix+".")
+		if set.Lookup(short) == nil {
+			set.Var(&forwardValue{name: f.Name, target: f.Value}, short, f.Usage)
+		}
+	}
+
+	set.Usage = func() {
+		out := set.Output()
+		program := filepath.Base(os.Args[0])
+		_, _ = fmt.Fprintf(out, "Usage: %s %s %s [flags]\n%s\n\nFlags:\n", program, c.Name, c.Args, c.Description)
+		for _, f := range actionFlags {
+			short := strings.TrimPrefix(f.Name, c.Prefix+".")
+			printFlag(out, &flag.Flag{Name: short, Usage: f.Usage, Value: f.Value, DefValue: f.DefValue})
+		}
+		_, _ = fmt.Fprintf(out, "\nGlobal flags are accepted too, run %s -help to see them\n", program)
+	}
+
+	return set
+}
+
+// forwardValue sets the global flag through flag.CommandLine, so it is marked as set like a usual flag
+type forwardValue struct {
+	name   string
+	target flag.Value
+}
+
+func (v *forwardValue) String() string {
+	if v.target == nil {
+		return ""
+	}
+
+	return v.target.String()
+}
+
+func (v *forwardValue) Set(value string) error {
+	return flag.CommandLine.Set(v.name, value)
+}
+
+// IsBoolFlag allows to use boolean flags without value, like the original ones
+func (v *forwardValue) IsBoolFlag() bool {
+	boolValue, ok := v.target.(interface{ IsBoolFlag() bool })
+	return ok && boolValue.IsBoolFlag()
+}
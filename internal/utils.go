@@ -1,17 +1,25 @@
 package internal
 
 import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/kt-soft-dev/kt-cli/pkg"
+	"golang.org/x/crypto/ssh/terminal"
+	"io"
 	"os"
+	"path"
+	"strconv"
 	"strings"
 	"unicode"
 )
 
-// JsonToString converts a map to a string. It makes it easier to print json data. Pretty-prints the json if pretty is true
-func JsonToString(data map[string]interface{}, pretty bool) string {
+// JsonToString converts a value to a string. It makes it easier to print json data. Pretty-prints the json if pretty is true
+func JsonToString(data interface{}, pretty bool) string {
 	if pretty {
 		jsonData, err := json.MarshalIndent(data, "", "    ")
 		if err != nil {
@@ -29,36 +37,224 @@ func JsonToString(data map[string]interface{}, pretty bool) string {
 	return string(jsonData)
 }
 
+// ProjectFields returns only the listed fields of the data. Nested fields are separated by dots (e.g. "user.id"),
+// and list items can be addressed by index (e.g. "list.0.name"). Result keys are the field paths as provided.
+// Missing fields are set to nil, or skipped if omitMissing is true
+func ProjectFields(data interface{}, fields []string, omitMissing bool) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		value, ok := lookupPath(data, strings.Split(field, "."))
+		if !ok && omitMissing {
+			continue
+		}
+
+		result[field] = value
+	}
+
+	return result
+}
+
+// lookupPath finds the value by the path of keys in nested maps and lists
+func lookupPath(data interface{}, path []string) (interface{}, bool) {
+	current := data
+	for _, key := range path {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[key]
+			if !ok {
+				return nil, false
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+			current = node[index]
+		default:
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
 // ParseKeyValues parses a string with key=value pairs separated by spaces and returns a map with the key and value
 // It is used to parse the flags of the command line and other similar cases
 func ParseKeyValues(data string) map[string]interface{} {
+	return ParseKeyValuesSep(data, "")
+}
+
+// ParseKeyValuesSep parses a string with key=value pairs separated by the separator (any whitespace if it is empty).
+// Only the first "=" splits the key and the value, so values may contain "=" (like base64 or query strings).
+// Parts in quotes are taken as-is without quotes, and a backslash escapes the next character,
+// so separators can be used inside values
+func ParseKeyValuesSep(data string, separator string) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, item := range splitEscaped(data, separator) {
+		if key, value, ok := parseKeyValue(item); ok {
+			m[key] = value
+		}
+	}
+
+	return m
+}
+
+// parseKeyValue parses a single key=value pair. Only the first "=" splits the key and the value
+func parseKeyValue(item string) (string, interface{}, bool) {
+	key, value, found := strings.Cut(item, "=")
+	if !found || key == "" {
+		return "", nil, false
+	}
+
+	return key, value, true
+}
+
+// KeyValueList is a repeatable flag collecting key=value pairs, one pair per flag
+type KeyValueList []string
+
+func (l *KeyValueList) String() string {
+	if l == nil {
+		return ""
+	}
+
+	return strings.Join(*l, " ")
+}
+
+func (l *KeyValueList) Set(value string) error {
+	if _, _, ok := parseKeyValue(value); !ok {
+		return fmt.Errorf("invalid parameter %q, expected key=value", value)
+	}
+
+	*l = append(*l, value)
+	return nil
+}
+
+// Merge adds pairs to the map, overriding existing keys. Each flag value is a single pair,
+// so spaces and quotes are kept as-is (the shell has already handled them)
+func (l *KeyValueList) Merge(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		m = make(map[string]interface{})
+	}
+
+	for _, item := range *l {
+		if key, value, ok := parseKeyValue(item); ok {
+			m[key] = value
+		}
+	}
+
+	return m
+}
+
+// PasswordList is a repeatable flag with crypto passwords. A value like "disk:password" is the password
+// of the disk, other values are the default password for all the other disks
+type PasswordList []string
+
+// String doesn't show passwords, so they never appear in the help or logs
+func (l *PasswordList) String() string {
+	return ""
+}
+
+func (l *PasswordList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// defaultPasswordPrefix marks the default password explicitly, so it may contain ":" along with disk passwords,
+// like "-passwd :pass:word -passwd disk2:password2". The prefix is not a part of the password
+const defaultPasswordPrefix = ":"
+
+// Default returns the password for disks without their own password: the last value without a disk
+// or with defaultPasswordPrefix. A single value is always the default password, so passwords with ":" keep working
+func (l *PasswordList) Default() string {
+	password := ""
+	for _, value := range *l {
+		switch {
+		case strings.HasPrefix(value, defaultPasswordPrefix):
+			password = strings.TrimPrefix(value, defaultPasswordPrefix)
+		case len(*l) == 1 || !strings.Contains(value, ":"):
+			password = value
+		}
+	}
+
+	return password
+}
+
+// DiskPasswords returns passwords of disks set as "disk:password"
+func (l *PasswordList) DiskPasswords() map[string]string {
+	passwords := make(map[string]string)
+	for _, value := range *l {
+		if disk, password, ok := strings.Cut(value, ":"); ok && disk != "" {
+			passwords[disk] = password
+		}
+	}
+
+	return passwords
+}
+
+// IsSet checks if any password is set
+func (l *PasswordList) IsSet() bool {
+	return len(*l) > 0
+}
+
+// splitEscaped splits the data by the separator (or whitespace), respecting quotes and backslash escapes.
+// Quotes and escaping backslashes are removed from the result
+func splitEscaped(data string, separator string) []string {
+	var items []string
+	var current strings.Builder
+	hasItem := false
 	lastQuote := rune(0)
-	f := func(c rune) bool {
+	escaped := false
+
+	flush := func() {
+		if hasItem {
+			items = append(items, current.String())
+		}
+		current.Reset()
+		hasItem = false
+	}
+
+	runes := []rune(data)
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
 		switch {
+		case escaped:
+			current.WriteRune(c)
+			hasItem = true
+			escaped = false
+		case c == '\\':
+			escaped = true
 		case c == lastQuote:
 			lastQuote = rune(0)
-			return false
 		case lastQuote != rune(0):
-			return false
+			current.WriteRune(c)
 		case unicode.In(c, unicode.Quotation_Mark):
 			lastQuote = c
-			return false
+			hasItem = true
+		case separator == "" && unicode.IsSpace(c):
+			flush()
+		case separator != "" && strings.HasPrefix(string(runes[i:]), separator):
+			flush()
+			i += len([]rune(separator)) - 1
 		default:
-			return unicode.IsSpace(c)
-
+			current.WriteRune(c)
+			hasItem = true
 		}
 	}
+	flush()
 
-	items := strings.FieldsFunc(data, f)
-	m := make(map[string]interface{})
-	for _, item := range items {
-		x := strings.Split(item, "=")
-		if len(x) == 2 {
-			m[x[0]] = x[1]
+	if separator != "" {
+		for i := range items {
+			items[i] = strings.TrimSpace(items[i])
 		}
 	}
 
-	return m
+	return items
 }
 
 // GetActualError returns an error if the response has an error or if there was an error passed as argument.
@@ -67,24 +263,44 @@ func GetActualError(response *pkg.ApiResponse, err error) error {
 	if err != nil {
 		return err
 	}
-	if response != nil && response.Error.Code != 0 {
-		return errors.New(response.Error.Message)
-	}
-
-	return nil
+	return pkg.ResponseError(response)
 }
 
 // IsStdin checks if the stdin has data
 func IsStdin() bool {
 	fi, err := os.Stdin.Stat()
 	if err != nil {
-		PrintError("os.Stdin.Stat()", err)
+		PrintError("os.Stdin.Stat(): %v", err)
 		return false
 	}
 
 	return fi.Size() > 0
 }
 
+// IsNamedStdinUpload checks if the stdin is redirected (from a pipe, a file or /dev/null) for the upload with a name and without
+// a path. Such stdin is uploaded even if it is empty, so empty outputs of scripts become empty files.
+// IsStdin doesn't see empty or not yet written stdin, and the terminal is never treated as the content
+func IsNamedStdinUpload() bool {
+	if *UploadName == "" || *Upload != "" || *UploadStdinTar || *UploadFromURL != "" {
+		return false
+	}
+
+	return !terminal.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// IsOtherActionSet checks if an action other than the upload is set on the command line.
+// Redirected stdin is the content of the upload only without such actions, others may read their input from it
+func IsOtherActionSet() bool {
+	other := false
+	flag.Visit(func(f *flag.Flag) {
+		if strings.HasPrefix(f.Name, "act.") && !strings.HasPrefix(f.Name, "act.upload") {
+			other = true
+		}
+	})
+
+	return other
+}
+
 // ByteCount converts bytes to human-readable format
 func ByteCount(b int64) string {
 	const unit = 1024
@@ -100,24 +316,117 @@ func ByteCount(b int64) string {
 		float64(b)/float64(div), "KMGTPE"[exp])
 }
 
+// ParseByteRange parses a byte range in format "start-end" or "start-" (both inclusive, like HTTP Range header)
+// End is -1 if it is not set, which means "until the end of the file"
+func ParseByteRange(value string) (start int64, end int64, err error) {
+	parts := strings.SplitN(strings.TrimSpace(value), "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid range %q, expected start-end", value)
+	}
+
+	start, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, fmt.Errorf("invalid range start %q", parts[0])
+	}
+
+	if parts[1] == "" {
+		return start, -1, nil
+	}
+
+	end, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || end < start {
+		return 0, 0, fmt.Errorf("invalid range end %q", parts[1])
+	}
+
+	return start, end, nil
+}
+
+// byteSizeUnits are multipliers of size units. Units are binary, like in ByteCount, so "1MB" is 1024*1024 bytes
+var byteSizeUnits = map[string]int64{
+	"":  1,
+	"B": 1,
+	"K": 1 << 10, "KB": 1 << 10, "KIB": 1 << 10,
+	"M": 1 << 20, "MB": 1 << 20, "MIB": 1 << 20,
+	"G": 1 << 30, "GB": 1 << 30, "GIB": 1 << 30,
+	"T": 1 << 40, "TB": 1 << 40, "TIB": 1 << 40,
+}
+
+// ParseByteSize parses a size like "500MB", "1.5G" or "1024" (bytes). Units are case-insensitive and binary
+func ParseByteSize(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	number := strings.TrimRightFunc(value, unicode.IsLetter)
+	unit := strings.ToUpper(strings.TrimSpace(value[len(number):]))
+
+	multiplier, ok := byteSizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: unknown unit %q", value, unit)
+	}
+
+	size, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+
+	return int64(size * float64(multiplier)), nil
+}
+
 // DiskIdOrDefault returns the disk id if it is not empty, otherwise it returns the default disk id
-// It is useful for most users, they usually have only one disk
+// It is useful for most users, they usually have only one disk.
+// "." explicitly asks for the default disk. In strict disk mode, empty disk id is an error instead,
+// so the disk is never chosen silently. The resolved disk is returned along with its id, so its keys
+// and quota can be used without another request; pkg.ErrDiskNotFound is returned for unknown disks
 func DiskIdOrDefault(config *Config, diskId string) (string, *pkg.Disk, error) {
+	diskId = strings.TrimSpace(diskId)
+	explicit := diskId != ""
+	if diskId == "" && config.RememberDisk && config.LastDisk != "" {
+		diskId = config.LastDisk
+		// The notice goes to stderr, because stdout may carry results piped to other commands
+		PrintWarning("Using the last used disk %s (-no-remember-disk to forget it)", diskId)
+	}
+	if diskId == "" {
+		diskId = config.DefaultDisk
+	}
+	if diskId == "" && *StrictDisk {
+		return "", nil, errors.New("disk is not specified (disk ID or \".\" for the default disk is required in -strict-disk mode)")
+	}
 	if diskId == "." {
 		diskId = ""
 	}
 
-	disk, _, err := pkg.GetUserDisk(config.Token, "")
+	disk, _, err := pkg.GetUserDisk(config.Token, diskId)
 	if err != nil {
 		return diskId, nil, err
 	}
 
+	if explicit && config.RememberDisk {
+		config.LastDisk = disk.ID
+	}
+
 	return disk.ID, disk, nil
 }
 
+// ApplyRememberDisk turns remembering of the last used disk on or off by -remember-disk and -no-remember-disk flags.
+// The choice is saved in the config, so it is kept for the next runs. The remembered disk is forgotten when it is off
+func ApplyRememberDisk(config *Config) error {
+	if *RememberDisk && *NoRememberDisk {
+		return errors.New("-remember-disk and -no-remember-disk can't be used together")
+	}
+
+	if *RememberDisk {
+		config.RememberDisk = true
+	}
+	if *NoRememberDisk {
+		config.RememberDisk = false
+		config.LastDisk = ""
+	}
+
+	return nil
+}
+
 func NewDefaultCryptoInfo() *pkg.CryptoInfo {
 	info := &pkg.CryptoInfo{}
-	info.Password = *Passwd
+	info.Password = Passwd.Default()
+	info.DiskPasswords = Passwd.DiskPasswords()
 
 	b, err := os.ReadFile(*PublicKeyFile)
 	if err == nil {
@@ -131,5 +440,136 @@ func NewDefaultCryptoInfo() *pkg.CryptoInfo {
 		info.EncryptedCryptoKey = string(b)
 	}
 
+	if rawPrivateKey != "" {
+		Print("Using decrypted private key from file %s, password key derivation is skipped", *RawPrivateKeyFile)
+		info.RawCryptoKey = rawPrivateKey
+	}
+
 	return info
 }
+
+// rawPrivateKey is the decrypted private key read from the -private-raw file by LoadRawPrivateKey
+var rawPrivateKey string
+
+// LoadRawPrivateKey reads the decrypted private key from the -private-raw file. It is done once before the action,
+// so the key which can't be read fails the run instead of falling back to the password key derivation
+func LoadRawPrivateKey() error {
+	if *RawPrivateKeyFile == "" {
+		return nil
+	}
+
+	b, err := os.ReadFile(*RawPrivateKeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read decrypted private key file %s: %w", *RawPrivateKeyFile, err)
+	}
+
+	rawPrivateKey = string(b)
+	return nil
+}
+
+// NewDiskCryptoInfo creates crypto info for the provided disk using the password from flags.
+// It returns nil if the disk is not encrypted
+func NewDiskCryptoInfo(disk *pkg.Disk) *pkg.CryptoInfo {
+	if disk == nil || disk.CryptoKey == "" {
+		return nil
+	}
+
+	return &pkg.CryptoInfo{
+		EncryptedCryptoKey: disk.CryptoKey,
+		PublicKey:          disk.PublicKey,
+		Password:           Passwd.Default(),
+		DiskPasswords:      Passwd.DiskPasswords(),
+		Disk:               disk.ID,
+	}
+}
+
+// FileSHA256 computes the hex encoded SHA-256 hash of the file content and rewinds the file back to the start
+func FileSHA256(file *os.File) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// CompressedSHA256 returns the SHA-256 hash (hex encoded) and the size of the file content compressed the same way
+// as uploads with -act.upload.compress. Compression is deterministic, so they match the hash and the size
+// of the same content uploaded compressed before. The file offset is not changed
+func CompressedSHA256(file *os.File) (string, int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return "", 0, err
+	}
+
+	compressed := pkg.CompressReader(io.NewSectionReader(file, 0, info.Size()))
+	defer compressed.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, compressed)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// FindDuplicate looks for a file with the same hash on the disk. If the server can't look files up by hash,
+// all the files of the folder are checked instead. It returns nil if there is no such file
+func FindDuplicate(config *Config, disk string, folder string, hash string) (*pkg.File, error) {
+	list, err := pkg.FindFilesByHash(config.Token, disk, hash)
+	if errors.Is(err, pkg.ErrMethodNotSupported) {
+		list, err = pkg.GetAllFolderFiles(config.Token, disk, folder)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range list {
+		if strings.EqualFold(file.Hash, hash) {
+			return file, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// MatchName checks if the file name matches the pattern. Patterns with *, ? or [ are globs, others are prefixes
+func MatchName(pattern string, name string) (bool, error) {
+	if strings.ContainsAny(pattern, "*?[") {
+		return path.Match(pattern, name)
+	}
+
+	return strings.HasPrefix(name, pattern), nil
+}
+
+// ReadFileRefs returns file IDs or paths from the comma-separated list. If the list is "-",
+// they are read from the reader one per line, so the output of -act.files.ids-only can be piped in.
+// Empty entries are skipped
+func ReadFileRefs(list string, reader io.Reader) ([]string, error) {
+	var refs []string
+	if list != "-" {
+		for _, ref := range strings.Split(list, ",") {
+			if ref = strings.TrimSpace(ref); ref != "" {
+				refs = append(refs, ref)
+			}
+		}
+		return refs, nil
+	}
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if ref := strings.TrimSpace(scanner.Text()); ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file list: %w", err)
+	}
+
+	return refs, nil
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"fmt"
+	"github.com/kt-soft-dev/kt-cli/pkg"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKeyValuesSep(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		separator string
+		want      map[string]interface{}
+	}{
+		{name: "whitespace separated", data: "disk=disk1  folder=f1\tlimit=10", want: map[string]interface{}{"disk": "disk1", "folder": "f1", "limit": "10"}},
+		{name: "value with equal signs", data: "query=a=1&b=2 key=YWJj==", want: map[string]interface{}{"query": "a=1&b=2", "key": "YWJj=="}},
+		{name: "quoted value with spaces", data: `name="my file.txt" disk=d1`, want: map[string]interface{}{"name": "my file.txt", "disk": "d1"}},
+		{name: "single quotes", data: `name='a b'`, want: map[string]interface{}{"name": "a b"}},
+		{name: "escaped space", data: `name=a\ b disk=d1`, want: map[string]interface{}{"name": "a b", "disk": "d1"}},
+		{name: "empty value", data: "name= disk=d1", want: map[string]interface{}{"name": "", "disk": "d1"}},
+		{name: "items without key are skipped", data: "=value flag disk=d1", want: map[string]interface{}{"disk": "d1"}},
+		{name: "custom separator", data: "name=a b; disk=d1 ;folder=f1", separator: ";", want: map[string]interface{}{"name": "a b", "disk": "d1", "folder": "f1"}},
+		{name: "multi-character separator", data: "a=1&&b=x&y", separator: "&&", want: map[string]interface{}{"a": "1", "b": "x&y"}},
+		{name: "escaped separator", data: `name=a\;b;disk=d1`, separator: ";", want: map[string]interface{}{"name": "a;b", "disk": "d1"}},
+		{name: "quoted separator", data: `name="a;b";disk=d1`, separator: ";", want: map[string]interface{}{"name": "a;b", "disk": "d1"}},
+		{name: "empty data", data: "", want: map[string]interface{}{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ParseKeyValuesSep(test.data, test.separator)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseKeyValuesSep(%q, %q) = %v, want %v", test.data, test.separator, got, test.want)
+			}
+		})
+	}
+}
+
+// serverTransport sends all the requests of the library to the test server
+type serverTransport struct {
+	target *url.URL
+}
+
+func (t serverTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request.URL.Scheme = t.target.Scheme
+	request.URL.Host = t.target.Host
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func TestDiskIdOrDefaultNoticeOnStderr(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"result":{"count":2,"list":[{"id":"disk1"},{"id":"disk2"}]}}`)
+	}))
+	defer server.Close()
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg.SetHTTPClient(&http.Client{Transport: serverTransport{target: target}})
+	defer pkg.SetHTTPClient(nil)
+
+	dir := t.TempDir()
+	stdout, err := os.Create(filepath.Join(dir, "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(filepath.Join(dir, "stderr"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+
+	oldStdout, oldStderr, oldMessageWriter, oldPrintMode := os.Stdout, os.Stderr, messageWriter, printMode
+	os.Stdout, os.Stderr, messageWriter, printMode = stdout, stderr, stdout, ModePlain
+	defer func() {
+		os.Stdout, os.Stderr, messageWriter, printMode = oldStdout, oldStderr, oldMessageWriter, oldPrintMode
+	}()
+
+	config := &Config{Token: "secret", RememberDisk: true, LastDisk: "disk2"}
+	diskId, _, err := DiskIdOrDefault(config, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diskId != "disk2" {
+		t.Errorf("disk is %q, want the last used disk2", diskId)
+	}
+
+	stdoutData, _ := os.ReadFile(stdout.Name())
+	stderrData, _ := os.ReadFile(stderr.Name())
+	if len(stdoutData) != 0 {
+		t.Errorf("stdout has %q, want nothing, so it can be piped", stdoutData)
+	}
+	if !strings.Contains(string(stderrData), "Using the last used disk disk2") {
+		t.Errorf("stderr has %q, want the notice", stderrData)
+	}
+}
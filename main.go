@@ -5,33 +5,120 @@ import (
 	"github.com/kt-soft-dev/kt-cli/internal"
 	"github.com/kt-soft-dev/kt-cli/pkg"
 	"os"
+	"time"
 )
 
 func main() {
-	flag.Parse()
+	os.Exit(run())
+}
+
+// run executes the program and returns the exit code. It is separated from main,
+// so deferred calls (like saving the config) are done before the exit
+func run() (exitCode int) {
+	flag.Usage = internal.PrintUsage
+	if err := internal.ParseCommandLine(os.Args[1:]); err != nil {
+		internal.PrintError("%v", err)
+		return internal.ExitUsage
+	}
 	internal.SetPrintMode(*internal.PrintModeFlag)
+	if err := internal.SetColorMode(*internal.ColorFlag); err != nil {
+		internal.PrintError("%v", err)
+		return internal.ExitUsage
+	}
+	if err := internal.SetLogFormat(*internal.LogFormat); err != nil {
+		internal.PrintError("%v", err)
+		return internal.ExitUsage
+	}
 	pkg.SetInteractiveMode(!*internal.NotInteractive)
-	internal.ScanEnv()
-	isStdIn := internal.IsStdin()
+	pkg.SetTransportSettings(pkg.TransportSettings{MaxIdleConns: *internal.MaxIdleConns, MaxConnsPerHost: *internal.MaxConnsHost})
+	pkg.SetApiRateLimit(*internal.ApiRps)
+	pkg.SetOfflineMode(*internal.Offline)
+	pkg.SetCopyBufferSize(*internal.IoBufferSize)
+	pkg.SetDecompressDownloads(!*internal.DownloadNoDecompress)
+	pkg.SetJobPolling(time.Second, *internal.JobTimeout)
+	pkg.SetRetryPolicy(pkg.RetryPolicy{
+		MaxAttempts:  *internal.ApiAttempts,
+		MaxElapsed:   *internal.ApiRetryTime,
+		InitialDelay: pkg.DefaultRetryPolicy.InitialDelay,
+		MaxDelay:     pkg.DefaultRetryPolicy.MaxDelay,
+	})
+	callbacks := internal.ProgressCallbacks()
+	callbacks.OnRetry = internal.CountRetry
+	pkg.SetCallbacks(callbacks)
+	if err := internal.ScanEnv(); err != nil {
+		internal.PrintError("%v", err)
+		return internal.ExitFailure
+	}
+	if err := internal.LoadRawPrivateKey(); err != nil {
+		internal.PrintError("%v", err)
+		return internal.ExitFailure
+	}
+	isStdIn := (internal.IsStdin() || internal.IsNamedStdinUpload()) && !internal.IsOtherActionSet()
 
 	// When not in debug mode, catch panics and print them in more user-friendly way like error messages
 	if !*internal.Debug {
 		defer func() {
 			if err := recover(); err != nil {
 				internal.PrintError("%v", err)
-				os.Exit(1)
+				exitCode = internal.ExitFailure
 			}
 		}()
 	}
 
-	// globalContext, cancel := context.WithCancel(context.Background())
-	config, err := internal.LoadConfig(*internal.ConfigFilename)
-	if err != nil {
-		internal.PrintError("Failed to load config file and/or create a new one. Exiting...")
-		os.Exit(1)
+	if *internal.TraceFile != "" {
+		traceCloser, err := internal.StartTrace(*internal.TraceFile)
+		if err != nil {
+			internal.PrintError("Failed to open trace file %s", *internal.TraceFile)
+			return internal.ExitFailure
+		}
+		defer traceCloser.Close()
 	}
 
-	if !*internal.NoConfigSave {
+	if *internal.Out != "" {
+		resultCloser, err := internal.OpenResultFile(*internal.Out)
+		if err != nil {
+			internal.PrintError("%v", err)
+			return internal.ExitFailure
+		}
+		defer func() {
+			if err := resultCloser.Close(); err != nil {
+				internal.PrintError("%v", err)
+				exitCode = internal.ExitFailure
+			}
+		}()
+	}
+
+	// The self-update works with the binary only, so it doesn't need the config and the token
+	if *internal.SelfUpdate {
+		internal.ActionSelfUpdate()
+		return internal.ExitCode()
+	}
+
+	var config *internal.Config
+	var err error
+	if *internal.Anonymous || *internal.NoConfig {
+		// Anonymous and stateless runs don't need any stored state, and must not touch the stored token
+		config = internal.CreateDefaultConfig()
+	} else {
+		config, err = internal.LoadConfig(*internal.ConfigFilename)
+		if err != nil {
+			internal.PrintError("Failed to load config file: %v", err)
+			return internal.ExitFailure
+		}
+	}
+
+	if err = internal.ApplyRememberDisk(config); err != nil {
+		internal.PrintError("%v", err)
+		return internal.ExitUsage
+	}
+	if err = internal.ApplyConfigDefaults(config); err != nil {
+		internal.PrintError("%v", err)
+		return internal.ExitUsage
+	}
+	// The concurrency may be set by the config defaults
+	pkg.SetConcurrency(*internal.Concurrency)
+
+	if !*internal.NoConfigSave && !*internal.Anonymous && !*internal.NoConfig {
 		// Save the config file on exit. It could change during the program execution in some cases
 		defer func() {
 			err = internal.SaveConfig(config, *internal.ConfigFilename)
@@ -42,15 +129,24 @@ func main() {
 	}
 
 	// Set the token from the command line flag to config
-	if *internal.Auth != "" {
-		config.Token = *internal.Auth
+	if *internal.Auth != "" && !*internal.Anonymous {
+		if (internal.IsTokenFromStdin() || *internal.NoConfig) && !*internal.Offline {
+			// The token from stdin or of a stateless run is checked like the entered one,
+			// so automated runs fail early on a wrong token
+			_ = internal.CheckTokenAndAssign(*internal.Auth, config)
+		} else {
+			config.Token = *internal.Auth
+		}
 	}
 
-	// If the token is not set, and we are not in non-interactive mode, ask for it now
-	if config.Token == "" && !*internal.NotInteractive {
+	// If the token is not set, and we are not in non-interactive, anonymous or offline mode, ask for it now
+	if config.Token == "" && !*internal.NotInteractive && !*internal.Anonymous && !*internal.Offline {
 		internal.ActionAskForToken(config)
 	}
 
+	// The token may come from the config file, so it is redacted from JSON logs along with the flag value
+	internal.RegisterSecret(config.Token)
+
 	switch {
 	case *internal.Method != "":
 		internal.ActionApiCall(config)
@@ -58,19 +154,81 @@ func main() {
 	case *internal.Ping:
 		internal.ActionPing()
 
-	case *internal.Upload != "" || isStdIn:
+	case *internal.Health:
+		internal.ActionHealth(config)
+
+	case *internal.ServerInfo:
+		internal.ActionServerInfo(config)
+
+	case *internal.Upload != "" || *internal.UploadStdinTar || *internal.UploadFromURL != "" || isStdIn:
 		internal.ActionUpload(config, isStdIn)
 
+	case *internal.DownloadFolder != "":
+		internal.ActionDownloadFolder(config)
+
+	case *internal.DownloadLatest != "":
+		internal.ActionDownloadLatest(config)
+
 	case *internal.Download != "":
 		internal.ActionDownload(config)
 
+	case *internal.DisksCreate != "":
+		internal.ActionCreateDisk(config)
+
+	case *internal.DisksList:
+		internal.ActionListDisks(config)
+
+	case *internal.ChangePassword != "":
+		internal.ActionChangePassword(config)
+
 	case *internal.GetKeys != "":
 		internal.ActionGetKeys(config)
 
 	case *internal.FilesList != "":
 		internal.ActionFilesList(config)
 
+	case *internal.Verify != "":
+		internal.ActionVerify(config)
+
+	case *internal.Copy != "":
+		internal.ActionCopy(config)
+
+	case *internal.CreateFolder != "":
+		internal.ActionCreateFolder(config)
+
+	case *internal.FilesCheckCrypto != "":
+		internal.ActionCheckCrypto(config)
+
+	case *internal.FileURL != "":
+		internal.ActionFileURL(config)
+
+	case *internal.MoveMany != "":
+		internal.ActionMoveMany(config)
+
+	case *internal.DeletePattern != "":
+		internal.ActionDeleteByPattern(config)
+
+	case *internal.DeleteFile != "":
+		internal.ActionDeleteFile(config)
+
+	case *internal.TrashList != "":
+		internal.ActionTrashList(config)
+
+	case *internal.TrashRestore != "":
+		internal.ActionRestore(config)
+
+	case *internal.SharesList != "":
+		internal.ActionListShares(config)
+
+	case *internal.SharesRevoke != "":
+		internal.ActionRevokeShare(config)
+
+	case *internal.TrashEmpty != "":
+		internal.ActionEmptyTrash(config)
+
 	default:
 		internal.ActionDefault(config)
 	}
+
+	return internal.ExitCode()
 }
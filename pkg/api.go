@@ -1,11 +1,14 @@
 package pkg
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
-	"net/url"
+	"strings"
+	"time"
 )
 
 // ktUrl is the base url for the ktCloud API
@@ -17,67 +20,267 @@ const apiUrl = ktUrl + "/json-rpc"
 // uploadUrl is the url to the upload endpoint, it's separated from the JSON-RPC endpoint
 const uploadUrl = ktUrl + "/upload"
 
+// methodNotFoundCode is the JSON-RPC error code returned when the server doesn't know the method
+const methodNotFoundCode = -32601
+
+// ErrMethodNotSupported is returned by wrappers of optional API methods when the server doesn't support them
+var ErrMethodNotSupported = errors.New("method is not supported by the server")
+
 // @todo more structures instead of map[string]interface{}, better with auto generation
 
-// CheckApiAlive checks if the API is alive by sending a GET request to the /ping endpoint
-func CheckApiAlive() bool {
-	client := KtCustomClient()
-	response, err := client.Get(ktUrl + "/ping")
+// pongPayload is the body of a healthy /ping response
+const pongPayload = "Pong!"
+
+// pingTimeout is the timeout of a single /ping request, it's shorter than the timeout of API calls
+const pingTimeout = 3 * time.Second
+
+// pingAttempts is the number of /ping requests before the API is reported as unreachable
+const pingAttempts = 2
+
+// pingRetryDelay is the delay between /ping attempts
+const pingRetryDelay = 500 * time.Millisecond
+
+// ErrApiUnreachable is returned by CheckApiAlive when the API can't be reached over the network
+var ErrApiUnreachable = errors.New("API is unreachable")
+
+// ErrNotPong is returned by CheckApiAlive when the API responded, but not with the expected payload
+var ErrNotPong = errors.New("API responded with unexpected payload")
+
+// CheckApiAlive checks if the API is alive by sending a GET request to the /ping endpoint.
+// The API is alive only if it responds with 200 OK and the expected payload, nil is returned then.
+// Network failures are retried once and reported as ErrApiUnreachable, other responses are reported as ErrNotPong
+func CheckApiAlive() error {
+	return CheckApiAliveContext(context.Background())
+}
+
+// CheckApiAliveContext is CheckApiAlive which stops when the context is done
+func CheckApiAliveContext(ctx context.Context) error {
+	var err error
+	for attempt := 1; attempt <= pingAttempts; attempt++ {
+		err = ping(ctx)
+		if err == nil || !errors.Is(err, ErrApiUnreachable) || attempt == pingAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(pingRetryDelay):
+		}
+		notifyRetry("ping", attempt+1, err)
+	}
+
+	return err
+}
+
+// ping sends a single /ping request with its own timeout
+func ping(ctx context.Context) error {
+	if err := checkOnline(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, "GET", ktUrl+"/ping", nil)
 	if err != nil {
-		return false
+		return err
+	}
+
+	release, err := AcquireConcurrency(ctx, 1)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	response, err := KtCustomClient().Do(request)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrApiUnreachable, err)
 	}
 	defer response.Body.Close()
 
 	text, err := io.ReadAll(response.Body)
 	if err != nil {
-		return false
+		return fmt.Errorf("%w: %w", ErrApiUnreachable, err)
 	}
 
-	return response.StatusCode == 200 || string(text) == "Pong!"
+	if !isPong(response.StatusCode, text) {
+		return fmt.Errorf("%w (status %s)", ErrNotPong, response.Status)
+	}
+
+	return nil
+}
+
+// isPong checks if the /ping response means that the API is alive
+func isPong(status int, body []byte) bool {
+	return status == http.StatusOK && strings.TrimSpace(string(body)) == pongPayload
 }
 
-// ApiRequest sends a JSON-RPC request to the API. Token can be rewritten in the params map
+// ApiRequest sends a JSON-RPC request to the API. Token can be rewritten in the params map.
+// Empty token is not sent at all, so the request is anonymous.
+// Transient failures are retried according to the retry policy (see SetRetryPolicy)
 func ApiRequest(token string, method string, params map[string]interface{}) (*ApiResponse, error) {
-	if params == nil {
-		params = make(map[string]interface{})
-	}
+	return ApiRequestContext(context.Background(), token, method, params)
+}
 
-	if _, ok := params["token"]; !ok {
-		params["token"] = token
+// ApiRequestContext is ApiRequest which stops when the context is done, including waits between retries
+func ApiRequestContext(ctx context.Context, token string, method string, params map[string]interface{}) (*ApiResponse, error) {
+	var response *ApiResponse
+	err := retryApiCall(ctx, method, func() (err error) {
+		response, err = apiRequestOnce(ctx, token, method, params)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	params = map[string]interface{}{
-		"method": method,
-		"params": params,
-	}
+	return response, nil
+}
 
-	jsonData := jsonToReader(params)
-	if jsonData == nil {
-		return nil, errors.New("failed to convert json to reader")
+// apiRequestOnce sends the JSON-RPC request once. A 5xx response without a JSON-RPC error is returned as ServerError
+func apiRequestOnce(ctx context.Context, token string, method string, params map[string]interface{}) (*ApiResponse, error) {
+	release, err := AcquireConcurrency(ctx, 1)
+	if err != nil {
+		return nil, err
 	}
+	defer release()
 
-	requestUrl, err := url.Parse(apiUrl)
+	response, methodParams, err := sendApiRequest(ctx, token, method, params)
 	if err != nil {
 		return nil, err
 	}
+	defer response.Body.Close()
 
-	client := KtCustomClient()
-	response, err := client.Do(&http.Request{
-		Method: "POST",
-		URL:    requestUrl,
-		Header: http.Header{"Content-Type": []string{"application/json-rpc"}},
-		Body:   jsonData,
-	})
+	body, err := io.ReadAll(response.Body)
+	if isTracing() {
+		traceApiRequest(method, methodParams, response.StatusCode, body, err)
+	}
 	if err != nil {
 		return nil, err
 	}
-	defer response.Body.Close()
 
 	responseData := &ApiResponse{}
-	err = json.NewDecoder(response.Body).Decode(responseData)
+	err = json.Unmarshal(body, responseData)
+	if response.StatusCode >= http.StatusInternalServerError && (err != nil || responseData.Error.Code == 0) {
+		return nil, &ServerError{StatusCode: response.StatusCode, Status: response.Status}
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	return responseData, nil
 }
+
+// sendApiRequest sends the JSON-RPC request and returns the response with the body not read yet,
+// along with the params actually sent. Failed requests are traced here
+func sendApiRequest(ctx context.Context, token string, method string, params map[string]interface{}) (*http.Response, map[string]interface{}, error) {
+	if err := checkOnline(); err != nil {
+		return nil, nil, err
+	}
+
+	body := rpcRequestBody(token, method, params)
+	methodParams := body["params"].(map[string]interface{})
+
+	jsonData := jsonToReader(body)
+	if jsonData == nil {
+		return nil, nil, errors.New("failed to convert json to reader")
+	}
+
+	if err := waitApiRateLimit(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", apiUrl, jsonData)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Accept-Encoding is not set, so the transport negotiates gzip and decompresses the response by itself
+	request.Header.Set("Content-Type", "application/json-rpc")
+
+	client := KtCustomClient()
+	response, err := client.Do(request)
+	if err != nil {
+		if isTracing() {
+			traceApiRequest(method, methodParams, 0, nil, err)
+		}
+		return nil, nil, err
+	}
+
+	return response, methodParams, nil
+}
+
+// IsMethodNotFound checks if the response error means that the server doesn't know the requested method
+func IsMethodNotFound(response *ApiResponse) bool {
+	if response == nil || response.Error.Code == 0 {
+		return false
+	}
+
+	return isMethodNotFoundError(response.Error.Code, response.Error.Message)
+}
+
+// isMethodNotFoundError checks if the API error code and message mean that the server doesn't know the method
+func isMethodNotFoundError(code int, message string) bool {
+	return code == methodNotFoundCode || strings.Contains(strings.ToLower(message), "method not found")
+}
+
+// ApiError is the error returned by the API in the response. Its code can be checked with errors.As
+type ApiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ApiError) Error() string {
+	return e.Message
+}
+
+// ResponseError returns the error of the response as ApiError, or nil if the response has no error
+func ResponseError(response *ApiResponse) error {
+	if response == nil || response.Error.Code == 0 {
+		return nil
+	}
+
+	return &ApiError{Code: response.Error.Code, Message: response.Error.Message}
+}
+
+// callMethod sends an API request and converts all the kinds of failures to an error.
+// ErrMethodNotSupported is returned if the server doesn't know the method
+func callMethod(token string, method string, params map[string]interface{}) (*ApiResponse, error) {
+	return callMethodContext(context.Background(), token, method, params)
+}
+
+// callMethodContext is callMethod which stops when the context is done
+func callMethodContext(ctx context.Context, token string, method string, params map[string]interface{}) (*ApiResponse, error) {
+	response, err := ApiRequestContext(ctx, token, method, params)
+	if err != nil {
+		notifyError(method, err)
+		return nil, err
+	}
+	if IsMethodNotFound(response) {
+		err = fmt.Errorf("%s: %w", method, ErrMethodNotSupported)
+		notifyError(method, err)
+		return nil, err
+	}
+	if err := ResponseError(response); err != nil {
+		notifyError(method, err)
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// rpcRequestBody builds the JSON-RPC request body. The token is added to params only if it is not empty
+// and not already set there, because the server treats an empty token differently from a missing one
+func rpcRequestBody(token string, method string, params map[string]interface{}) map[string]interface{} {
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+
+	if _, ok := params["token"]; !ok && token != "" {
+		params["token"] = token
+	}
+
+	return map[string]interface{}{
+		"method": method,
+		"params": params,
+	}
+}
@@ -6,43 +6,61 @@ package pkg
 type ApiResponse struct {
 	ID    uint `mapstructure:"id"`
 	Error struct {
-		Code    uint   `mapstructure:"code"`
+		// Code is signed, JSON-RPC codes of protocol errors are negative
+		Code    int    `mapstructure:"code"`
 		Message string `mapstructure:"message"`
 	} `mapstructure:"error,omitempty"`
-	Result map[string]interface{} `mapstructure:"result,omitempty"`
+	// Result is the decoded JSON result: usually an object (map[string]interface{}), but some methods return
+	// an array ([]interface{}) or a scalar. Use ResultMap, ResultList or MapToStruct to access it
+	Result interface{} `mapstructure:"result,omitempty"`
+}
+
+// ResultMap returns the result if it is an object
+func (r *ApiResponse) ResultMap() (map[string]interface{}, bool) {
+	result, ok := r.Result.(map[string]interface{})
+	return result, ok
+}
+
+// ResultList returns the result if it is an array
+func (r *ApiResponse) ResultList() ([]interface{}, bool) {
+	result, ok := r.Result.([]interface{})
+	return result, ok
 }
 
 type File struct {
-	Date       int    `mapstructure:"date"`
-	Disk       string `mapstructure:"disk"`
-	Encrypted  bool   `mapstructure:"encrypted"`
-	Folder     string `mapstructure:"folder"`
-	ID         string `mapstructure:"id"`
-	Mime       string `mapstructure:"mime"`
-	Name       string `mapstructure:"name"`
-	NameCrypto string `mapstructure:"name_crypto"`
-	Rating     int    `mapstructure:"rating"`
-	Size       int    `mapstructure:"size"`
-	Text       string `mapstructure:"text"`
-	Type       string `mapstructure:"type"`
-	TypeDesc   string `mapstructure:"type_desc"`
-	URLSecret  string `mapstructure:"url_secret"`
-	URLShared  bool   `mapstructure:"url_shared"`
+	Date       int    `mapstructure:"date" json:"date"`
+	Disk       string `mapstructure:"disk" json:"disk"`
+	Encrypted  bool   `mapstructure:"encrypted" json:"encrypted"`
+	Folder     string `mapstructure:"folder" json:"folder"`
+	Hash       string `mapstructure:"hash" json:"hash,omitempty"`
+	ID         string `mapstructure:"id" json:"id"`
+	Mime       string `mapstructure:"mime" json:"mime"`
+	Name       string `mapstructure:"name" json:"name"`
+	NameCrypto string `mapstructure:"name_crypto" json:"name_crypto"`
+	Rating     int    `mapstructure:"rating" json:"rating"`
+	Size       int    `mapstructure:"size" json:"size"`
+	Text       string `mapstructure:"text" json:"text"`
+	Type       string `mapstructure:"type" json:"type"`
+	TypeDesc   string `mapstructure:"type_desc" json:"type_desc"`
+	URLSecret  string `mapstructure:"url_secret" json:"url_secret"`
+	URLShared  bool   `mapstructure:"url_shared" json:"url_shared"`
 }
 
 type Folder struct {
-	Disk   string `mapstructure:"disk"`
-	ID     string `mapstructure:"id"`
-	Name   string `mapstructure:"name"`
-	Parent string `mapstructure:"parent"`
+	Disk   string `mapstructure:"disk" json:"disk"`
+	ID     string `mapstructure:"id" json:"id"`
+	Name   string `mapstructure:"name" json:"name"`
+	Parent string `mapstructure:"parent" json:"parent"`
 }
 
 type FilesGetResponse struct {
-	Folders    []*Folder `mapstructure:"folders"`
-	HasFiles   bool      `mapstructure:"has_files"`
-	HasFolders bool      `mapstructure:"has_folders"`
-	List       []*File   `mapstructure:"list"`
-	Offset     int       `mapstructure:"offset"`
+	// Count is the total number of files in the folder, not only of this page. It is 0 if the server doesn't report it
+	Count      int       `mapstructure:"count" json:"count"`
+	Folders    []*Folder `mapstructure:"folders" json:"folders"`
+	HasFiles   bool      `mapstructure:"has_files" json:"has_files"`
+	HasFolders bool      `mapstructure:"has_folders" json:"has_folders"`
+	List       []*File   `mapstructure:"list" json:"list"`
+	Offset     int       `mapstructure:"offset" json:"offset"`
 }
 
 type UserInfo struct {
@@ -67,16 +85,45 @@ type DownloadResponse struct {
 type UploadResult struct {
 	FileID string `mapstructure:"file_id"`
 	Ok     bool   `mapstructure:"ok"`
+	// JobID is set instead of FileID if the server processes the file asynchronously
+	JobID string `mapstructure:"job_id"`
 }
 
+// Disk is a disk of the user as returned by disks.get method. Files are stored on disks, and each disk
+// has its own encryption keys
 type Disk struct {
-	CryptoKey string `mapstructure:"crypto_key"`
-	ID        string `mapstructure:"id"`
-	PublicKey string `mapstructure:"public_key"`
-	Title     string `mapstructure:"title"`
+	// ID is the disk id used by all the methods working with disks
+	ID string `mapstructure:"id" json:"id"`
+	// Title is the name of the disk shown to the user
+	Title string `mapstructure:"title" json:"title"`
+	// CryptoKey is the private key of the disk encrypted with the user password, empty for disks without encryption
+	CryptoKey string `mapstructure:"crypto_key" json:"crypto_key,omitempty"`
+	// PublicKey is the public key files are encrypted with, empty for disks without encryption
+	PublicKey string `mapstructure:"public_key" json:"public_key,omitempty"`
+	// Used and Quota are the used and the total space of the disk in bytes, Quota is 0 if it is unknown
+	Used  int64 `mapstructure:"used" json:"used"`
+	Quota int64 `mapstructure:"quota" json:"quota"`
 }
 
+// Encrypted checks if the disk has encryption keys, so files can be encrypted for it
+func (d *Disk) Encrypted() bool {
+	return d.PublicKey != "" || d.CryptoKey != ""
+}
+
+// Free returns the free space of the disk in bytes, or -1 if the quota is unknown
+func (d *Disk) Free() int64 {
+	if d.Quota <= 0 {
+		return -1
+	}
+	if d.Used >= d.Quota {
+		return 0
+	}
+
+	return d.Quota - d.Used
+}
+
+// DisksInfo is the result of disks.get method
 type DisksInfo struct {
-	Count int     `mapstructure:"count"`
-	List  []*Disk `mapstructure:"list"`
+	Count int     `mapstructure:"count" json:"count"`
+	List  []*Disk `mapstructure:"list" json:"list"`
 }
@@ -0,0 +1,79 @@
+package pkg
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDisksInfoParsing(t *testing.T) {
+	body := `{"count":2,"list":[
+		{"id":"disk1","title":"Main","crypto_key":"encrypted-private","public_key":"public","used":1024,"quota":4096},
+		{"id":"disk2","title":"Plain","used":0,"quota":0}
+	]}`
+
+	var result interface{}
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatal(err)
+	}
+	disks, err := MapToStruct[DisksInfo](result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if disks.Count != 2 || len(disks.List) != 2 {
+		t.Fatalf("parsed %d disks (count %d), want 2", len(disks.List), disks.Count)
+	}
+	want := Disk{ID: "disk1", Title: "Main", CryptoKey: "encrypted-private", PublicKey: "public", Used: 1024, Quota: 4096}
+	if *disks.List[0] != want {
+		t.Errorf("disk is %+v, want %+v", *disks.List[0], want)
+	}
+	if disks.List[1].ID != "disk2" || disks.List[1].Encrypted() {
+		t.Errorf("disk is %+v, want the plain disk2", *disks.List[1])
+	}
+}
+
+func TestDiskEncrypted(t *testing.T) {
+	tests := []struct {
+		name string
+		disk Disk
+		want bool
+	}{
+		{name: "both keys", disk: Disk{PublicKey: "public", CryptoKey: "private"}, want: true},
+		{name: "public key only", disk: Disk{PublicKey: "public"}, want: true},
+		{name: "crypto key only", disk: Disk{CryptoKey: "private"}, want: true},
+		{name: "no keys", disk: Disk{}, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.disk.Encrypted(); got != test.want {
+				t.Errorf("Encrypted() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDiskFree(t *testing.T) {
+	tests := []struct {
+		name  string
+		used  int64
+		quota int64
+		want  int64
+	}{
+		{name: "unknown quota", used: 100, quota: 0, want: -1},
+		{name: "negative quota", used: 100, quota: -1, want: -1},
+		{name: "partially used", used: 100, quota: 1000, want: 900},
+		{name: "empty disk", used: 0, quota: 1000, want: 1000},
+		{name: "full disk", used: 1000, quota: 1000, want: 0},
+		{name: "over quota", used: 1500, quota: 1000, want: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			disk := Disk{Used: test.used, Quota: test.quota}
+			if got := disk.Free(); got != test.want {
+				t.Errorf("Free() with %d of %d = %d, want %d", test.used, test.quota, got, test.want)
+			}
+		})
+	}
+}
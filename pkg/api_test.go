@@ -0,0 +1,290 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// redirectTransport sends all the requests of the library to the test server instead of the real API.
+// Requests go through the transport, or through http.DefaultTransport if it is nil
+type redirectTransport struct {
+	target    *url.URL
+	transport http.RoundTripper
+}
+
+func (t redirectTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	request.URL.Scheme = t.target.Scheme
+	request.URL.Host = t.target.Host
+	if t.transport == nil {
+		return http.DefaultTransport.RoundTrip(request)
+	}
+	return t.transport.RoundTrip(request)
+}
+
+// newTestServer starts the server handling all the requests of the library. Retries are disabled,
+// so failures are reported at once. Everything is restored when the test is done
+func newTestServer(t testing.TB, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetHTTPClient(&http.Client{Transport: redirectTransport{target: target}})
+	SetRetryPolicy(RetryPolicy{})
+	t.Cleanup(func() {
+		server.Close()
+		SetHTTPClient(nil)
+		SetRetryPolicy(DefaultRetryPolicy)
+	})
+
+	return server
+}
+
+// rpcRequest is the JSON-RPC request received by the test server
+type rpcRequest struct {
+	Method string                 `json:"method"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// readRPCRequest decodes the JSON-RPC request
+func readRPCRequest(t testing.TB, request *http.Request) rpcRequest {
+	t.Helper()
+
+	var rpc rpcRequest
+	if err := json.NewDecoder(request.Body).Decode(&rpc); err != nil {
+		t.Errorf("failed to decode request: %v", err)
+	}
+
+	return rpc
+}
+
+// writeResult writes the JSON-RPC response with the result
+func writeResult(w http.ResponseWriter, result string) {
+	_, _ = fmt.Fprintf(w, `{"result":%s}`, result)
+}
+
+// writeError writes the JSON-RPC response with the error
+func writeError(w http.ResponseWriter, code int, message string) {
+	_, _ = fmt.Fprintf(w, `{"error":{"code":%d,"message":%q}}`, code, message)
+}
+
+func TestApiRequest(t *testing.T) {
+	var received rpcRequest
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/json-rpc" {
+			t.Errorf("request is sent to %s", r.URL.Path)
+		}
+		received = readRPCRequest(t, r)
+		writeResult(w, `{"id":"user1","name":"User"}`)
+	})
+
+	response, err := ApiRequest("secret", "auth.getMe", map[string]interface{}{"extended": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if received.Method != "auth.getMe" {
+		t.Errorf("method is %q, want auth.getMe", received.Method)
+	}
+	if received.Params["token"] != "secret" || received.Params["extended"] != true {
+		t.Errorf("params are %v", received.Params)
+	}
+	if result, ok := response.ResultMap(); !ok || result["id"] != "user1" {
+		t.Errorf("result is %v", response.Result)
+	}
+}
+
+func TestApiRequestAnonymous(t *testing.T) {
+	var received rpcRequest
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		received = readRPCRequest(t, r)
+		writeResult(w, `{"status":"ok"}`)
+	})
+
+	if _, err := ApiRequest("", "system.health", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := received.Params["token"]; ok {
+		t.Errorf("token is sent in anonymous request: %v", received.Params)
+	}
+}
+
+func TestApiRequestErrorCodes(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         int
+		body           string
+		wantCode       int
+		methodNotFound bool
+		serverError    bool
+	}{
+		{name: "method not found", status: http.StatusOK, body: `{"error":{"code":-32601,"message":"Method not found"}}`, wantCode: -32601, methodNotFound: true},
+		{name: "invalid params", status: http.StatusOK, body: `{"error":{"code":-32602,"message":"Invalid params"}}`, wantCode: -32602},
+		{name: "application error", status: http.StatusOK, body: `{"error":{"code":404,"message":"File not found"}}`, wantCode: 404},
+		{name: "server error without JSON-RPC error", status: http.StatusBadGateway, body: `Bad Gateway`, serverError: true},
+		{name: "server error with JSON-RPC error", status: http.StatusInternalServerError, body: `{"error":{"code":-32000,"message":"Internal"}}`, wantCode: -32000},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				_, _ = fmt.Fprint(w, test.body)
+			})
+
+			response, err := ApiRequest("secret", "files.get", nil)
+			if test.serverError {
+				var serverError *ServerError
+				if !errors.As(err, &serverError) || serverError.StatusCode != test.status {
+					t.Fatalf("error is %v, want ServerError with status %d", err, test.status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if response.Error.Code != test.wantCode {
+				t.Errorf("code is %d, want %d", response.Error.Code, test.wantCode)
+			}
+			if IsMethodNotFound(response) != test.methodNotFound {
+				t.Errorf("IsMethodNotFound is %v, want %v", !test.methodNotFound, test.methodNotFound)
+			}
+			if ResponseError(response) == nil {
+				t.Error("ResponseError is nil")
+			}
+		})
+	}
+}
+
+func TestCallMethodNotSupported(t *testing.T) {
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, methodNotFoundCode, "Method not found")
+	})
+
+	_, err := FindFilesByHash("secret", "disk1", "abc")
+	if !errors.Is(err, ErrMethodNotSupported) {
+		t.Fatalf("error is %v, want ErrMethodNotSupported", err)
+	}
+}
+
+func TestApiRequestRetriesServerErrors(t *testing.T) {
+	attempts := 0
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		writeResult(w, `{"ok":true}`)
+	})
+	SetRetryPolicy(RetryPolicy{MaxAttempts: 3})
+
+	if _, err := ApiRequest("secret", "files.getById", nil); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 {
+		t.Errorf("request is sent %d times, want 3", attempts)
+	}
+}
+
+func TestRpcRequestBody(t *testing.T) {
+	tests := []struct {
+		name      string
+		token     string
+		params    map[string]interface{}
+		wantToken interface{}
+		hasToken  bool
+	}{
+		{name: "token is added", token: "secret", params: map[string]interface{}{"disk": "disk1"}, wantToken: "secret", hasToken: true},
+		{name: "nil params get the token", token: "secret", wantToken: "secret", hasToken: true},
+		{name: "empty token is omitted", token: "", params: map[string]interface{}{"disk": "disk1"}},
+		{name: "empty token with nil params", token: ""},
+		{name: "token in params is kept", token: "secret", params: map[string]interface{}{"token": "other"}, wantToken: "other", hasToken: true},
+		{name: "empty token in params is kept", token: "secret", params: map[string]interface{}{"token": ""}, wantToken: "", hasToken: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			body := rpcRequestBody(test.token, "files.get", test.params)
+			if body["method"] != "files.get" {
+				t.Errorf("method is %v", body["method"])
+			}
+
+			params, ok := body["params"].(map[string]interface{})
+			if !ok {
+				t.Fatalf("params are %T, want a map", body["params"])
+			}
+			token, hasToken := params["token"]
+			if hasToken != test.hasToken || token != test.wantToken {
+				t.Errorf("token is %v (set %v), want %v (set %v)", token, hasToken, test.wantToken, test.hasToken)
+			}
+		})
+	}
+}
+
+func TestIsPong(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   bool
+	}{
+		{name: "pong", status: http.StatusOK, body: pongPayload, want: true},
+		{name: "pong with newline", status: http.StatusOK, body: pongPayload + "\n", want: true},
+		{name: "unexpected payload", status: http.StatusOK, body: "<html>Maintenance</html>", want: false},
+		{name: "empty payload", status: http.StatusOK, body: "", want: false},
+		{name: "pong with error status", status: http.StatusServiceUnavailable, body: pongPayload, want: false},
+		{name: "redirect", status: http.StatusFound, body: pongPayload, want: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isPong(test.status, []byte(test.body)); got != test.want {
+				t.Errorf("isPong(%d, %q) = %v, want %v", test.status, test.body, got, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckApiAlive(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr error
+	}{
+		{name: "alive", status: http.StatusOK, body: pongPayload},
+		{name: "maintenance page", status: http.StatusOK, body: "<html>Maintenance</html>", wantErr: ErrNotPong},
+		{name: "server error", status: http.StatusBadGateway, body: pongPayload, wantErr: ErrNotPong},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/ping" {
+					t.Errorf("ping is sent to %s", r.URL.Path)
+				}
+				w.WriteHeader(test.status)
+				_, _ = fmt.Fprint(w, test.body)
+			})
+
+			err := CheckApiAlive()
+			if test.wantErr == nil && err != nil {
+				t.Fatalf("CheckApiAlive failed: %v", err)
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Fatalf("error is %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
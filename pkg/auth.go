@@ -12,7 +12,7 @@ func GetUserID(token string) (string, error) {
 	}
 	if request.Error.Code != 0 {
 		currentLogger("Failed to get user: %s", request.Error.Message)
-		return "", errors.New(request.Error.Message)
+		return "", ResponseError(request)
 	}
 
 	user, err := MapToStruct[UserInfo](request.Result)
@@ -0,0 +1,45 @@
+package pkg
+
+import (
+	"io"
+	"sync"
+)
+
+// DefaultCopyBufferSize is the size of the buffer used to copy transferred content, the same as io.Copy uses
+const DefaultCopyBufferSize = 32 * 1024
+
+// copyBufferSize is the singleton with the size of copy buffers
+var copyBufferSize = DefaultCopyBufferSize
+
+// copyBufferPool keeps copy buffers of copyBufferSize for reuse, so concurrent transfers don't allocate them every time
+var copyBufferPool = newCopyBufferPool(DefaultCopyBufferSize)
+
+// newCopyBufferPool creates the pool of copy buffers of the size
+func newCopyBufferPool(size int) *sync.Pool {
+	return &sync.Pool{New: func() interface{} {
+		buffer := make([]byte, size)
+		return &buffer
+	}}
+}
+
+// SetCopyBufferSize sets the size of the buffer used to copy uploaded and downloaded content.
+// Bigger buffers may be faster on high-latency, high-bandwidth links. Not positive size means the default one
+func SetCopyBufferSize(size int) {
+	if size <= 0 {
+		size = DefaultCopyBufferSize
+	}
+
+	copyBufferSize = size
+	copyBufferPool = newCopyBufferPool(size)
+}
+
+// CopyBuffered copies the content like io.Copy, but through the buffer of the configured size.
+// The reader and the writer are wrapped, so io.ReaderFrom and io.WriterTo shortcuts (which would use
+// their own 32KB buffers, like os.File does for network streams) can't bypass the buffer
+func CopyBuffered(dst io.Writer, src io.Reader) (int64, error) {
+	pool := copyBufferPool
+	buffer := pool.Get().(*[]byte)
+	defer pool.Put(buffer)
+
+	return io.CopyBuffer(struct{ io.Writer }{dst}, struct{ io.Reader }{src}, *buffer)
+}
@@ -0,0 +1,143 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCopyBuffered(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 10000)
+	tests := []struct {
+		bufferSize int
+		wantSize   int
+	}{
+		{bufferSize: 0, wantSize: DefaultCopyBufferSize},
+		{bufferSize: -1, wantSize: DefaultCopyBufferSize},
+		{bufferSize: 7, wantSize: 7},
+		{bufferSize: 4 * 1024, wantSize: 4 * 1024},
+		{bufferSize: 1024 * 1024, wantSize: 1024 * 1024},
+	}
+	defer SetCopyBufferSize(DefaultCopyBufferSize)
+
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.bufferSize), func(t *testing.T) {
+			SetCopyBufferSize(test.bufferSize)
+			if copyBufferSize != test.wantSize {
+				t.Errorf("buffer size is %d, want %d", copyBufferSize, test.wantSize)
+			}
+
+			var out bytes.Buffer
+			numBytes, err := CopyBuffered(&out, bytes.NewReader(content))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if numBytes != int64(len(content)) || !bytes.Equal(out.Bytes(), content) {
+				t.Errorf("copied %d bytes, want %d", numBytes, len(content))
+			}
+		})
+	}
+}
+
+func BenchmarkCopyBuffered(b *testing.B) {
+	content := bytes.Repeat([]byte{'x'}, 8*1024*1024)
+	defer SetCopyBufferSize(DefaultCopyBufferSize)
+
+	for _, size := range []int{4 * 1024, 32 * 1024, 256 * 1024, 1024 * 1024} {
+		b.Run(fmt.Sprintf("%dKB", size/1024), func(b *testing.B) {
+			SetCopyBufferSize(size)
+			b.SetBytes(int64(len(content)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := CopyBuffered(io.Discard, bytes.NewReader(content)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDownloadBufferSize(b *testing.B) {
+	content := strings.Repeat("x", 8*1024*1024)
+	defer SetCopyBufferSize(DefaultCopyBufferSize)
+
+	for _, size := range []int{4 * 1024, 32 * 1024, 256 * 1024, 1024 * 1024} {
+		b.Run(fmt.Sprintf("%dKB", size/1024), func(b *testing.B) {
+			newDownloadServer(b, "big.bin", content)
+			SetCopyBufferSize(size)
+			b.SetBytes(int64(len(content)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := DownloadFileWithOptions(context.Background(), "secret", "file1", io.Discard, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkConcurrentSmallTransfers(b *testing.B) {
+	content := strings.Repeat("x", 4*1024)
+	benchmarks := []struct {
+		name     string
+		server   func(b *testing.B) *httptest.Server
+		transfer func() error
+	}{
+		{
+			name: "upload",
+			server: func(b *testing.B) *httptest.Server {
+				return newTestServer(b, func(w http.ResponseWriter, r *http.Request) {
+					_, _ = io.Copy(io.Discard, r.Body)
+					writeResult(w, `{"ok":true,"file_id":"file1"}`)
+				})
+			},
+			transfer: func() error {
+				_, err := UploadFileWithOptions(context.Background(), "secret", "small.txt", strings.NewReader(content), nil)
+				return err
+			},
+		},
+		{
+			name: "download",
+			server: func(b *testing.B) *httptest.Server {
+				return newDownloadServer(b, "small.txt", content)
+			},
+			transfer: func() error {
+				_, _, err := DownloadFileWithOptions(context.Background(), "secret", "file1", io.Discard, nil)
+				return err
+			},
+		},
+	}
+
+	for _, benchmark := range benchmarks {
+		b.Run(benchmark.name, func(b *testing.B) {
+			target, err := url.Parse(benchmark.server(b).URL)
+			if err != nil {
+				b.Fatal(err)
+			}
+			// Connections are kept alive, so the benchmark measures transfers rather than dialing
+			transport := newTransport(TransportSettings{MaxIdleConns: 64})
+			defer transport.CloseIdleConnections()
+			SetHTTPClient(&http.Client{Transport: redirectTransport{target: target, transport: transport}})
+
+			b.ReportAllocs()
+			b.SetParallelism(4)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := benchmark.transfer(); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
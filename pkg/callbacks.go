@@ -0,0 +1,163 @@
+package pkg
+
+import (
+	"io"
+	"sync"
+)
+
+// TransferEvent describes an upload or a download reported to Callbacks
+type TransferEvent struct {
+	// Kind is "upload" or "download"
+	Kind string
+	// Name is the name of the file, FileID is empty for uploads until they are complete
+	Name   string
+	FileID string
+	// Total is the expected number of bytes or -1 if it is unknown
+	Total int64
+}
+
+// Callbacks are functions called by the library on transfers and failures, so applications can show their own
+// progress and collect metrics without parsing log messages. Every callback is optional.
+// Callbacks are called synchronously, so they should return quickly
+type Callbacks struct {
+	// OnTransferStart is called before the content of a file is transferred
+	OnTransferStart func(event TransferEvent)
+	// OnProgress is called with the number of bytes of the file content transferred so far
+	OnProgress func(event TransferEvent, done int64)
+	// OnTransferComplete is called when the transfer is finished, err is nil on success
+	OnTransferComplete func(event TransferEvent, done int64, err error)
+	// OnRetry is called before the failed operation is tried again
+	OnRetry func(operation string, attempt int, err error)
+	// OnError is called when an API method or a transfer fails
+	OnError func(operation string, err error)
+}
+
+// currentCallbacks is the singleton with the callbacks used by the library
+var currentCallbacks Callbacks
+
+// callbacksMutex protects currentCallbacks, because transfers may run in several goroutines
+var callbacksMutex sync.RWMutex
+
+// SetCallbacks sets the callbacks for the library. Pass empty Callbacks to disable them
+func SetCallbacks(callbacks Callbacks) {
+	callbacksMutex.Lock()
+	defer callbacksMutex.Unlock()
+	currentCallbacks = callbacks
+}
+
+// getCallbacks returns the current callbacks
+func getCallbacks() Callbacks {
+	callbacksMutex.RLock()
+	defer callbacksMutex.RUnlock()
+	return currentCallbacks
+}
+
+// notifyRetry calls OnRetry if it is set
+func notifyRetry(operation string, attempt int, err error) {
+	if callback := getCallbacks().OnRetry; callback != nil {
+		callback(operation, attempt, err)
+	}
+}
+
+// notifyError calls OnError if it is set
+func notifyError(operation string, err error) {
+	if callback := getCallbacks().OnError; callback != nil {
+		callback(operation, err)
+	}
+}
+
+// transfer reports the progress of a single upload or download to the callbacks
+type transfer struct {
+	callbacks Callbacks
+	event     TransferEvent
+	mutex     sync.Mutex
+	done      int64
+}
+
+// startTransfer calls OnTransferStart and returns the transfer to report the progress of
+func startTransfer(event TransferEvent) *transfer {
+	t := &transfer{callbacks: getCallbacks(), event: event}
+	if t.callbacks.OnTransferStart != nil {
+		t.callbacks.OnTransferStart(event)
+	}
+
+	return t
+}
+
+// add counts the transferred bytes and calls OnProgress. It is safe for concurrent use
+func (t *transfer) add(n int) {
+	if n <= 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.done += int64(n)
+	if t.callbacks.OnProgress != nil {
+		t.callbacks.OnProgress(t.event, t.done)
+	}
+}
+
+// complete calls OnTransferComplete, and OnError if the transfer failed
+func (t *transfer) complete(fileId string, err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if fileId != "" {
+		t.event.FileID = fileId
+	}
+	if t.callbacks.OnTransferComplete != nil {
+		t.callbacks.OnTransferComplete(t.event, t.done, err)
+	}
+	if err != nil && t.callbacks.OnError != nil {
+		t.callbacks.OnError(t.event.Kind, err)
+	}
+}
+
+// reader returns the reader counting the bytes read from r
+func (t *transfer) reader(r io.Reader) io.Reader {
+	return &transferReader{reader: r, transfer: t}
+}
+
+// writer returns the writer counting the bytes written to w
+func (t *transfer) writer(w io.Writer) io.Writer {
+	return &transferWriter{writer: w, transfer: t}
+}
+
+// writerAt returns the writer counting the bytes written to w at any offset
+func (t *transfer) writerAt(w io.WriterAt) io.WriterAt {
+	return &transferWriterAt{writer: w, transfer: t}
+}
+
+type transferReader struct {
+	reader   io.Reader
+	transfer *transfer
+}
+
+func (r *transferReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.transfer.add(n)
+	return n, err
+}
+
+type transferWriter struct {
+	writer   io.Writer
+	transfer *transfer
+}
+
+func (w *transferWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.transfer.add(n)
+	return n, err
+}
+
+type transferWriterAt struct {
+	writer   io.WriterAt
+	transfer *transfer
+}
+
+func (w *transferWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	n, err := w.writer.WriteAt(p, off)
+	w.transfer.add(n)
+	return n, err
+}
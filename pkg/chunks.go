@@ -0,0 +1,58 @@
+package pkg
+
+import (
+	"io"
+	"os"
+)
+
+// DefaultChunkSize is the size of upload chunks if it is not set explicitly
+const DefaultChunkSize int64 = 8 << 20
+
+// sizedReader is implemented by in-memory readers like bytes.Reader and strings.Reader
+type sizedReader interface {
+	Len() int
+}
+
+// DetectSize returns the number of bytes left in the reader, or -1 if it can't be known without reading,
+// like for pipes and network streams. Regular files are measured by Stat and their current offset
+func DetectSize(reader io.Reader) int64 {
+	switch r := reader.(type) {
+	case *os.File:
+		info, err := r.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return -1
+		}
+
+		offset, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+
+		return info.Size() - offset
+	case sizedReader:
+		return int64(r.Len())
+	default:
+		return -1
+	}
+}
+
+// ChunkPlan describes how the content is split into chunks. Size and Chunks are -1 if the size is unknown
+type ChunkPlan struct {
+	Size      int64
+	ChunkSize int64
+	Chunks    int64
+}
+
+// PlanChunks plans the chunks of the reader content. Chunk size is DefaultChunkSize if it is not positive
+func PlanChunks(reader io.Reader, chunkSize int64) ChunkPlan {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	plan := ChunkPlan{Size: DetectSize(reader), ChunkSize: chunkSize, Chunks: -1}
+	if plan.Size >= 0 {
+		plan.Chunks = (plan.Size + chunkSize - 1) / chunkSize
+	}
+
+	return plan
+}
@@ -0,0 +1,105 @@
+package pkg
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// openTestFile creates the file with the content and opens it at the offset
+func openTestFile(t *testing.T, content string, offset int64) *os.File {
+	t.Helper()
+
+	filename := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = file.Close()
+	})
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+// openTestPipe returns the read end of the pipe with the content written to it
+func openTestPipe(t *testing.T, content string) *os.File {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = reader.Close()
+	})
+	go func() {
+		_, _ = writer.WriteString(content)
+		_ = writer.Close()
+	}()
+
+	return reader
+}
+
+func TestDetectSize(t *testing.T) {
+	tests := []struct {
+		name   string
+		reader func(t *testing.T) io.Reader
+		want   int64
+	}{
+		{name: "file", reader: func(t *testing.T) io.Reader { return openTestFile(t, "hello world", 0) }, want: 11},
+		{name: "file with offset", reader: func(t *testing.T) io.Reader { return openTestFile(t, "hello world", 6) }, want: 5},
+		{name: "file read to the end", reader: func(t *testing.T) io.Reader { return openTestFile(t, "hello world", 11) }, want: 0},
+		{name: "zero-size file", reader: func(t *testing.T) io.Reader { return openTestFile(t, "", 0) }, want: 0},
+		{name: "pipe", reader: func(t *testing.T) io.Reader { return openTestPipe(t, "hello world") }, want: -1},
+		{name: "bytes reader", reader: func(t *testing.T) io.Reader { return bytes.NewReader([]byte("hello")) }, want: 5},
+		{name: "partially read bytes reader", reader: func(t *testing.T) io.Reader {
+			reader := bytes.NewReader([]byte("hello"))
+			_, _ = reader.Read(make([]byte, 2))
+			return reader
+		}, want: 3},
+		{name: "strings reader", reader: func(t *testing.T) io.Reader { return strings.NewReader("") }, want: 0},
+		{name: "stream", reader: func(t *testing.T) io.Reader { return io.MultiReader(strings.NewReader("hello")) }, want: -1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DetectSize(test.reader(t)); got != test.want {
+				t.Errorf("DetectSize() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPlanChunks(t *testing.T) {
+	tests := []struct {
+		name      string
+		reader    func(t *testing.T) io.Reader
+		chunkSize int64
+		want      ChunkPlan
+	}{
+		{name: "file in one chunk", reader: func(t *testing.T) io.Reader { return openTestFile(t, "hello world", 0) }, chunkSize: 16, want: ChunkPlan{Size: 11, ChunkSize: 16, Chunks: 1}},
+		{name: "file with offset", reader: func(t *testing.T) io.Reader { return openTestFile(t, "hello world", 1) }, chunkSize: 4, want: ChunkPlan{Size: 10, ChunkSize: 4, Chunks: 3}},
+		{name: "exact chunks", reader: func(t *testing.T) io.Reader { return bytes.NewReader(make([]byte, 8)) }, chunkSize: 4, want: ChunkPlan{Size: 8, ChunkSize: 4, Chunks: 2}},
+		{name: "zero-size file", reader: func(t *testing.T) io.Reader { return openTestFile(t, "", 0) }, chunkSize: 4, want: ChunkPlan{Size: 0, ChunkSize: 4, Chunks: 0}},
+		{name: "pipe", reader: func(t *testing.T) io.Reader { return openTestPipe(t, "hello world") }, chunkSize: 4, want: ChunkPlan{Size: -1, ChunkSize: 4, Chunks: -1}},
+		{name: "default chunk size", reader: func(t *testing.T) io.Reader { return bytes.NewReader(make([]byte, 10)) }, chunkSize: 0, want: ChunkPlan{Size: 10, ChunkSize: DefaultChunkSize, Chunks: 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := PlanChunks(test.reader(t), test.chunkSize); got != test.want {
+				t.Errorf("PlanChunks() = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
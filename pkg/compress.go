@@ -0,0 +1,99 @@
+package pkg
+
+import (
+	"bufio"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// CompressedSuffix marks files compressed by the client before upload. The content of such files is gzip
+// (encrypted after compression if the disk is encrypted), so they are decompressed after download.
+// The suffix ends with ".gz", so downloaded raw files can be decompressed by any gzip tool
+const CompressedSuffix = ".kt.gz"
+
+// CompressedName returns the name of the compressed file for the original name
+func CompressedName(name string) string {
+	return name + CompressedSuffix
+}
+
+// IsCompressedName checks if the file name has the compression marker
+func IsCompressedName(name string) bool {
+	return strings.HasSuffix(name, CompressedSuffix) && len(name) > len(CompressedSuffix)
+}
+
+// OriginalName returns the name of the file before compression, names without the marker are returned as-is
+func OriginalName(name string) string {
+	if !IsCompressedName(name) {
+		return name
+	}
+
+	return strings.TrimSuffix(name, CompressedSuffix)
+}
+
+// decompressDownloads is the singleton which enables decompression of files compressed by the client on download
+var decompressDownloads = true
+
+// SetDecompressDownloads sets if files with the compression marker are decompressed on download (enabled by default)
+func SetDecompressDownloads(enabled bool) {
+	decompressDownloads = enabled
+}
+
+// DownloadedName returns the name of the file content written by DownloadFile:
+// the original name for compressed files if decompression is enabled, the name as-is otherwise
+func DownloadedName(name string) string {
+	if !decompressDownloads {
+		return name
+	}
+
+	return OriginalName(name)
+}
+
+// CompressReader returns the reader of gzip-compressed content of the reader. Compression is done
+// on the fly in a goroutine, so the content is never fully loaded into memory
+func CompressReader(reader io.Reader) io.ReadCloser {
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		gzipWriter := gzip.NewWriter(pipeWriter)
+		_, err := CopyBuffered(gzipWriter, reader)
+		if closeErr := gzipWriter.Close(); err == nil {
+			err = closeErr
+		}
+		_ = pipeWriter.CloseWithError(err)
+	}()
+
+	return pipeReader
+}
+
+// compressedExtensions are extensions of formats which are already compressed, so compressing them again is useless
+var compressedExtensions = map[string]bool{
+	".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".zip": true, ".7z": true, ".rar": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".heic": true,
+	".mp3": true, ".ogg": true, ".flac": true, ".aac": true, ".mp4": true, ".mkv": true, ".webm": true, ".mov": true, ".avi": true,
+	".docx": true, ".xlsx": true, ".pptx": true, ".odt": true, ".jar": true, ".apk": true,
+}
+
+// IsAlreadyCompressed checks if the content is already compressed, by the name extension and by the first bytes.
+// The returned reader must be used instead of the original one, because the first bytes are consumed by the check
+func IsAlreadyCompressed(name string, reader io.Reader) (bool, io.Reader) {
+	if compressedExtensions[strings.ToLower(path.Ext(name))] {
+		return true, reader
+	}
+
+	buffered := bufio.NewReader(reader)
+	head, _ := buffered.Peek(512)
+	contentType := http.DetectContentType(head)
+	switch {
+	case contentType == "application/x-gzip", contentType == "application/zip",
+		contentType == "application/x-rar-compressed", contentType == "application/wasm":
+		return true, buffered
+	case strings.HasPrefix(contentType, "video/"), strings.HasPrefix(contentType, "audio/"):
+		return true, buffered
+	case strings.HasPrefix(contentType, "image/") && contentType != "image/bmp" && contentType != "image/x-icon":
+		return true, buffered
+	}
+
+	return false, buffered
+}
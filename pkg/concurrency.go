@@ -0,0 +1,65 @@
+package pkg
+
+import (
+	"context"
+	"golang.org/x/sync/semaphore"
+	"sync"
+)
+
+// concurrencyLimit is the semaphore shared by all API calls and transfers of the process. There is no limit if it is nil
+var concurrencyLimit *semaphore.Weighted
+
+// concurrencyMutex guards concurrencyLimit
+var concurrencyMutex sync.Mutex
+
+// SetConcurrency limits the number of requests (API calls, transfers and parts of parallel downloads) running at once
+// in the whole process, regardless of which function started them. Zero or negative limit disables the limit
+func SetConcurrency(limit int) {
+	concurrencyMutex.Lock()
+	defer concurrencyMutex.Unlock()
+
+	if limit <= 0 {
+		concurrencyLimit = nil
+		return
+	}
+
+	concurrencyLimit = semaphore.NewWeighted(int64(limit))
+}
+
+// currentConcurrencyLimit returns the semaphore set by SetConcurrency
+func currentConcurrencyLimit() *semaphore.Weighted {
+	concurrencyMutex.Lock()
+	defer concurrencyMutex.Unlock()
+	return concurrencyLimit
+}
+
+// sharedSlotKey marks the context of a request which runs under the slot held by another one
+type sharedSlotKey struct{}
+
+// withSharedSlot returns the context of requests which are a part of another limited request, like the upload
+// of the streamed copy fed by the download. They don't acquire their own slot, so they can't block the other one
+func withSharedSlot(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sharedSlotKey{}, true)
+}
+
+// AcquireConcurrency blocks until the operation of the weight may run under the limit set by SetConcurrency
+// or the context is done. The returned function releases the weight, it must be called when the operation is done
+// and may be called more than once. The library acquires the slot for every request by itself, so applications
+// should acquire only around their own concurrent work which doesn't call the library
+func AcquireConcurrency(ctx context.Context, weight int64) (release func(), err error) {
+	limit := currentConcurrencyLimit()
+	if limit == nil || ctx.Value(sharedSlotKey{}) != nil {
+		return func() {}, nil
+	}
+
+	if err = limit.Acquire(ctx, weight); err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			limit.Release(weight)
+		})
+	}, nil
+}
@@ -0,0 +1,130 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CopyFile copies a file to another disk and/or folder and returns the new file id.
+// The server-side copy is used when it is possible, so the content is not transferred through the client.
+// If the server doesn't support copying, or the source is encrypted with a key different from the destination one,
+// the file is downloaded (and decrypted) with the source crypto info and uploaded (and encrypted) with the destination one.
+// Destination crypto info can be nil if the destination disk is not encrypted.
+func CopyFile(token string, fileId string, disk string, folder string, source *CryptoInfo, destination *CryptoInfo) (string, error) {
+	fileInfo, err := GetFile(token, fileId)
+	if err != nil {
+		return "", err
+	}
+
+	sameKeys := true
+	if fileInfo.Encrypted {
+		sourceDisk, _, err := GetUserDisk(token, fileInfo.Disk)
+		if err != nil {
+			return "", err
+		}
+
+		targetDisk, _, err := GetUserDisk(token, disk)
+		if err != nil {
+			return "", err
+		}
+
+		sameKeys = sourceDisk.PublicKey == targetDisk.PublicKey
+	}
+
+	if sameKeys {
+		newFileId, err := copyFileOnServer(token, fileId, disk, folder)
+		if err == nil {
+			return newFileId, nil
+		}
+		if !errors.Is(err, ErrMethodNotSupported) {
+			return "", err
+		}
+
+		currentLogger("Server-side copy is not supported, copying through the client")
+	} else {
+		currentLogger("Source and destination keys differ, the file will be re-encrypted")
+	}
+
+	return copyFileStreamed(token, fileInfo, disk, folder, source, destination)
+}
+
+// MoveFile moves a file to another disk and/or folder and returns its id, which changes if the file is copied.
+// The server-side move is used when it is supported. Otherwise, the file is copied by CopyFile
+// (with the same crypto info rules) and the source is moved to the trash
+func MoveFile(token string, fileId string, disk string, folder string, source *CryptoInfo, destination *CryptoInfo) (string, error) {
+	_, err := callMethod(token, "files.move", map[string]interface{}{"file": fileId, "disk": disk, "folder": folder})
+	if err == nil {
+		currentLogger("File moved on server")
+		return fileId, nil
+	}
+	if !errors.Is(err, ErrMethodNotSupported) {
+		return "", err
+	}
+
+	currentLogger("Server-side move is not supported, copying and deleting the source")
+	newFileId, err := CopyFile(token, fileId, disk, folder, source, destination)
+	if err != nil {
+		return "", err
+	}
+
+	if err := DeleteFile(token, fileId, false); err != nil {
+		return "", fmt.Errorf("file is copied as %s, but the source is not deleted: %w", newFileId, err)
+	}
+
+	return newFileId, nil
+}
+
+// copyFileOnServer asks the server to copy the file without transferring its content
+func copyFileOnServer(token string, fileId string, disk string, folder string) (string, error) {
+	response, err := callMethod(token, "files.copy", map[string]interface{}{"file": fileId, "disk": disk, "folder": folder})
+	if err != nil {
+		return "", err
+	}
+
+	result, err := MapToStruct[UploadResult](response.Result)
+	if err != nil {
+		return "", err
+	}
+	if result.FileID == "" && result.JobID != "" {
+		result.FileID, err = waitJobFile(context.Background(), token, result.JobID)
+		if err != nil {
+			return "", err
+		}
+	}
+	if result.FileID == "" {
+		return "", errors.New("response file_id is empty")
+	}
+
+	currentLogger("File copied on server. File ID: %s", result.FileID)
+	return result.FileID, nil
+}
+
+// copyFileStreamed downloads the file and uploads it at the same time using a pipe, without any temporary files.
+// Compressed files are copied raw, so the content of the copy matches its compressed name.
+// The upload is fed by the download, so it runs under the concurrency slot of the download
+// and its keys are fetched before the download starts, otherwise -concurrency=1 would block them forever
+func copyFileStreamed(token string, fileInfo *File, disk string, folder string, source *CryptoInfo, destination *CryptoInfo) (string, error) {
+	if destination != nil && !destination.IsCryptoReadyFor(disk) {
+		if err := destination.TryGetReady(token, disk); err != nil {
+			return "", fmt.Errorf("failed to encrypt file: %w", err)
+		}
+	}
+
+	reader, writer := io.Pipe()
+
+	go func() {
+		_, _, err := DownloadFileWithOptions(context.Background(), token, fileInfo.ID, writer, &DownloadOptions{CryptoInfo: source, Raw: true})
+		_ = writer.CloseWithError(err)
+	}()
+
+	newFileId, err := UploadFileWithOptions(withSharedSlot(context.Background()), token, fileInfo.Name, reader, &UploadOptions{Disk: disk, Folder: folder, CryptoInfo: destination})
+	// Unblock the downloading goroutine if the upload stopped reading earlier
+	_ = reader.CloseWithError(io.ErrClosedPipe)
+	if err != nil {
+		return "", fmt.Errorf("failed to copy file: %w", err)
+	}
+
+	return newFileId, nil
+}
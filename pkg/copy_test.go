@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCopyFileStreamedCompressed(t *testing.T) {
+	var compressed bytes.Buffer
+	if _, err := compressed.ReadFrom(CompressReader(strings.NewReader("hello world"))); err != nil {
+		t.Fatal(err)
+	}
+	name := CompressedName("notes.txt")
+
+	tests := []struct {
+		name       string
+		decompress bool
+	}{
+		{name: "decompression enabled", decompress: true},
+		{name: "decompression disabled", decompress: false},
+	}
+	defer SetDecompressDownloads(true)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			SetDecompressDownloads(test.decompress)
+
+			var uploadedName, uploadedContent string
+			var serverURL string
+			server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/content/file1":
+					http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(compressed.Bytes()))
+					return
+				case "/upload":
+					uploadedName, uploadedContent, _ = readUploadedFile(t, r)
+					writeResult(w, `{"ok":true,"file_id":"file2"}`)
+					return
+				}
+
+				switch readRPCRequest(t, r).Method {
+				case "files.getById":
+					writeResult(w, fmt.Sprintf(`{"count":1,"list":[{"id":"file1","name":%q,"size":%d}]}`, name, compressed.Len()))
+				case "files.download":
+					writeResult(w, fmt.Sprintf(`{"url":%q}`, serverURL+"/content/file1"))
+				default:
+					writeError(w, methodNotFoundCode, "Method not found")
+				}
+			})
+			serverURL = server.URL
+
+			fileId, err := CopyFile("secret", "file1", "disk2", "", nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fileId != "file2" {
+				t.Errorf("file id is %q, want file2", fileId)
+			}
+			if uploadedName != name {
+				t.Errorf("copy is named %q, want %q", uploadedName, name)
+			}
+			if uploadedContent != compressed.String() {
+				t.Errorf("copy content is %q, want the compressed content", uploadedContent)
+			}
+		})
+	}
+}
@@ -13,12 +13,17 @@ type CryptoInfo struct {
 	EncryptedCryptoKey string
 	// RawCryptoKey is the decrypted crypto key.
 	//You can use it for encryption/decryption.
-	//It usually is not provided by the server, you should decrypt EncryptedCryptoKey with a password
+	//It usually is not provided by the server, you should decrypt EncryptedCryptoKey with a password.
+	//If it is set, the password key derivation is bypassed, and the password is only used to unlock the key if it is locked
 	RawCryptoKey string
 	// PublicKey is the public key of the user. It is used for encryption and signature verification
 	PublicKey string
 	// Password is used to decrypt the EncryptedCryptoKey, also it is used as passphrase for the private key
 	Password string
+	// DiskPasswords are passwords of disks which differ from the default Password
+	DiskPasswords map[string]string
+	// Disk is the id of the disk the keys belong to. Empty disk means the keys are used for any disk
+	Disk string
 }
 
 // IsCryptoReady checks if the CryptoInfo is ready for encryption/decryption.
@@ -27,38 +32,61 @@ func (c *CryptoInfo) IsCryptoReady() bool {
 	return c.RawCryptoKey != ""
 }
 
-// TryGetReady tries to get the CryptoInfo ready for encryption/decryption.
-// It tries to decrypt the key with the password.
+// IsCryptoReadyFor checks if the CryptoInfo is ready for encryption/decryption of files of the disk.
+// Keys of another disk are not ready, so files of several disks can be processed with the same CryptoInfo
+func (c *CryptoInfo) IsCryptoReadyFor(disk string) bool {
+	return c.IsCryptoReady() && (c.Disk == "" || disk == "" || c.Disk == disk)
+}
+
+// PasswordFor returns the password of the disk, falling back to the default Password
+func (c *CryptoInfo) PasswordFor(disk string) string {
+	if password, ok := c.DiskPasswords[disk]; ok {
+		return password
+	}
+
+	return c.Password
+}
+
+// TryGetReady tries to get the CryptoInfo ready for encryption/decryption of files of the disk.
+// It tries to decrypt the key of the disk with the password of the disk.
 func (c *CryptoInfo) TryGetReady(token string, disk string) error {
-	if c.IsCryptoReady() {
+	if c.IsCryptoReadyFor(disk) {
 		return nil
 	}
 
-	if c.Password == "" && c.RawCryptoKey == "" {
+	password := c.PasswordFor(disk)
+	if password == "" {
+		password = ScanPassword("Crypto password: ")
+		// The password is kept, so it is asked only once per run
+		c.Password = password
+	}
+	if password == "" {
 		// Crypto data is provided, but password and key are empty
-		return errors.New("no password or decrypted key provided (use KT_CLI_PASSWD env or -passwd / -act.keys flag")
-	} else if c.RawCryptoKey == "" {
-		// Password is provided, but the key is empty. We need to get and decrypt the key
-		crypt, err := GetCryptoInfo(token, disk, c.Password)
-		if err != nil {
-			return fmt.Errorf("failed to get crypto info: %w", err)
-		}
+		return errors.New("no password or decrypted key provided (use KT_CLI_PASSWD env or -passwd-file / -passwd-env / -act.keys flag)")
+	}
 
-		*c = *crypt
-	} else {
-		return errors.New("no any data provided")
+	// Password is provided, but the key of the disk is not decrypted yet. We need to get and decrypt the key
+	crypt, err := GetCryptoInfo(token, disk, password)
+	if err != nil {
+		return fmt.Errorf("failed to get crypto info: %w", err)
 	}
 
+	diskPasswords, defaultPassword := c.DiskPasswords, c.Password
+	*c = *crypt
+	c.DiskPasswords = diskPasswords
+	c.Password = defaultPassword
+
 	return nil
 }
 
 // GetCryptoInfo gets the CryptoInfo from the server.
 // It decrypts the crypto key if it is encrypted and a password is provided
 func GetCryptoInfo(token string, disk string, password string) (*CryptoInfo, error) {
-	_, cryptoInfo, err := GetUserDisk(token, disk)
+	diskInfo, cryptoInfo, err := GetUserDisk(token, disk)
 	if err != nil {
 		return nil, err
 	}
+	cryptoInfo.Disk = diskInfo.ID
 
 	if password != "" {
 		cryptoInfo.Password = password
@@ -77,23 +105,40 @@ func GetCryptoInfo(token string, disk string, password string) (*CryptoInfo, err
 	return cryptoInfo, nil
 }
 
-// GetKeyRings gets the public and private key rings from the armored keys
+// GetKeyRings gets the public and private key rings from the armored keys.
+// The private key is unlocked with the password, unless it is not protected by a passphrase at all.
+// If the public key is empty, it is taken from the private key
 func GetKeyRings(publicKey string, privateKey string, passwd []byte) (public *crypto.KeyRing, private *crypto.KeyRing, err error) {
 	privateKeyObj, err := crypto.NewKeyFromArmored(privateKey)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	unlockedKeyObj, err := privateKeyObj.Unlock(passwd)
+	locked, err := privateKeyObj.IsLocked()
 	if err != nil {
 		return nil, nil, err
 	}
 
+	unlockedKeyObj := privateKeyObj
+	if locked {
+		unlockedKeyObj, err = privateKeyObj.Unlock(passwd)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	private, err = crypto.NewKeyRing(unlockedKeyObj)
 	if err != nil {
 		return nil, nil, err
 	}
 
+	if publicKey == "" {
+		publicKey, err = privateKeyObj.GetArmoredPublicKey()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
 	publicKeyObj, err := crypto.NewKeyFromArmored(publicKey)
 	if err != nil {
 		return nil, nil, err
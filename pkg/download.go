@@ -1,7 +1,8 @@
 package pkg
 
 import (
-	"bytes"
+	"compress/gzip"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
@@ -9,117 +10,337 @@ import (
 	"net/http"
 )
 
+// ByteRange is the range of bytes from Start to End (inclusive). Negative End means the end of the file
+type ByteRange struct {
+	Start int64
+	End   int64
+}
+
+// DownloadOptions are optional settings of DownloadFileWithOptions. Zero options download the whole file as-is
+type DownloadOptions struct {
+	// CryptoInfo is used to decrypt encrypted files. You need to provide at least your crypto password in it.
+	// If no keys are provided, the crypto info is received from the server and the key is decrypted with the password
+	CryptoInfo *CryptoInfo
+	// Range limits the download to the bytes of the range. Only non-encrypted files are supported,
+	// because encrypted ones need the whole stream to be decrypted, and the content is never decompressed
+	Range *ByteRange
+	// Resume continues the download of the file whose first Resume bytes are already written by the caller:
+	// only the rest is requested with the Range header. If the server ignores the range and sends the whole file,
+	// or the file can't be resumed (it is encrypted, decompressed after download or smaller than Resume),
+	// Restart is called before anything is written, so the caller can start over (e.g. truncate the file).
+	// The download fails in this case if Restart is nil. Resume can't be combined with Range
+	Resume int64
+	// Restart is called when the download set to Resume starts from the beginning
+	Restart func() error
+	// Raw writes files compressed by the client as they are stored, without decompression, and returns their stored name.
+	// It is used to copy files, so the copy keeps the compressed content along with the compressed name
+	Raw bool
+}
+
 // DownloadFile downloads a file from the cloud. If the file is encrypted, it will be decrypted using the provided.
 // If the file is encrypted and no crypto info provided, it will return an error.
-// You need to provide at least your crypto password in CryptoInfo to decrypt the file.
-// If no keys are provided, it will try to get the crypto info from the server and decrypt your key with the password.
+//
+// Deprecated: use DownloadFileWithOptions, which supports the context and more options
 func DownloadFile(token string, fileId string, cryptoInfo *CryptoInfo, writer io.Writer) (fileName string, numBytes int64, err error) {
-	if fileId == "" {
-		return "", 0, errors.New("file id is required")
+	return DownloadFileContext(context.Background(), token, fileId, cryptoInfo, writer)
+}
+
+// DownloadFileContext is DownloadFile which stops when the context is done, e.g. cancelled on Ctrl-C.
+// The writer may have a part of the content then, it's up to the caller to clean it up
+func DownloadFileContext(ctx context.Context, token string, fileId string, cryptoInfo *CryptoInfo, writer io.Writer) (fileName string, numBytes int64, err error) {
+	return DownloadFileWithOptions(ctx, token, fileId, writer, &DownloadOptions{CryptoInfo: cryptoInfo})
+}
+
+// DownloadFileRange downloads only the bytes from start to end (inclusive) of a file using the Range header.
+//
+// Deprecated: use DownloadFileWithOptions with the Range option
+func DownloadFileRange(token string, fileId string, start int64, end int64, writer io.Writer) (fileName string, numBytes int64, err error) {
+	return DownloadFileWithOptions(context.Background(), token, fileId, writer, &DownloadOptions{Range: &ByteRange{Start: start, End: end}})
+}
+
+// DownloadFileWithOptions downloads a file from the cloud into the writer and returns its name and the number of written bytes.
+// Encrypted files are decrypted with the crypto info of the options, an error is returned if it is not provided.
+// Files compressed by the client (see CompressedSuffix) are decompressed, and their original name is returned,
+// unless it is disabled by SetDecompressDownloads or the Raw option.
+// The content is only written to the writer, so it can be sent to several destinations at once with io.MultiWriter.
+// The context cancels the transfer of the content
+func DownloadFileWithOptions(ctx context.Context, token string, fileId string, writer io.Writer, opts *DownloadOptions) (fileName string, numBytes int64, err error) {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	if opts.Range != nil && (opts.Range.Start < 0 || (opts.Range.End >= 0 && opts.Range.End < opts.Range.Start)) {
+		return "", 0, fmt.Errorf("invalid byte range %d-%d", opts.Range.Start, opts.Range.End)
+	}
+	if opts.Resume < 0 || (opts.Resume > 0 && opts.Range != nil) {
+		return "", 0, errors.New("resume offset must be positive and can't be combined with the byte range")
 	}
 
-	filesList, err := ApiRequest(token, "files.getById", map[string]interface{}{"file": fileId})
+	fileUrl, fileInfo, err := getDownloadURL(ctx, token, fileId)
 	if err != nil {
 		return "", 0, err
 	}
-	if filesList.Error.Code != 0 {
-		return "", 0, errors.New(filesList.Error.Message)
+
+	progress := startTransfer(downloadEvent(fileInfo, opts))
+	fileName, numBytes, err = downloadContent(ctx, token, fileUrl, fileInfo, progress.writer(writer), opts)
+	progress.complete(fileId, err)
+	return fileName, numBytes, err
+}
+
+// downloadEvent describes the download of the file for callbacks. The total size is known only if the content
+// is written as it is stored
+func downloadEvent(fileInfo *File, opts *DownloadOptions) TransferEvent {
+	event := TransferEvent{Kind: "download", Name: fileInfo.Name, FileID: fileInfo.ID, Total: -1}
+	switch {
+	case opts.Range != nil:
+		if opts.Range.End >= 0 {
+			event.Total = opts.Range.End - opts.Range.Start + 1
+		}
+	case CanResume(fileInfo):
+		event.Total = int64(fileInfo.Size) - resumeOffset(fileInfo, opts)
 	}
 
-	resp, err := MapToStruct[FileGetByIdResponse](filesList.Result)
-	if err != nil {
-		return "", 0, err
+	return event
+}
+
+// DownloadedSize returns the number of bytes the download of the file writes, or -1 if it is not known
+// in advance, because the content is decrypted or decompressed on the fly
+func DownloadedSize(fileInfo *File) int64 {
+	if !CanResume(fileInfo) {
+		return -1
 	}
 
-	if resp.Count == 0 {
-		return "", 0, errors.New("file not found or you have not access to it")
+	return int64(fileInfo.Size)
+}
+
+// CanResume checks if the download of the file can be resumed with the Resume option. Only files written
+// as they are stored can be: encrypted files need the whole stream to be decrypted, and so do compressed ones
+// to be decompressed
+func CanResume(fileInfo *File) bool {
+	return !fileInfo.Encrypted && !(decompressDownloads && IsCompressedName(fileInfo.Name))
+}
+
+// resumeOffset returns the offset the download continues from, or 0 if it starts from the beginning
+func resumeOffset(fileInfo *File, opts *DownloadOptions) int64 {
+	if opts.Resume <= 0 || opts.Range != nil || !CanResume(fileInfo) {
+		return 0
+	}
+	if opts.Resume > int64(fileInfo.Size) {
+		return 0
 	}
 
-	list := resp.List
-	if len(list) == 0 {
-		return "", 0, errors.New("file not found or you have not access to it")
+	return opts.Resume
+}
+
+// restartDownload calls the Restart callback of the download set to Resume, which starts from the beginning
+func restartDownload(opts *DownloadOptions, reason string) error {
+	if opts.Resume <= 0 {
+		return nil
+	}
+
+	currentLogger("Download can't be resumed (%s), starting over", reason)
+	if opts.Restart == nil {
+		return fmt.Errorf("download can't be resumed: %s", reason)
 	}
 
-	fileInfo := list[0]
+	return opts.Restart()
+}
 
+// downloadContent downloads the file from the download link into the writer like DownloadFileWithOptions
+func downloadContent(ctx context.Context, token string, fileUrl string, fileInfo *File, writer io.Writer, opts *DownloadOptions) (fileName string, numBytes int64, err error) {
 	name := fileInfo.Name
 	encrypted := fileInfo.Encrypted
 	mimeType := fileInfo.Mime
 	disk := fileInfo.Disk
+	cryptoInfo := opts.CryptoInfo
 
-	// If the file is encrypted and no any crypto info provided, we need to get it
-	if encrypted && (cryptoInfo == nil || !cryptoInfo.IsCryptoReady()) {
-		if cryptoInfo == nil {
-			return "", 0, errors.New("file is encrypted but no crypto info provided")
-		}
+	if opts.Range != nil && encrypted {
+		return "", 0, errors.New("ranged download is not available for encrypted files")
+	}
 
-		if err := cryptoInfo.TryGetReady(token, disk); err != nil {
-			return "", 0, fmt.Errorf("failed to decrypt file: %w", err)
+	// The keys are checked before the download, so a wrong password doesn't cost the whole download
+	var privateKeyRing *crypto.KeyRing
+	if encrypted {
+		privateKeyRing, err = decryptionKeyRing(token, disk, cryptoInfo)
+		if err != nil {
+			return "", 0, err
 		}
+		defer privateKeyRing.ClearPrivateParams()
 	}
 
-	currentLogger("Downloading file %s (%s)", name, mimeType)
+	resume := resumeOffset(fileInfo, opts)
+	if opts.Resume > 0 && resume == 0 {
+		if err = restartDownload(opts, "the file is encrypted, compressed or changed"); err != nil {
+			return "", 0, err
+		}
+	}
+	if resume > 0 && resume == int64(fileInfo.Size) {
+		currentLogger("File %s is already downloaded", name)
+		return name, 0, nil
+	}
 
-	downloadRequest, err := ApiRequest(token, "files.download", map[string]interface{}{"file": fileId})
+	request, err := http.NewRequestWithContext(ctx, "GET", fileUrl, nil)
 	if err != nil {
 		return "", 0, err
 	}
-	if downloadRequest.Error.Code != 0 {
-		return "", 0, errors.New(downloadRequest.Error.Message)
-	}
 
-	downloadResponse, err := MapToStruct[DownloadResponse](downloadRequest.Result)
-	if err != nil {
-		return "", 0, fmt.Errorf("cannot get download link: %w", err)
+	expectedStatus := http.StatusOK
+	if resume > 0 {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-", resume))
+		expectedStatus = http.StatusPartialContent
+		currentLogger("Resuming download of file %s from byte %d", name, resume)
+	} else if opts.Range != nil {
+		rangeHeader := fmt.Sprintf("bytes=%d-", opts.Range.Start)
+		if opts.Range.End >= 0 {
+			rangeHeader += fmt.Sprintf("%d", opts.Range.End)
+		}
+		request.Header.Set("Range", rangeHeader)
+		expectedStatus = http.StatusPartialContent
+		currentLogger("Downloading %s of file %s (%s)", rangeHeader, name, mimeType)
+	} else {
+		currentLogger("Downloading file %s (%s)", name, mimeType)
 	}
 
-	fileUrl := downloadResponse.URL
-	if len(fileUrl) == 0 {
-		return "", 0, errors.New("file url is empty")
+	release, err := AcquireConcurrency(ctx, 1)
+	if err != nil {
+		return "", 0, err
 	}
+	defer release()
 
-	fileResp, err := http.Get(fileUrl)
+	fileResp, err := transferClient().Do(request)
 	if err != nil {
+		traceTransfer("download", fileUrl, 0, err)
 		return "", 0, err
 	}
 	defer fileResp.Body.Close()
+	traceTransfer("download", fileUrl, fileResp.StatusCode, nil)
 
-	if fileResp.StatusCode != http.StatusOK {
+	if resume > 0 && fileResp.StatusCode == http.StatusOK {
+		// The server ignores the range and sends the whole file
+		if err = restartDownload(opts, "the server doesn't support ranged downloads"); err != nil {
+			return "", 0, err
+		}
+		expectedStatus = http.StatusOK
+	}
+	if fileResp.StatusCode != expectedStatus {
+		if opts.Range != nil {
+			return "", 0, fmt.Errorf("server doesn't support ranged downloads (status %s)", fileResp.Status)
+		}
 		return "", 0, fmt.Errorf("bad response status code: %s", fileResp.Status)
 	}
 
-	if encrypted {
-		currentLogger("File is encrypted, downloading first")
-		// At the moment, we download the file to the buffer and then decrypt it.
-		// In the future, we will decrypt the file using the stream
-		buf := new(bytes.Buffer)
-		numBytes, err = io.Copy(buf, fileResp.Body)
-
-		currentLogger("File downloaded. Decrypting now")
-		message := crypto.NewPGPMessage(buf.Bytes())
+	if fileResp.Uncompressed {
+		currentLogger("Server compressed the content with gzip, it is decompressed on the fly")
+	}
 
-		_, privateKeyRing, err := GetKeyRings(cryptoInfo.PublicKey, cryptoInfo.RawCryptoKey, []byte(cryptoInfo.Password))
+	var content io.Reader = fileResp.Body
+	if encrypted {
+		currentLogger("File is encrypted, decrypting while downloading")
+		// The message is decrypted as it arrives, so the file never has to fit in memory.
+		// Integrity of the message is checked when its end is read, so a tampered file fails the copy below
+		decrypted, err := privateKeyRing.DecryptStream(fileResp.Body, nil, 0)
 		if err != nil {
-			return "", 0, err
+			return "", 0, fmt.Errorf("failed to decrypt file: %w", err)
 		}
 
-		decrypted, err := privateKeyRing.Decrypt(message, nil, 0)
+		content = decrypted
+	} else if opts.Range == nil {
+		currentLogger("File is not encrypted, downloading as-is")
+	}
+
+	// Files compressed by the client are decompressed after decryption, so the original content is written
+	if decompressDownloads && !opts.Raw && opts.Range == nil && IsCompressedName(name) {
+		currentLogger("File is compressed, decompressing")
+		gzipReader, err := gzip.NewReader(content)
 		if err != nil {
-			return "", 0, err
+			return "", 0, fmt.Errorf("failed to decompress file: %w", err)
 		}
-		privateKeyRing.ClearPrivateParams()
+		defer gzipReader.Close()
 
-		currentLogger("File decrypted. Saving now")
-		numBytes, err = io.Copy(writer, decrypted.NewReader())
-	} else {
-		currentLogger("File is not encrypted, downloading as-is")
-		numBytes, err = io.Copy(writer, fileResp.Body)
+		content = gzipReader
+		name = OriginalName(name)
 	}
 
+	numBytes, err = CopyBuffered(writer, content)
 	if err != nil {
 		return "", 0, err
 	}
 
-	currentLogger("Download is done (%d bytes)", numBytes)
+	logWithFields(Fields{"file_id": fileInfo.ID, "name": name, "bytes": numBytes}, "Download is done (%d bytes)", numBytes)
 	return name, numBytes, nil
 }
+
+// decryptionKeyRing gets the crypto info ready for the disk and unlocks the private key ring
+// which decrypts its files. It doesn't download anything but the keys
+func decryptionKeyRing(token string, disk string, cryptoInfo *CryptoInfo) (*crypto.KeyRing, error) {
+	if cryptoInfo == nil {
+		return nil, errors.New("file is encrypted but no crypto info provided")
+	}
+
+	if !cryptoInfo.IsCryptoReadyFor(disk) {
+		if err := cryptoInfo.TryGetReady(token, disk); err != nil {
+			return nil, fmt.Errorf("failed to decrypt file: %w", err)
+		}
+	}
+
+	_, privateKeyRing, err := GetKeyRings(cryptoInfo.PublicKey, cryptoInfo.RawCryptoKey, []byte(cryptoInfo.PasswordFor(cryptoInfo.Disk)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt file: %w", err)
+	}
+
+	return privateKeyRing, nil
+}
+
+// CheckFileCrypto checks that the file can be decrypted with the crypto info, without downloading its content:
+// the key of the file disk is derived and unlocked the same way as for the download.
+// Nil error is returned for files which are not encrypted, the returned file info tells which one it is
+func CheckFileCrypto(token string, fileId string, cryptoInfo *CryptoInfo) (*File, error) {
+	fileInfo, err := GetFile(token, fileId)
+	if err != nil {
+		return nil, err
+	}
+	if !fileInfo.Encrypted {
+		return fileInfo, nil
+	}
+
+	privateKeyRing, err := decryptionKeyRing(token, fileInfo.Disk, cryptoInfo)
+	if err != nil {
+		return fileInfo, err
+	}
+	privateKeyRing.ClearPrivateParams()
+
+	return fileInfo, nil
+}
+
+// ErrEmptyDownloadURL is returned when the server didn't provide the download link
+var ErrEmptyDownloadURL = errors.New("file url is empty")
+
+// GetDownloadURL gets the download link for the file and the file info. The link is usually short-lived.
+// The content of encrypted files is downloaded encrypted, so it should be decrypted after download.
+// ErrFileNotFound and ErrEmptyDownloadURL are returned for the missing file and the missing link
+func GetDownloadURL(token string, fileId string) (fileUrl string, fileInfo *File, err error) {
+	return getDownloadURL(context.Background(), token, fileId)
+}
+
+// getDownloadURL is GetDownloadURL which stops when the context is done
+func getDownloadURL(ctx context.Context, token string, fileId string) (fileUrl string, fileInfo *File, err error) {
+	fileInfo, err = getFile(ctx, token, fileId)
+	if err != nil {
+		return "", nil, err
+	}
+
+	downloadRequest, err := callMethodContext(ctx, token, "files.download", map[string]interface{}{"file": fileId})
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot get download link: %w", err)
+	}
+
+	downloadResponse, err := MapToStruct[DownloadResponse](downloadRequest.Result)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot get download link: %w", err)
+	}
+
+	if len(downloadResponse.URL) == 0 {
+		return "", nil, ErrEmptyDownloadURL
+	}
+
+	return downloadResponse.URL, fileInfo, nil
+}
@@ -0,0 +1,174 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newDownloadServer starts the server with the file of the content: files.getById returns its info,
+// files.download returns the link to the content, which supports ranges
+func newDownloadServer(t testing.TB, name string, content string) *httptest.Server {
+	t.Helper()
+
+	var serverURL string
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/content/file1" {
+			http.ServeContent(w, r, name, time.Time{}, strings.NewReader(content))
+			return
+		}
+
+		rpc := readRPCRequest(t, r)
+		if rpc.Params["file"] != "file1" {
+			writeError(w, 404, "File not found")
+			return
+		}
+		switch rpc.Method {
+		case "files.getById":
+			writeResult(w, fmt.Sprintf(`{"count":1,"list":[{"id":"file1","name":%q,"size":%d}]}`, name, len(content)))
+		case "files.download":
+			writeResult(w, fmt.Sprintf(`{"url":%q}`, serverURL+"/content/file1"))
+		default:
+			writeError(w, methodNotFoundCode, "Method not found")
+		}
+	})
+	serverURL = server.URL
+
+	return server
+}
+
+func TestDownloadFile(t *testing.T) {
+	newDownloadServer(t, "notes.txt", "hello world")
+
+	var out bytes.Buffer
+	name, numBytes, err := DownloadFileWithOptions(context.Background(), "secret", "file1", &out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name != "notes.txt" || numBytes != 11 || out.String() != "hello world" {
+		t.Errorf("downloaded %q (%d bytes): %q", name, numBytes, out.String())
+	}
+}
+
+func TestDownloadFileNotFound(t *testing.T) {
+	newDownloadServer(t, "notes.txt", "hello world")
+
+	var out bytes.Buffer
+	_, _, err := DownloadFileWithOptions(context.Background(), "secret", "missing", &out, nil)
+	if err == nil {
+		t.Fatal("download of the missing file succeeded")
+	}
+	if out.Len() != 0 {
+		t.Errorf("content is written for the missing file: %q", out.String())
+	}
+}
+
+func TestDownloadFileRanges(t *testing.T) {
+	tests := []struct {
+		name string
+		opts *DownloadOptions
+		want string
+	}{
+		{name: "byte range", opts: &DownloadOptions{Range: &ByteRange{Start: 6, End: 10}}, want: "world"},
+		{name: "resume", opts: &DownloadOptions{Resume: 6}, want: "world"},
+		{name: "resume of the complete file", opts: &DownloadOptions{Resume: 11}, want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newDownloadServer(t, "notes.txt", "hello world")
+
+			var out bytes.Buffer
+			_, _, err := DownloadFileWithOptions(context.Background(), "secret", "file1", &out, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.want {
+				t.Errorf("content is %q, want %q", out.String(), test.want)
+			}
+		})
+	}
+}
+
+func TestDownloadFileDecompresses(t *testing.T) {
+	var compressed bytes.Buffer
+	reader := CompressReader(strings.NewReader("hello world"))
+	if _, err := compressed.ReadFrom(reader); err != nil {
+		t.Fatal(err)
+	}
+	newDownloadServer(t, CompressedName("notes.txt"), compressed.String())
+
+	var out bytes.Buffer
+	_, _, err := DownloadFileWithOptions(context.Background(), "secret", "file1", &out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "hello world" {
+		t.Errorf("content is %q, want the decompressed one", out.String())
+	}
+}
+
+func TestDownloadFileCancelled(t *testing.T) {
+	newDownloadServer(t, "notes.txt", "hello world")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var out bytes.Buffer
+	_, _, err := DownloadFileWithOptions(ctx, "secret", "file1", &out, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error is %v, want context.Canceled", err)
+	}
+}
+
+func TestGetDownloadURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		getById  string
+		download string
+		wantURL  string
+		wantErr  error
+		anyErr   bool
+	}{
+		{name: "link", getById: `{"result":{"count":1,"list":[{"id":"file1","name":"a.txt"}]}}`, download: `{"result":{"url":"https://cdn/a"}}`, wantURL: "https://cdn/a"},
+		{name: "empty link", getById: `{"result":{"count":1,"list":[{"id":"file1","name":"a.txt"}]}}`, download: `{"result":{"url":""}}`, wantErr: ErrEmptyDownloadURL},
+		{name: "missing file", getById: `{"result":{"count":0,"list":[]}}`, wantErr: ErrFileNotFound},
+		{name: "link error", getById: `{"result":{"count":1,"list":[{"id":"file1","name":"a.txt"}]}}`, download: `{"error":{"code":403,"message":"Access denied"}}`, anyErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				switch readRPCRequest(t, r).Method {
+				case "files.getById":
+					_, _ = fmt.Fprint(w, test.getById)
+				case "files.download":
+					_, _ = fmt.Fprint(w, test.download)
+				}
+			})
+
+			fileUrl, fileInfo, err := GetDownloadURL("secret", "file1")
+			switch {
+			case test.wantErr != nil:
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("error is %v, want %v", err, test.wantErr)
+				}
+			case test.anyErr:
+				if err == nil {
+					t.Fatal("GetDownloadURL succeeded, want an error")
+				}
+			case err != nil:
+				t.Fatal(err)
+			case fileUrl != test.wantURL || fileInfo == nil || fileInfo.ID != "file1":
+				t.Errorf("GetDownloadURL = %q, %v, want %q", fileUrl, fileInfo, test.wantURL)
+			}
+		})
+	}
+}
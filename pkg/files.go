@@ -0,0 +1,237 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrFileNotFound is returned when the file doesn't exist or the user has no access to it
+var ErrFileNotFound = errors.New("file not found or you have not access to it")
+
+// GetFile returns the file metadata by its id. ErrFileNotFound is returned if there is no such file,
+// or the user has no access to it (the server doesn't distinguish these cases)
+func GetFile(token string, fileId string) (*File, error) {
+	return getFile(context.Background(), token, fileId)
+}
+
+// getFile is GetFile which stops when the context is done
+func getFile(ctx context.Context, token string, fileId string) (*File, error) {
+	if fileId == "" {
+		return nil, errors.New("file id is required")
+	}
+
+	response, err := callMethodContext(ctx, token, "files.getById", map[string]interface{}{"file": fileId})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := MapToStruct[FileGetByIdResponse](response.Result)
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Count == 0 || len(result.List) == 0 || result.List[0] == nil {
+		return nil, ErrFileNotFound
+	}
+
+	return result.List[0], nil
+}
+
+// GetFolderContents returns files and subfolders of the folder. Empty folder means the disk root
+func GetFolderContents(token string, disk string, folder string, offset int) (*FilesGetResponse, error) {
+	return getFilesPage(context.Background(), token, disk, folder, offset, 0)
+}
+
+// ListFiles returns files of the disk root starting from the offset, and the total number of files
+// (-1 if the server doesn't report it). Up to limit files are returned, requesting as many pages as needed.
+// If limit is zero, a single page of the server's default size is returned. If limit is negative,
+// all the files from the offset are returned. Pages are requested until the limit or the total is reached,
+// or the server returns a page without new files. A short page doesn't mean the end,
+// because the server may cap the page size below the requested limit
+func ListFiles(token string, disk string, offset int, limit int) ([]*File, int, error) {
+	return ListFilesContext(context.Background(), token, disk, offset, limit)
+}
+
+// ListFilesContext is ListFiles which stops when the context is done
+func ListFilesContext(ctx context.Context, token string, disk string, offset int, limit int) ([]*File, int, error) {
+	var files []*File
+	total := -1
+	pager := newFolderPager(ctx, token, disk, "", offset)
+
+	for {
+		pageLimit := 0
+		if limit > 0 {
+			pageLimit = limit - len(files)
+		}
+
+		page, err := pager.next(pageLimit)
+		if err != nil {
+			return nil, 0, err
+		}
+		if page.Count > 0 {
+			total = page.Count
+		}
+
+		added := len(page.List)
+		if limit > 0 && len(files)+added > limit {
+			added = limit - len(files)
+		}
+		files = append(files, page.List[:added]...)
+
+		switch {
+		case limit == 0, added == 0:
+			return files, total, nil
+		case limit > 0 && len(files) >= limit:
+			return files, total, nil
+		case total >= 0 && offset+len(files) >= total:
+			return files, total, nil
+		}
+	}
+}
+
+// getFilesPage requests a single page of the folder contents. Limit is not sent if it is zero
+func getFilesPage(ctx context.Context, token string, disk string, folder string, offset int, limit int) (*FilesGetResponse, error) {
+	params := map[string]interface{}{"disk": disk, "offset": offset}
+	if folder != "" {
+		params["folder"] = folder
+	}
+	if limit > 0 {
+		params["limit"] = limit
+	}
+
+	// Pages may be big, so they are decoded from the stream instead of the intermediate map
+	page := &FilesGetResponse{}
+	if err := callMethodStream(ctx, token, "files.get", params, page); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// GetAllFolderFiles returns all the files of the folder (without subfolders), requesting pages until the end
+func GetAllFolderFiles(token string, disk string, folder string) ([]*File, error) {
+	files, _, err := GetAllFolderContents(context.Background(), token, disk, folder)
+	return files, err
+}
+
+// GetAllFolderContents returns all the files and subfolders of the folder (not recursively), requesting pages
+// until a page has neither new files nor new folders or the context is done. Empty folder means the disk root
+func GetAllFolderContents(ctx context.Context, token string, disk string, folder string) ([]*File, []*Folder, error) {
+	var files []*File
+	var folders []*Folder
+	err := WalkFolderContents(ctx, token, disk, folder, func(pageFiles []*File, pageFolders []*Folder) bool {
+		files = append(files, pageFiles...)
+		folders = append(folders, pageFolders...)
+		return true
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return files, folders, nil
+}
+
+// GetAllSubfolders returns all the subfolders of the folder (not recursively). Subfolders are listed before files
+// or repeated on every page, so pages are requested only until a page has no new subfolders,
+// and files of big folders are not listed to the end. Empty folder means the disk root
+func GetAllSubfolders(ctx context.Context, token string, disk string, folder string) ([]*Folder, error) {
+	var folders []*Folder
+	err := WalkFolderContents(ctx, token, disk, folder, func(_ []*File, pageFolders []*Folder) bool {
+		folders = append(folders, pageFolders...)
+		return len(pageFolders) > 0
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return folders, nil
+}
+
+// WalkFolderContents requests the pages of the folder contents one by one and passes files and subfolders
+// not seen on the previous pages to the callback. It stops when the callback returns false
+// or a page has neither new files nor new folders. The context stops requesting pages. Empty folder means the disk root
+func WalkFolderContents(ctx context.Context, token string, disk string, folder string, visit func(files []*File, folders []*Folder) bool) error {
+	pager := newFolderPager(ctx, token, disk, folder, 0)
+	for {
+		page, err := pager.next(0)
+		if err != nil {
+			return err
+		}
+		if len(page.List) == 0 && len(page.Folders) == 0 {
+			return nil
+		}
+		if !visit(page.List, page.Folders) {
+			return nil
+		}
+	}
+}
+
+// folderPager requests the pages of the folder contents one by one, continuing from the files got before
+type folderPager struct {
+	ctx    context.Context
+	token  string
+	disk   string
+	folder string
+	offset int
+	seen   map[string]bool
+}
+
+// newFolderPager creates the pager of the folder contents starting from the offset. Empty folder means the disk root
+func newFolderPager(ctx context.Context, token string, disk string, folder string, offset int) *folderPager {
+	return &folderPager{ctx: ctx, token: token, disk: disk, folder: folder, offset: offset, seen: make(map[string]bool)}
+}
+
+// next requests the next page of up to limit files (the server's default if zero) and returns it
+// with only the files and folders not returned before. Both are empty at the end of the listing
+func (p *folderPager) next(limit int) (*FilesGetResponse, error) {
+	page, err := getFilesPage(p.ctx, p.token, p.disk, p.folder, p.offset, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// The check protects from looping forever if the server ignores the offset.
+	// Folders may be repeated on every page or only on the first one, so they are deduplicated the same way
+	files := page.List[:0]
+	for _, file := range page.List {
+		if p.seen["file:"+file.ID] {
+			continue
+		}
+		p.seen["file:"+file.ID] = true
+		files = append(files, file)
+	}
+	folders := page.Folders[:0]
+	for _, folder := range page.Folders {
+		if p.seen["folder:"+folder.ID] {
+			continue
+		}
+		p.seen["folder:"+folder.ID] = true
+		folders = append(folders, folder)
+	}
+
+	page.List = files
+	page.Folders = folders
+	p.offset += len(files)
+	return page, nil
+}
+
+// DeleteFile deletes a file by its id. The file is moved to the trash unless permanent is true
+func DeleteFile(token string, fileId string, permanent bool) error {
+	_, err := callMethod(token, "files.delete", map[string]interface{}{"file": fileId, "permanent": permanent})
+	return err
+}
+
+// FindFilesByHash returns files of the disk with the SHA-256 hash of the content (hex encoded).
+// ErrMethodNotSupported is returned if the server can't look files up by hash
+func FindFilesByHash(token string, disk string, hash string) ([]*File, error) {
+	response, err := callMethod(token, "files.findByHash", map[string]interface{}{"disk": disk, "hash": hash})
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := MapToStruct[FileGetByIdResponse](response.Result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result.List, nil
+}
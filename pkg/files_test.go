@@ -0,0 +1,60 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestGetFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		fileId   string
+		response string
+		wantName string
+		wantErr  error
+		anyErr   bool
+	}{
+		{name: "file", fileId: "file1", response: `{"result":{"count":1,"list":[{"id":"file1","name":"a.txt","size":5,"encrypted":true}]}}`, wantName: "a.txt"},
+		{name: "zero count", fileId: "file1", response: `{"result":{"count":0,"list":[]}}`, wantErr: ErrFileNotFound},
+		{name: "empty list", fileId: "file1", response: `{"result":{"count":1,"list":[]}}`, wantErr: ErrFileNotFound},
+		{name: "null file", fileId: "file1", response: `{"result":{"count":1,"list":[null]}}`, wantErr: ErrFileNotFound},
+		{name: "API error", fileId: "file1", response: `{"error":{"code":403,"message":"Access denied"}}`, anyErr: true},
+		{name: "empty id", fileId: "", anyErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := 0
+			newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				rpc := readRPCRequest(t, r)
+				if rpc.Method != "files.getById" || rpc.Params["file"] != test.fileId {
+					t.Errorf("request is %s %v", rpc.Method, rpc.Params)
+				}
+				_, _ = fmt.Fprint(w, test.response)
+			})
+
+			file, err := GetFile("secret", test.fileId)
+			switch {
+			case test.wantErr != nil:
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("error is %v, want %v", err, test.wantErr)
+				}
+			case test.anyErr:
+				if err == nil {
+					t.Fatalf("GetFile returned %v, want an error", file)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case file.Name != test.wantName || file.ID != test.fileId:
+				t.Errorf("GetFile returned %+v", file)
+			}
+
+			if test.fileId == "" && requests > 0 {
+				t.Error("the request is sent without the file id")
+			}
+		})
+	}
+}
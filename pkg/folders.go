@@ -0,0 +1,28 @@
+package pkg
+
+import "errors"
+
+// FolderCreateResult is the result of folders.create method
+type FolderCreateResult struct {
+	FolderID string `mapstructure:"folder_id"`
+	Ok       bool   `mapstructure:"ok"`
+}
+
+// CreateFolder creates a folder with the name in the parent folder (or in the disk root if parent is empty)
+// and returns its id
+func CreateFolder(token string, disk string, parent string, name string) (string, error) {
+	response, err := callMethod(token, "folders.create", map[string]interface{}{"disk": disk, "parent": parent, "name": name})
+	if err != nil {
+		return "", err
+	}
+
+	result, err := MapToStruct[FolderCreateResult](response.Result)
+	if err != nil {
+		return "", err
+	}
+	if result.FolderID == "" {
+		return "", errors.New("response folder_id is empty")
+	}
+
+	return result.FolderID, nil
+}
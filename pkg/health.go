@@ -0,0 +1,27 @@
+package pkg
+
+import "time"
+
+// HealthInfo is the result of the system.health method. Components are statuses of server parts like storage or auth
+type HealthInfo struct {
+	Status     string            `mapstructure:"status" json:"status"`
+	Components map[string]string `mapstructure:"components" json:"components"`
+}
+
+// GetHealth returns the detailed server health. ErrMethodNotSupported is returned if the server doesn't provide it
+func GetHealth(token string) (*HealthInfo, error) {
+	response, err := callMethod(token, "system.health", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return MapToStruct[HealthInfo](response.Result)
+}
+
+// PingLatency checks if the API is alive and measures the round-trip time of the check.
+// The error is the same as of CheckApiAlive
+func PingLatency() (latency time.Duration, err error) {
+	started := time.Now()
+	err = CheckApiAlive()
+	return time.Since(started), err
+}
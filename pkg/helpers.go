@@ -1,44 +1,93 @@
 package pkg
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
-// GetUserDisk returns the user's default disk or the disk with the desired id.
-// It also returns the crypto info for the disk
-func GetUserDisk(token string, disk string) (*Disk, *CryptoInfo, error) {
-	resp, err := ApiRequest(token, "disks.get", nil)
+// ErrDiskNotFound is returned when the user has no disk with the requested id
+var ErrDiskNotFound = errors.New("disk not found")
+
+// ListDisks returns all disks of the user. The first one is the default disk. The list may be empty.
+// API errors (like an invalid token) are returned as errors, so they are not mistaken for an empty list
+func ListDisks(token string) ([]*Disk, error) {
+	resp, err := callMethod(token, "disks.get", nil)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	// At the moment results are not a structure, so we need to cast it to a map
 	disks, err := MapToStruct[DisksInfo](resp.Result)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
+	}
+
+	return disks.List, nil
+}
+
+// CreateDisk creates a disk with the title and returns it. Disks without keys are not encrypted,
+// keys of encrypted disks are generated by GenerateCryptoKeys
+func CreateDisk(token string, title string, publicKey string, cryptoKey string) (*Disk, error) {
+	params := map[string]interface{}{"title": title}
+	if publicKey != "" {
+		params["public_key"] = publicKey
+		params["crypto_key"] = cryptoKey
 	}
-	if len(disks.List) == 0 {
-		return nil, nil, fmt.Errorf("users default disk not found")
+
+	resp, err := callMethod(token, "disks.create", params)
+	if err != nil {
+		return nil, err
 	}
 
-	var diskInfo *Disk
-	for _, nextDisk := range disks.List {
-		// If the disk is set, we need to find the disk with the desired id
-		if disk != "" && nextDisk.ID == disk {
-			diskInfo = nextDisk
-			break
+	return MapToStruct[Disk](resp.Result)
+}
+
+// SelectDisk finds the disk in the list by its ID, or by its title if no disk has such ID.
+// Empty disk means the default disk, which is the first one. ErrDiskNotFound is returned if nothing matches,
+// and an error is returned if the title belongs to several disks
+func SelectDisk(disks []*Disk, disk string) (*Disk, error) {
+	if len(disks) == 0 {
+		return nil, fmt.Errorf("users default disk: %w", ErrDiskNotFound)
+	}
+	if disk == "" {
+		return disks[0], nil
+	}
+
+	for _, nextDisk := range disks {
+		if nextDisk.ID == disk {
+			return nextDisk, nil
 		}
+	}
 
-		// If the disk is not set, we need to return the first disk as default
-		if disk == "" {
-			diskInfo = nextDisk
-			break
+	var found *Disk
+	for _, nextDisk := range disks {
+		if nextDisk.Title != disk {
+			continue
 		}
+		if found != nil {
+			return nil, fmt.Errorf("several disks are named %q, use the disk ID", disk)
+		}
+		found = nextDisk
+	}
+	if found == nil {
+		return nil, fmt.Errorf("disk %s: %w", disk, ErrDiskNotFound)
 	}
 
-	if diskInfo == nil {
-		return nil, nil, fmt.Errorf("disk not found")
+	return found, nil
+}
+
+// GetUserDisk returns the user's default disk (the first one) if the disk id is empty, or the disk with the desired id
+// (or title, see SelectDisk). It also returns the crypto info for the disk. ErrDiskNotFound is returned if there is no such disk
+func GetUserDisk(token string, disk string) (*Disk, *CryptoInfo, error) {
+	disks, err := ListDisks(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	diskInfo, err := SelectDisk(disks, disk)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	cryptoKey := diskInfo.CryptoKey
-	publicKey := diskInfo.PublicKey
-	return diskInfo, &CryptoInfo{EncryptedCryptoKey: cryptoKey, PublicKey: publicKey}, nil
+	return diskInfo, &CryptoInfo{EncryptedCryptoKey: diskInfo.CryptoKey, PublicKey: diskInfo.PublicKey}, nil
 }
@@ -0,0 +1,148 @@
+package pkg
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestListDisks(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  string
+		wantIDs []string
+	}{
+		{name: "several disks", result: `{"count":2,"list":[{"id":"disk1","title":"Main","public_key":"public","used":10,"quota":100},{"id":"disk2","title":"Backup"}]}`, wantIDs: []string{"disk1", "disk2"}},
+		{name: "no disks", result: `{"count":0,"list":[]}`},
+		{name: "no list", result: `{"count":0}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				if method := readRPCRequest(t, r).Method; method != "disks.get" {
+					t.Errorf("method is %q, want disks.get", method)
+				}
+				writeResult(w, test.result)
+			})
+
+			disks, err := ListDisks("secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(disks) != len(test.wantIDs) {
+				t.Fatalf("ListDisks returned %d disks, want %d", len(disks), len(test.wantIDs))
+			}
+			for i, disk := range disks {
+				if disk.ID != test.wantIDs[i] {
+					t.Errorf("disk %d is %q, want %q", i, disk.ID, test.wantIDs[i])
+				}
+			}
+		})
+	}
+}
+
+func TestListDisksError(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		wantErr string
+	}{
+		{name: "server error", handler: func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}},
+		{name: "invalid token", handler: func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, 401, "Invalid token")
+		}, wantErr: "Invalid token"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newTestServer(t, test.handler)
+
+			disks, err := ListDisks("secret")
+			if err == nil {
+				t.Fatalf("ListDisks = %v, want an error", disks)
+			}
+			if test.wantErr != "" && !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("error is %v, want %q", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetUserDiskInvalidToken(t *testing.T) {
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, 401, "Invalid token")
+	})
+
+	_, _, err := GetUserDisk("secret", "")
+	if err == nil || errors.Is(err, ErrDiskNotFound) {
+		t.Fatalf("error is %v, want the API error instead of ErrDiskNotFound", err)
+	}
+}
+
+func TestSelectDisk(t *testing.T) {
+	disks := []*Disk{
+		{ID: "disk1", Title: "Main"},
+		{ID: "disk2", Title: "Backup"},
+		{ID: "disk3", Title: "Backup"},
+		{ID: "disk4", Title: "disk1"},
+	}
+
+	tests := []struct {
+		name    string
+		disks   []*Disk
+		disk    string
+		want    string
+		wantErr error
+		anyErr  bool
+	}{
+		{name: "default disk", disks: disks, disk: "", want: "disk1"},
+		{name: "by id", disks: disks, disk: "disk2", want: "disk2"},
+		{name: "by title", disks: disks, disk: "Main", want: "disk1"},
+		{name: "id wins over title", disks: disks, disk: "disk1", want: "disk1"},
+		{name: "ambiguous title", disks: disks, disk: "Backup", anyErr: true},
+		{name: "unknown disk", disks: disks, disk: "missing", wantErr: ErrDiskNotFound},
+		{name: "no disks", disks: nil, disk: "", wantErr: ErrDiskNotFound},
+		{name: "no disks with id", disks: nil, disk: "disk1", wantErr: ErrDiskNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := SelectDisk(test.disks, test.disk)
+			switch {
+			case test.wantErr != nil:
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("error is %v, want %v", err, test.wantErr)
+				}
+			case test.anyErr:
+				if err == nil || errors.Is(err, ErrDiskNotFound) {
+					t.Fatalf("SelectDisk(%q) = %v, %v, want an error", test.disk, got, err)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case got.ID != test.want:
+				t.Errorf("SelectDisk(%q) = %q, want %q", test.disk, got.ID, test.want)
+			}
+		})
+	}
+}
+
+func TestGetUserDisk(t *testing.T) {
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeResult(w, `{"count":2,"list":[{"id":"disk1","title":"Main"},{"id":"disk2","title":"Secure","crypto_key":"private","public_key":"public"}]}`)
+	})
+
+	disk, crypto, err := GetUserDisk("secret", "Secure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if disk.ID != "disk2" {
+		t.Errorf("disk is %q, want disk2", disk.ID)
+	}
+	if crypto.EncryptedCryptoKey != "private" || crypto.PublicKey != "public" {
+		t.Errorf("crypto info is %+v", crypto)
+	}
+}
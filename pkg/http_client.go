@@ -3,23 +3,120 @@ package pkg
 import (
 	"net"
 	"net/http"
+	"sync"
 	"time"
 )
 
-// KtCustomClient returns a custom http client for ktCloud API
-// It has a timeout of 5 seconds and transport with a timeout of 3 seconds
-func KtCustomClient() *http.Client {
-	transport := http.Transport{
+// TransportSettings are the connection pool settings of the HTTP transport used by the library
+type TransportSettings struct {
+	// MaxIdleConns is the number of idle (keep-alive) connections kept open for reuse. Zero means no limit
+	MaxIdleConns int
+	// MaxConnsPerHost limits the number of connections to one host, including active ones. Zero means no limit
+	MaxConnsPerHost int
+}
+
+// DefaultTransportSettings are sensible for the usual CLI usage: a few connections are kept alive
+// between API calls, and there is no limit of simultaneous connections
+var DefaultTransportSettings = TransportSettings{
+	MaxIdleConns:    16,
+	MaxConnsPerHost: 0,
+}
+
+// sharedTransport is reused by all the clients, so keep-alive connections are reused between API calls
+var sharedTransport *http.Transport
+
+// transportMutex guards sharedTransport
+var transportMutex sync.Mutex
+
+// SetTransportSettings tunes the connection pool. It is useful for batch operations doing many API calls.
+// The settings are applied to clients created after the call
+func SetTransportSettings(settings TransportSettings) {
+	transportMutex.Lock()
+	defer transportMutex.Unlock()
+
+	if sharedTransport != nil {
+		sharedTransport.CloseIdleConnections()
+	}
+	sharedTransport = newTransport(settings)
+}
+
+// getTransport returns the shared transport, creating it with default settings if needed
+func getTransport() *http.Transport {
+	transportMutex.Lock()
+	defer transportMutex.Unlock()
+
+	if sharedTransport == nil {
+		sharedTransport = newTransport(DefaultTransportSettings)
+	}
+
+	return sharedTransport
+}
+
+// newTransport creates the transport with connection timeouts and keep-alives enabled
+func newTransport(settings TransportSettings) *http.Transport {
+	return &http.Transport{
 		Proxy: http.ProxyFromEnvironment,
 		Dial: (&net.Dialer{
 			Timeout:   3 * time.Second,
 			KeepAlive: 30 * time.Second,
 		}).Dial,
 		TLSHandshakeTimeout: 10 * time.Second,
+		DisableKeepAlives:   false,
+		// The transport asks for gzip and decompresses responses transparently, as long as requests don't set
+		// Accept-Encoding by themselves. Ranged requests are never compressed, so byte offsets stay correct
+		DisableCompression: false,
+		MaxIdleConns:       settings.MaxIdleConns,
+		// Almost all requests go to the same host, so all idle connections may belong to it
+		MaxIdleConnsPerHost: settings.MaxIdleConns,
+		MaxConnsPerHost:     settings.MaxConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
+
+// customClient is the client set by SetHTTPClient. All the requests use the default clients if it is nil
+var customClient *http.Client
+
+// clientMutex guards customClient
+var clientMutex sync.Mutex
+
+// SetHTTPClient makes all the requests of the library (API calls, uploads and downloads) go through the client.
+// It is useful for tests with httptest servers (a transport can redirect requests to them) and for embedders
+// which need their own transport, proxy or timeouts. Nil restores the default clients.
+// Transport settings of SetTransportSettings are not applied to the custom client
+func SetHTTPClient(client *http.Client) {
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+	customClient = client
+}
+
+// getCustomClient returns the client set by SetHTTPClient
+func getCustomClient() *http.Client {
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+	return customClient
+}
+
+// transferClient returns the client for uploads and downloads. It uses the shared transport like KtCustomClient
+// (with its proxy, connection timeouts and pool settings), but has no timeout, because transfers of big files take long
+func transferClient() *http.Client {
+	if client := getCustomClient(); client != nil {
+		return client
+	}
+
+	return &http.Client{Transport: getTransport()}
+}
+
+// KtCustomClient returns a custom http client for ktCloud API
+// It has a timeout of 5 seconds and transport with a timeout of 3 seconds.
+// The transport is shared between clients, so connections are kept alive and reused.
+// The client set by SetHTTPClient is returned instead, if any
+func KtCustomClient() *http.Client {
+	if client := getCustomClient(); client != nil {
+		return client
 	}
 
 	client := http.Client{
-		Transport: &transport,
+		Transport: getTransport(),
 		Timeout:   5 * time.Second,
 	}
 
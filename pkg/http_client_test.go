@@ -0,0 +1,42 @@
+package pkg
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func BenchmarkApiRequestKeepAlive(b *testing.B) {
+	benchmarks := []struct {
+		name      string
+		keepAlive bool
+	}{
+		{name: "keep-alive", keepAlive: true},
+		{name: "new connection per request", keepAlive: false},
+	}
+
+	for _, benchmark := range benchmarks {
+		b.Run(benchmark.name, func(b *testing.B) {
+			server := newTestServer(b, func(w http.ResponseWriter, r *http.Request) {
+				writeResult(w, `{"ok":true}`)
+			})
+			target, err := url.Parse(server.URL)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			transport := newTransport(DefaultTransportSettings)
+			transport.DisableKeepAlives = !benchmark.keepAlive
+			defer transport.CloseIdleConnections()
+			SetHTTPClient(&http.Client{Transport: redirectTransport{target: target, transport: transport}})
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := ApiRequest("secret", "files.get", nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
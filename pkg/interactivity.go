@@ -2,6 +2,8 @@ package pkg
 
 import (
 	"fmt"
+	"golang.org/x/crypto/ssh/terminal"
+	"os"
 )
 
 var isInteractive bool
@@ -36,3 +38,22 @@ func ScanOrDefault(prompt, defaultValue string) (input string) {
 
 	return
 }
+
+// ScanPassword asks for a secret without displaying it. Empty string is returned in non-interactive mode
+// and when the standard input is not a terminal (e.g. it is used for the uploaded content)
+func ScanPassword(prompt string) string {
+	fd := int(os.Stdin.Fd())
+	if !isInteractive || !terminal.IsTerminal(fd) {
+		return ""
+	}
+
+	// The prompt goes to stderr, so it never mixes with the output on stdout
+	fmt.Fprint(os.Stderr, prompt)
+	password, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return ""
+	}
+
+	return string(password)
+}
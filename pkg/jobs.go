@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	// JobPending is the status of the job waiting for its turn
+	JobPending = "pending"
+	// JobRunning is the status of the job in progress
+	JobRunning = "running"
+	// JobDone is the status of the successfully finished job
+	JobDone = "done"
+	// JobFailed is the status of the failed job, the reason is in the error field
+	JobFailed = "failed"
+)
+
+// StatusResult is the status of the asynchronous server operation returned by the jobs.get method
+type StatusResult struct {
+	ID     string `mapstructure:"id" json:"id"`
+	Status string `mapstructure:"status" json:"status"`
+	// Progress is the completion percentage, it is 0 if the server doesn't report it
+	Progress float64 `mapstructure:"progress" json:"progress"`
+	// FileID is the id of the file created by the job (for uploads and copies)
+	FileID string `mapstructure:"file_id" json:"file_id,omitempty"`
+	Error  string `mapstructure:"error" json:"error,omitempty"`
+}
+
+// IsFinished checks if the job is done or failed
+func (s *StatusResult) IsFinished() bool {
+	return s.Status == JobDone || s.Status == JobFailed
+}
+
+// ErrJobFailed is returned by PollStatus when the job is finished with the failed status
+var ErrJobFailed = errors.New("job failed")
+
+// ErrPollTimeout is returned by PollStatus when the job isn't finished before the timeout
+var ErrPollTimeout = errors.New("job is not finished before the timeout")
+
+// jobPollInterval and jobPollTimeout are used to wait for jobs started by other functions, like UploadFile
+var (
+	jobPollInterval = time.Second
+	jobPollTimeout  = 10 * time.Minute
+)
+
+// SetJobPolling sets how often and how long to wait for asynchronous jobs started by other functions,
+// like uploads and copies processed by the server in the background
+func SetJobPolling(interval time.Duration, timeout time.Duration) {
+	jobPollInterval = interval
+	jobPollTimeout = timeout
+}
+
+// GetJobStatus returns the current status of the asynchronous job
+func GetJobStatus(token string, jobId string) (*StatusResult, error) {
+	return getJobStatus(context.Background(), token, jobId)
+}
+
+// getJobStatus is GetJobStatus which stops when the context is done
+func getJobStatus(ctx context.Context, token string, jobId string) (*StatusResult, error) {
+	response, err := callMethodContext(ctx, token, "jobs.get", map[string]interface{}{"job": jobId})
+	if err != nil {
+		return nil, err
+	}
+
+	return MapToStruct[StatusResult](response.Result)
+}
+
+// PollStatus polls the status of the job on the interval until it is finished or the timeout is reached.
+// Status changes and progress are reported to the logger. The last known status is returned along with
+// ErrJobFailed for failed jobs and ErrPollTimeout for unfinished ones
+func PollStatus(token string, jobId string, interval time.Duration, timeout time.Duration) (StatusResult, error) {
+	return PollStatusContext(context.Background(), token, jobId, interval, timeout)
+}
+
+// PollStatusContext is PollStatus which stops when the context is done, the error of the context is returned then
+func PollStatusContext(ctx context.Context, token string, jobId string, interval time.Duration, timeout time.Duration) (StatusResult, error) {
+	deadline := time.Now().Add(timeout)
+	var last StatusResult
+
+	for {
+		status, err := getJobStatus(ctx, token, jobId)
+		if err != nil {
+			return last, fmt.Errorf("failed to get job %s status: %w", jobId, err)
+		}
+
+		if status.Status != last.Status || status.Progress != last.Progress {
+			if status.Progress > 0 {
+				currentLogger("Job %s is %s (%.0f%%)", jobId, status.Status, status.Progress)
+			} else {
+				currentLogger("Job %s is %s", jobId, status.Status)
+			}
+		}
+		last = *status
+
+		if status.Status == JobFailed {
+			if status.Error != "" {
+				return last, fmt.Errorf("%w: %s", ErrJobFailed, status.Error)
+			}
+			return last, ErrJobFailed
+		}
+		if status.IsFinished() {
+			return last, nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return last, ErrPollTimeout
+		}
+		select {
+		case <-ctx.Done():
+			return last, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// waitJobFile waits for the job creating a file and returns the file id
+func waitJobFile(ctx context.Context, token string, jobId string) (string, error) {
+	currentLogger("Server processes the file in the background, waiting for job %s", jobId)
+	status, err := PollStatusContext(ctx, token, jobId, jobPollInterval, jobPollTimeout)
+	if err != nil {
+		return "", err
+	}
+	if status.FileID == "" {
+		return "", fmt.Errorf("job %s is done, but file_id is empty", jobId)
+	}
+
+	return status.FileID, nil
+}
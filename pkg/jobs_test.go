@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPollStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		statuses   []string
+		timeout    time.Duration
+		wantStatus string
+		wantErr    error
+	}{
+		{name: "done at once", statuses: []string{`{"id":"job1","status":"done","file_id":"file1"}`}, timeout: time.Second, wantStatus: JobDone},
+		{name: "done after running", statuses: []string{`{"id":"job1","status":"pending"}`, `{"id":"job1","status":"running","progress":50}`, `{"id":"job1","status":"done","file_id":"file1"}`}, timeout: time.Second, wantStatus: JobDone},
+		{name: "failed with reason", statuses: []string{`{"id":"job1","status":"running"}`, `{"id":"job1","status":"failed","error":"broken file"}`}, timeout: time.Second, wantStatus: JobFailed, wantErr: ErrJobFailed},
+		{name: "failed without reason", statuses: []string{`{"id":"job1","status":"failed"}`}, timeout: time.Second, wantStatus: JobFailed, wantErr: ErrJobFailed},
+		{name: "timeout", statuses: []string{`{"id":"job1","status":"running"}`}, timeout: 5 * time.Millisecond, wantStatus: JobRunning, wantErr: ErrPollTimeout},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			requests := 0
+			newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				rpc := readRPCRequest(t, r)
+				if rpc.Method != "jobs.get" || rpc.Params["job"] != "job1" {
+					t.Errorf("request is %s %v", rpc.Method, rpc.Params)
+				}
+				// the last status is repeated until the job is finished
+				status := test.statuses[len(test.statuses)-1]
+				if requests < len(test.statuses) {
+					status = test.statuses[requests]
+				}
+				requests++
+				writeResult(w, status)
+			})
+
+			status, err := PollStatus("secret", "job1", time.Millisecond, test.timeout)
+			if test.wantErr == nil && err != nil {
+				t.Fatalf("PollStatus failed: %v", err)
+			}
+			if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+				t.Fatalf("error is %v, want %v", err, test.wantErr)
+			}
+			if status.Status != test.wantStatus {
+				t.Errorf("status is %q, want %q", status.Status, test.wantStatus)
+			}
+		})
+	}
+}
+
+func TestPollStatusCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		writeResult(w, `{"id":"job1","status":"running"}`)
+	})
+
+	_, err := PollStatusContext(ctx, "secret", "job1", time.Minute, time.Hour)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error is %v, want context.Canceled", err)
+	}
+}
+
+func TestPollStatusRequestError(t *testing.T) {
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = fmt.Fprint(w, "Bad Gateway")
+	})
+
+	_, err := PollStatus("secret", "job1", time.Millisecond, time.Second)
+	var serverError *ServerError
+	if !errors.As(err, &serverError) {
+		t.Fatalf("error is %v, want ServerError", err)
+	}
+}
@@ -0,0 +1,24 @@
+package pkg
+
+import "errors"
+
+// ErrOffline is returned by all the functions which need the network when the offline mode is enabled
+var ErrOffline = errors.New("offline mode: network access is disabled")
+
+// isOffline is the singleton which disables network access
+var isOffline = false
+
+// SetOfflineMode enables or disables the offline mode. In offline mode all the network functions
+// fail immediately with ErrOffline instead of trying to connect. Local operations keep working
+func SetOfflineMode(offline bool) {
+	isOffline = offline
+}
+
+// checkOnline returns ErrOffline if the offline mode is enabled
+func checkOnline() error {
+	if isOffline {
+		return ErrOffline
+	}
+
+	return nil
+}
@@ -4,12 +4,22 @@ package pkg
 // This library doesn't log anything by default. You can set your own logger using SetLogger function
 type Logger func(content string, params ...interface{})
 
+// Fields are structured details of a log message, like the file id or the number of bytes.
+// Secrets like the token or passwords are never put into fields
+type Fields map[string]interface{}
+
+// FieldsLogger is a function type used to log messages along with their structured fields
+type FieldsLogger func(fields Fields, content string, params ...interface{})
+
 // emptyLogger is a default logger that does nothing
 func emptyLogger(content string, params ...interface{}) {}
 
 // currentLogger is a singleton logger used by the library
 var currentLogger Logger
 
+// fieldsLogger is the logger of messages with fields. If it is nil, such messages go to currentLogger without fields
+var fieldsLogger FieldsLogger
+
 func init() {
 	currentLogger = emptyLogger
 }
@@ -20,3 +30,20 @@ func init() {
 func SetLogger(logger Logger) {
 	currentLogger = logger
 }
+
+// SetFieldsLogger sets the logger for messages with structured fields (like the file id and the number of bytes
+// of finished transfers), e.g. to send them to a log aggregator. Without it, such messages go to the logger
+// set by SetLogger, and the fields are dropped
+func SetFieldsLogger(logger FieldsLogger) {
+	fieldsLogger = logger
+}
+
+// logWithFields logs the message with its fields by the fields logger, falling back to the usual logger
+func logWithFields(fields Fields, content string, params ...interface{}) {
+	if fieldsLogger != nil {
+		fieldsLogger(fields, content, params...)
+		return
+	}
+
+	currentLogger(content, params...)
+}
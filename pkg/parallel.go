@@ -0,0 +1,156 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// MinParallelPartSize is the smallest part of a parallel download. Smaller files are downloaded in a single stream
+const MinParallelPartSize = 4 * 1024 * 1024
+
+// errRangesUnsupported is returned by the part download when the server ignores the Range header
+var errRangesUnsupported = errors.New("server doesn't support ranged downloads")
+
+// DownloadFileParallel downloads a file in several parts fetched concurrently, each part is written at its offset.
+// Encrypted files, files decompressed after download, small files and servers without ranged downloads
+// fall back to the single stream of DownloadFileWithOptions, written from the beginning of the writer.
+// The options are the same as for DownloadFileWithOptions, except Range, which is not supported in parallel,
+// and Resume, which is refused, because parts are written at their offsets from the beginning
+func DownloadFileParallel(ctx context.Context, token string, fileId string, writer io.WriterAt, parts int, opts *DownloadOptions) (fileName string, numBytes int64, err error) {
+	if opts == nil {
+		opts = &DownloadOptions{}
+	}
+	if opts.Resume > 0 {
+		return "", 0, errors.New("parallel download can't be resumed")
+	}
+
+	fileUrl, fileInfo, err := getDownloadURL(ctx, token, fileId)
+	if err != nil {
+		return "", 0, err
+	}
+
+	progress := startTransfer(downloadEvent(fileInfo, opts))
+	fileName, numBytes, err = downloadParallel(ctx, token, fileUrl, fileInfo, progress.writerAt(writer), parts, opts)
+	progress.complete(fileId, err)
+	return fileName, numBytes, err
+}
+
+// downloadParallel downloads the file from the download link like DownloadFileParallel
+func downloadParallel(ctx context.Context, token string, fileUrl string, fileInfo *File, writer io.WriterAt, parts int, opts *DownloadOptions) (fileName string, numBytes int64, err error) {
+	size := int64(fileInfo.Size)
+	if size/MinParallelPartSize < int64(parts) {
+		parts = int(size / MinParallelPartSize)
+	}
+
+	switch {
+	case parts < 2:
+		currentLogger("File is too small for parallel download")
+	case opts.Range != nil:
+		currentLogger("Ranged download is done in a single stream")
+	case fileInfo.Encrypted:
+		currentLogger("File is encrypted, parallel download is not available")
+	case decompressDownloads && IsCompressedName(fileInfo.Name):
+		currentLogger("File is compressed, parallel download is not available")
+	default:
+		numBytes, err = downloadParts(ctx, fileUrl, writer, size, parts)
+		if err == nil {
+			logWithFields(Fields{"file_id": fileInfo.ID, "name": fileInfo.Name, "bytes": numBytes, "parts": parts}, "Download is done (%d bytes)", numBytes)
+			return fileInfo.Name, numBytes, nil
+		}
+		if !errors.Is(err, errRangesUnsupported) {
+			return "", 0, err
+		}
+		currentLogger("Server doesn't support ranged downloads, downloading in a single stream")
+	}
+
+	return downloadContent(ctx, token, fileUrl, fileInfo, io.NewOffsetWriter(writer, 0), opts)
+}
+
+// downloadParts downloads the content of the given size from the link in parts concurrently.
+// The first failed part cancels the others and its error is returned
+func downloadParts(ctx context.Context, fileUrl string, writer io.WriterAt, size int64, parts int) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	currentLogger("Downloading %d bytes in %d parts", size, parts)
+
+	partSize := size / int64(parts)
+	errs := make([]error, parts)
+	var wg sync.WaitGroup
+	for i := 0; i < parts; i++ {
+		start := int64(i) * partSize
+		end := start + partSize - 1
+		if i == parts-1 {
+			end = size - 1
+		}
+
+		wg.Add(1)
+		go func(i int, start int64, end int64) {
+			defer wg.Done()
+			if errs[i] = downloadPart(ctx, fileUrl, writer, start, end); errs[i] != nil {
+				cancel()
+			}
+		}(i, start, end)
+	}
+	wg.Wait()
+
+	// The cause is preferred over the cancellations it caused in other parts
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return 0, err
+		}
+	}
+	for _, err := range errs {
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return size, nil
+}
+
+// downloadPart downloads the bytes from start to end (inclusive) and writes them at the start offset
+func downloadPart(ctx context.Context, fileUrl string, writer io.WriterAt, start int64, end int64) error {
+	request, err := http.NewRequestWithContext(ctx, "GET", fileUrl, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+
+	// Every part takes its own slot, so -concurrency limits the number of parts downloaded at once
+	release, err := AcquireConcurrency(ctx, 1)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	response, err := transferClient().Do(request)
+	if err != nil {
+		traceTransfer("download", fileUrl, 0, err)
+		return err
+	}
+	defer response.Body.Close()
+	traceTransfer("download", fileUrl, response.StatusCode, nil)
+
+	if response.StatusCode == http.StatusOK {
+		return errRangesUnsupported
+	}
+	if response.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("bad response status code: %s", response.Status)
+	}
+
+	length := end - start + 1
+	written, err := CopyBuffered(io.NewOffsetWriter(writer, start), io.LimitReader(response.Body, length))
+	if err != nil {
+		return err
+	}
+	if written != length {
+		return fmt.Errorf("part %d-%d is incomplete: %w", start, end, io.ErrUnexpectedEOF)
+	}
+
+	return nil
+}
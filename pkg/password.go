@@ -0,0 +1,127 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ProtonMail/gopenpgp/v2/crypto"
+	"github.com/ProtonMail/gopenpgp/v2/helper"
+)
+
+// ErrWrongPassword is returned when the password doesn't decrypt the crypto key
+var ErrWrongPassword = errors.New("wrong crypto password")
+
+// ChangeCryptoPassword re-encrypts the crypto key of the disk with the new password and stores it on the server.
+// The current password is checked first, and the re-encrypted key is checked to open with the new password
+// before it is sent, so the key on the server is replaced by a single call only with the working one.
+// Files are not re-encrypted, because they are encrypted with the key itself, not with the password
+func ChangeCryptoPassword(token string, disk string, oldPassword string, newPassword string) error {
+	if newPassword == "" {
+		return errors.New("new password is empty")
+	}
+
+	cryptoInfo, err := GetCryptoInfo(token, disk, oldPassword)
+	if err != nil {
+		if cryptoInfo != nil {
+			return fmt.Errorf("%w: %v", ErrWrongPassword, err)
+		}
+		return err
+	}
+	if cryptoInfo.RawCryptoKey == "" {
+		return errors.New("disk has no crypto key")
+	}
+
+	encryptedKey, err := reencryptCryptoKey(cryptoInfo.RawCryptoKey, oldPassword, newPassword)
+	if err != nil {
+		return err
+	}
+
+	// The key must open with the new password, otherwise the files would be lost after the change
+	rawKey, err := helper.DecryptMessageWithPassword([]byte(newPassword), encryptedKey)
+	if err != nil {
+		return fmt.Errorf("re-encrypted key check failed: %w", err)
+	}
+	if _, _, err = GetKeyRings(cryptoInfo.PublicKey, rawKey, []byte(newPassword)); err != nil {
+		return fmt.Errorf("re-encrypted key check failed: %w", err)
+	}
+
+	_, err = callMethod(token, "disks.setCryptoKey", map[string]interface{}{
+		"disk":       cryptoInfo.Disk,
+		"crypto_key": encryptedKey,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store the crypto key, the password is not changed: %w", err)
+	}
+
+	return nil
+}
+
+// reencryptCryptoKey relocks the armored private key with the new password, if it is locked,
+// and encrypts it with the new password the same way the server stores it
+func reencryptCryptoKey(rawKey string, oldPassword string, newPassword string) (string, error) {
+	key, err := crypto.NewKeyFromArmored(rawKey)
+	if err != nil {
+		return "", err
+	}
+
+	locked, err := key.IsLocked()
+	if err != nil {
+		return "", err
+	}
+	if locked {
+		unlocked, err := key.Unlock([]byte(oldPassword))
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrWrongPassword, err)
+		}
+		defer unlocked.ClearPrivateParams()
+
+		key, err = unlocked.Lock([]byte(newPassword))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	armored, err := key.Armor()
+	if err != nil {
+		return "", err
+	}
+
+	return helper.EncryptMessageWithPassword([]byte(newPassword), armored)
+}
+
+// GenerateCryptoKeys generates the key pair of a new encrypted disk. The private key is locked with the password
+// and encrypted with it the same way the server stores crypto keys, so the keys work with GetCryptoInfo
+// and ChangeCryptoPassword. The keys are checked to open with the password before they are returned
+func GenerateCryptoKeys(name string, password string) (publicKey string, encryptedKey string, err error) {
+	if password == "" {
+		return "", "", errors.New("crypto password is empty")
+	}
+
+	armored, err := helper.GenerateKey(name, "", []byte(password), "x25519", 0)
+	if err != nil {
+		return "", "", err
+	}
+
+	key, err := crypto.NewKeyFromArmored(armored)
+	if err != nil {
+		return "", "", err
+	}
+	publicKey, err = key.GetArmoredPublicKey()
+	if err != nil {
+		return "", "", err
+	}
+
+	encryptedKey, err = helper.EncryptMessageWithPassword([]byte(password), armored)
+	if err != nil {
+		return "", "", err
+	}
+
+	rawKey, err := helper.DecryptMessageWithPassword([]byte(password), encryptedKey)
+	if err != nil {
+		return "", "", fmt.Errorf("generated key check failed: %w", err)
+	}
+	if _, _, err = GetKeyRings(publicKey, rawKey, []byte(password)); err != nil {
+		return "", "", fmt.Errorf("generated key check failed: %w", err)
+	}
+
+	return publicKey, encryptedKey, nil
+}
@@ -0,0 +1,41 @@
+package pkg
+
+import (
+	"context"
+	"golang.org/x/time/rate"
+	"sync"
+)
+
+// apiLimiter spaces out API calls globally across goroutines. There is no limit if it is nil
+var apiLimiter *rate.Limiter
+
+// limiterMutex guards apiLimiter
+var limiterMutex sync.Mutex
+
+// SetApiRateLimit limits the number of API calls per second for the whole process, so batch operations
+// don't trip server-side abuse protection. Zero or negative rps disables the limit
+func SetApiRateLimit(rps float64) {
+	limiterMutex.Lock()
+	defer limiterMutex.Unlock()
+
+	if rps <= 0 {
+		apiLimiter = nil
+		return
+	}
+
+	// Burst of one call keeps calls evenly spaced instead of allowing bursts
+	apiLimiter = rate.NewLimiter(rate.Limit(rps), 1)
+}
+
+// waitApiRateLimit blocks until the next API call is allowed by the rate limit
+func waitApiRateLimit(ctx context.Context) error {
+	limiterMutex.Lock()
+	limiter := apiLimiter
+	limiterMutex.Unlock()
+
+	if limiter == nil {
+		return nil
+	}
+
+	return limiter.Wait(ctx)
+}
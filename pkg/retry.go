@@ -0,0 +1,167 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetryPolicy describes how API calls failed by transient errors are tried again: connection errors
+// and 5xx responses are retried with exponential backoff. 4xx responses and JSON-RPC errors are deterministic,
+// so they are never retried. Calls of methods which change something are retried only if the request
+// never reached the server, so nothing is done twice
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one. One or less disables retries
+	MaxAttempts int
+	// MaxElapsed limits the time since the first attempt, no retry is started after it. Zero means no limit
+	MaxElapsed time.Duration
+	// InitialDelay is the delay before the first retry, it is doubled for every next one
+	InitialDelay time.Duration
+	// MaxDelay limits the delay between attempts
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is conservative: a call is tried 3 times within 30 seconds
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:  3,
+	MaxElapsed:   30 * time.Second,
+	InitialDelay: 500 * time.Millisecond,
+	MaxDelay:     5 * time.Second,
+}
+
+// currentRetryPolicy is the singleton with the policy used by API calls
+var currentRetryPolicy = DefaultRetryPolicy
+
+// retryMutex guards currentRetryPolicy
+var retryMutex sync.Mutex
+
+// SetRetryPolicy sets the policy of retrying API calls. Pass RetryPolicy{} to disable retries
+func SetRetryPolicy(policy RetryPolicy) {
+	retryMutex.Lock()
+	defer retryMutex.Unlock()
+	currentRetryPolicy = policy
+}
+
+// getRetryPolicy returns the current retry policy
+func getRetryPolicy() RetryPolicy {
+	retryMutex.Lock()
+	defer retryMutex.Unlock()
+	return currentRetryPolicy
+}
+
+// delay returns the delay before the given attempt (starting from 2). It grows exponentially up to MaxDelay,
+// and is randomized between its half and the full value, so many clients don't retry all at once
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	delay := p.InitialDelay
+	for i := 2; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// nextDelay returns the delay before the next attempt after the failed one,
+// or false if the policy allows no more attempts
+func (p RetryPolicy) nextDelay(attempt int, started time.Time) (time.Duration, bool) {
+	if attempt >= p.MaxAttempts {
+		return 0, false
+	}
+
+	delay := p.delay(attempt + 1)
+	if p.MaxElapsed > 0 && time.Since(started)+delay > p.MaxElapsed {
+		return 0, false
+	}
+
+	return delay, true
+}
+
+// idempotentMethods are the methods which don't change anything, besides the ones named "get..." and "find..."
+var idempotentMethods = map[string]bool{
+	"files.download": true,
+	"system.health":  true,
+	"system.info":    true,
+}
+
+// IsIdempotentMethod checks if the API method only reads data, so calling it again is safe.
+// Methods named "get..." and "find..." (like "files.getById" and "files.findByHash") are idempotent
+func IsIdempotentMethod(method string) bool {
+	if idempotentMethods[method] {
+		return true
+	}
+
+	name := method[strings.LastIndex(method, ".")+1:]
+	return strings.HasPrefix(name, "get") || strings.HasPrefix(name, "find")
+}
+
+// ServerError is returned when the API responds with a 5xx status without a JSON-RPC error.
+// It is transient, so such calls are retried
+type ServerError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("API responded with %s", e.Status)
+}
+
+// isRetryable checks if the failed call of the method can be tried again. Server errors mean that
+// the request was processed and failed, connection errors may happen after the request is sent,
+// so both are retried only for idempotent methods. A failed dial means the request was never sent
+func isRetryable(method string, err error) bool {
+	if errors.Is(err, ErrOffline) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var opError *net.OpError
+	if errors.As(err, &opError) && opError.Op == "dial" {
+		return true
+	}
+	if !IsIdempotentMethod(method) {
+		return false
+	}
+
+	var serverError *ServerError
+	if errors.As(err, &serverError) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netError net.Error
+	return errors.As(err, &netError)
+}
+
+// retryApiCall calls the API method by the function until it succeeds, fails by an error which is not retryable,
+// the retry policy allows no more attempts or the context is done. The last error is returned
+func retryApiCall(ctx context.Context, method string, call func() error) error {
+	policy := getRetryPolicy()
+	started := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || ctx.Err() != nil || !isRetryable(method, err) {
+			return err
+		}
+
+		delay, ok := policy.nextDelay(attempt, started)
+		if !ok {
+			return err
+		}
+		currentLogger("Request %s failed (%v), retrying in %s", method, err, delay.Round(time.Millisecond))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		notifyRetry(method, attempt+1, err)
+	}
+}
@@ -0,0 +1,34 @@
+package pkg
+
+// ServerInfo is the result of the system.info method: the server version and methods it supports
+type ServerInfo struct {
+	Version string   `mapstructure:"version" json:"version" yaml:"version"`
+	Methods []string `mapstructure:"methods" json:"methods" yaml:"methods"`
+}
+
+// GetServerInfo returns the server version and supported methods.
+// ErrMethodNotSupported is returned if the server is too old to report them
+func GetServerInfo(token string) (*ServerInfo, error) {
+	response, err := callMethod(token, "system.info", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return MapToStruct[ServerInfo](response.Result)
+}
+
+// Supports checks if the server supports the method. If the server didn't report its methods,
+// every method is considered as supported, and the server decides by itself
+func (s *ServerInfo) Supports(method string) bool {
+	if s == nil || len(s.Methods) == 0 {
+		return true
+	}
+
+	for _, supported := range s.Methods {
+		if supported == method {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,62 @@
+package pkg
+
+// Share is a public link to a file
+type Share struct {
+	// ID is the id of the link, it is used to revoke the link
+	ID string `mapstructure:"id" json:"id"`
+	// File and Name are the id and the name of the shared file
+	File string `mapstructure:"file" json:"file"`
+	Name string `mapstructure:"name" json:"name"`
+	// URL is the public link
+	URL string `mapstructure:"url" json:"url"`
+	// Expires is the date when the link stops working, empty if it never expires
+	Expires string `mapstructure:"expires" json:"expires,omitempty"`
+	// Accesses is the number of times the link was opened, nil if the server doesn't count them
+	Accesses *int `mapstructure:"accesses" json:"accesses,omitempty"`
+}
+
+// SharesGetResponse is the page of shares.get method
+type SharesGetResponse struct {
+	Count int      `mapstructure:"count" json:"count"`
+	List  []*Share `mapstructure:"list" json:"list"`
+}
+
+// ListShares returns all active public links to files of the disk, requesting pages until the end.
+// ErrMethodNotSupported is returned if the server can't list the links
+func ListShares(token string, disk string) ([]*Share, error) {
+	var shares []*Share
+	seen := make(map[string]bool)
+
+	for {
+		response, err := callMethod(token, "shares.get", map[string]interface{}{"disk": disk, "offset": len(shares)})
+		if err != nil {
+			return nil, err
+		}
+
+		page, err := MapToStruct[SharesGetResponse](response.Result)
+		if err != nil {
+			return nil, err
+		}
+
+		added := 0
+		for _, share := range page.List {
+			// The check protects from looping forever if the server ignores the offset
+			if seen[share.ID] {
+				continue
+			}
+			seen[share.ID] = true
+			shares = append(shares, share)
+			added++
+		}
+
+		if added == 0 || (page.Count > 0 && len(shares) >= page.Count) {
+			return shares, nil
+		}
+	}
+}
+
+// RevokeShare disables the public link, so the file is no longer available by it
+func RevokeShare(token string, shareId string) error {
+	_, err := callMethod(token, "shares.revoke", map[string]interface{}{"share": shareId})
+	return err
+}
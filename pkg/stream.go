@@ -0,0 +1,123 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBodySize is the part of the failed response body included into the error
+const maxErrorBodySize = 1024
+
+// ApiRequestStream sends a JSON-RPC request like ApiRequest, but returns the response body as-is instead of
+// decoding it, so huge results can be parsed by json.Decoder without holding them in memory.
+// Only the HTTP status is checked, the JSON-RPC error is in the body (DecodeResult checks it).
+// The caller must close the body. Response bodies are not written to the trace.
+// Transient failures before the body is returned are retried according to the retry policy
+func ApiRequestStream(token string, method string, params map[string]interface{}) (io.ReadCloser, error) {
+	return ApiRequestStreamContext(context.Background(), token, method, params)
+}
+
+// ApiRequestStreamContext is ApiRequestStream which stops when the context is done, including waits between retries
+// and reading of the returned body
+func ApiRequestStreamContext(ctx context.Context, token string, method string, params map[string]interface{}) (io.ReadCloser, error) {
+	var body io.ReadCloser
+	err := retryApiCall(ctx, method, func() (err error) {
+		body, err = apiRequestStreamOnce(ctx, token, method, params)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// apiRequestStreamOnce sends the request once like ApiRequestStream.
+// A 5xx response without a JSON-RPC error is reported as ServerError
+func apiRequestStreamOnce(ctx context.Context, token string, method string, params map[string]interface{}) (io.ReadCloser, error) {
+	release, err := AcquireConcurrency(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	response, methodParams, err := sendApiRequest(ctx, token, method, params)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	if isTracing() {
+		traceApiRequest(method, methodParams, response.StatusCode, nil, nil)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		defer release()
+		defer response.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorBodySize))
+		var envelope ApiResponse
+		if response.StatusCode >= http.StatusInternalServerError && (json.Unmarshal(body, &envelope) != nil || envelope.Error.Code == 0) {
+			return nil, fmt.Errorf("%s: %w: %s", method, &ServerError{StatusCode: response.StatusCode, Status: response.Status}, strings.TrimSpace(string(body)))
+		}
+		return nil, fmt.Errorf("%s: bad response status %s: %s", method, response.Status, strings.TrimSpace(string(body)))
+	}
+
+	// The slot is held while the body is read, it is released when the caller closes it
+	return &releasingBody{ReadCloser: response.Body, release: release}, nil
+}
+
+// releasingBody releases the concurrency slot of the request when the response body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// DecodeResult decodes the result of the JSON-RPC response from the reader into the value pointed by result,
+// which must have JSON tags matching the API. The response is decoded on the fly, without reading it into memory first.
+// The error of the response is returned as ApiError
+func DecodeResult(reader io.Reader, result interface{}) error {
+	envelope := struct {
+		Error  *ApiError   `json:"error"`
+		Result interface{} `json:"result"`
+	}{Result: result}
+
+	if err := json.NewDecoder(reader).Decode(&envelope); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if envelope.Error != nil && envelope.Error.Code != 0 {
+		return envelope.Error
+	}
+
+	return nil
+}
+
+// callMethodStream calls the API method and decodes its result into the value pointed by result like DecodeResult.
+// ErrMethodNotSupported is returned if the server doesn't know the method, like callMethod does
+func callMethodStream(ctx context.Context, token string, method string, params map[string]interface{}, result interface{}) error {
+	body, err := ApiRequestStreamContext(ctx, token, method, params)
+	if err != nil {
+		notifyError(method, err)
+		return err
+	}
+	defer body.Close()
+
+	err = DecodeResult(body, result)
+	if err != nil {
+		var apiErr *ApiError
+		if errors.As(err, &apiErr) && isMethodNotFoundError(apiErr.Code, apiErr.Message) {
+			err = fmt.Errorf("%s: %w", method, ErrMethodNotSupported)
+		}
+		notifyError(method, err)
+		return err
+	}
+
+	return nil
+}
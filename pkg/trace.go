@@ -0,0 +1,186 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// traceWriter receives the raw API exchange for debugging purposes. Tracing is disabled if it is nil
+var traceWriter io.Writer
+
+// traceMutex keeps trace lines from different goroutines apart
+var traceMutex sync.Mutex
+
+// redactedValue replaces secrets in the trace
+const redactedValue = "<redacted>"
+
+// secretParams are the request parameters and response fields that are never written to the trace.
+// Private keys are secret even though they are encrypted with the password, because they can be brute-forced offline
+var secretParams = []string{"token", "password", "passwd", "crypto_key", "private_key"}
+
+// TraceEntry is a single line of the trace. Each entry is written as a separate JSON object
+type TraceEntry struct {
+	Time     time.Time              `json:"time"`
+	Kind     string                 `json:"kind"`
+	Method   string                 `json:"method,omitempty"`
+	Params   map[string]interface{} `json:"params,omitempty"`
+	URL      string                 `json:"url,omitempty"`
+	Status   int                    `json:"status,omitempty"`
+	Response json.RawMessage        `json:"response,omitempty"`
+	Error    string                 `json:"error,omitempty"`
+}
+
+// SetTraceWriter enables tracing of API requests and downloads to the writer, one JSON object per line.
+// Tokens, passwords and private keys are redacted in params and responses, download URLs are written without query,
+// so the trace is safe to share. Pass nil to disable tracing
+func SetTraceWriter(writer io.Writer) {
+	traceMutex.Lock()
+	defer traceMutex.Unlock()
+	traceWriter = writer
+}
+
+// isTracing checks if the trace is enabled, so callers can skip preparing trace data
+func isTracing() bool {
+	traceMutex.Lock()
+	defer traceMutex.Unlock()
+	return traceWriter != nil
+}
+
+// trace writes the entry to the trace writer if tracing is enabled
+func trace(entry *TraceEntry) {
+	traceMutex.Lock()
+	defer traceMutex.Unlock()
+
+	if traceWriter == nil {
+		return
+	}
+
+	entry.Time = time.Now()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	_, _ = traceWriter.Write(append(data, '\n'))
+}
+
+// traceApiRequest writes the API method call with its raw response
+func traceApiRequest(method string, params map[string]interface{}, status int, response []byte, err error) {
+	entry := &TraceEntry{Kind: "api", Method: method, Params: redactParams(params), Status: status}
+	if json.Valid(response) {
+		entry.Response = redactResponse(response)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	trace(entry)
+}
+
+// traceTransfer writes the URL and the status of a download or an upload, but not its body
+func traceTransfer(kind string, rawUrl string, status int, err error) {
+	entry := &TraceEntry{Kind: kind, URL: redactUrl(rawUrl), Status: status}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	trace(entry)
+}
+
+// urlParams are the request parameters and response fields with URLs, which are written like redactUrl returns them,
+// because signed links (download links, sources of files.uploadUrl) carry credentials in the query
+var urlParams = []string{"url"}
+
+// redactParams returns a copy of params with secret values replaced, in nested objects too
+func redactParams(params map[string]interface{}) map[string]interface{} {
+	redacted := make(map[string]interface{}, len(params))
+	for key, value := range params {
+		if isSecretParam(key) {
+			redacted[key] = redactedValue
+			continue
+		}
+		if rawUrl, ok := value.(string); ok && isUrlParam(key) {
+			redacted[key] = redactUrl(rawUrl)
+			continue
+		}
+		redacted[key] = redactValue(value)
+	}
+
+	return redacted
+}
+
+// redactResponse returns the raw JSON response with secret fields replaced at any depth, like disk keys in disks.get.
+// Numbers are kept as they are. Nothing is returned if the response can't be decoded, so secrets never leak
+func redactResponse(response []byte) json.RawMessage {
+	decoder := json.NewDecoder(bytes.NewReader(response))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil
+	}
+
+	data, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return nil
+	}
+
+	return data
+}
+
+// redactValue returns a copy of the decoded JSON value with secret fields of all objects replaced
+func redactValue(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		return redactParams(typed)
+	case []interface{}:
+		redacted := make([]interface{}, len(typed))
+		for i, item := range typed {
+			redacted[i] = redactValue(item)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// isSecretParam checks if the parameter or the field holds a secret
+func isSecretParam(key string) bool {
+	return containsFold(secretParams, key)
+}
+
+// isUrlParam checks if the parameter or the field holds a URL
+func isUrlParam(key string) bool {
+	return containsFold(urlParams, key)
+}
+
+// containsFold checks if the list has the key, ignoring the case
+func containsFold(list []string, key string) bool {
+	for _, item := range list {
+		if strings.EqualFold(key, item) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactUrl removes query and credentials from the URL, because signed links contain secrets there
+func redactUrl(rawUrl string) string {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return redactedValue
+	}
+
+	parsed.User = nil
+	if parsed.RawQuery != "" {
+		parsed.RawQuery = redactedValue
+	}
+
+	return parsed.String()
+}
@@ -0,0 +1,49 @@
+package pkg
+
+// Trash is an optional feature of the server. All the functions here return ErrMethodNotSupported
+// if the server has no trash
+
+// ListTrash returns all the files deleted to the trash of the disk, requesting pages until the end
+func ListTrash(token string, disk string) ([]*File, error) {
+	var files []*File
+	seen := make(map[string]bool)
+
+	for {
+		response, err := callMethod(token, "trash.get", map[string]interface{}{"disk": disk, "offset": len(files)})
+		if err != nil {
+			return nil, err
+		}
+
+		page, err := MapToStruct[FilesGetResponse](response.Result)
+		if err != nil {
+			return nil, err
+		}
+
+		added := 0
+		for _, file := range page.List {
+			// The check protects from looping forever if the server ignores the offset
+			if seen[file.ID] {
+				continue
+			}
+			seen[file.ID] = true
+			files = append(files, file)
+			added++
+		}
+
+		if added == 0 || (page.Count > 0 && len(files) >= page.Count) {
+			return files, nil
+		}
+	}
+}
+
+// RestoreFile restores a file from the trash to its original folder
+func RestoreFile(token string, fileId string) error {
+	_, err := callMethod(token, "trash.restore", map[string]interface{}{"file": fileId})
+	return err
+}
+
+// EmptyTrash permanently deletes all the files in the trash of the disk
+func EmptyTrash(token string, disk string) error {
+	_, err := callMethod(token, "trash.empty", map[string]interface{}{"disk": disk})
+	return err
+}
@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestListTrash(t *testing.T) {
+	tests := []struct {
+		name         string
+		total        int
+		pageSize     int
+		reportCount  bool
+		ignoreOffset bool
+		wantFiles    int
+	}{
+		{name: "empty trash", total: 0, pageSize: 2, wantFiles: 0},
+		{name: "single page", total: 2, pageSize: 5, reportCount: true, wantFiles: 2},
+		{name: "several pages with count", total: 5, pageSize: 2, reportCount: true, wantFiles: 5},
+		{name: "several pages without count", total: 5, pageSize: 2, wantFiles: 5},
+		{name: "server ignores offset", total: 5, pageSize: 2, ignoreOffset: true, wantFiles: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				rpc := readRPCRequest(t, r)
+				if rpc.Method != "trash.get" || rpc.Params["disk"] != "disk1" {
+					t.Errorf("request is %s %v", rpc.Method, rpc.Params)
+				}
+				offset, _ := rpc.Params["offset"].(float64)
+				if test.ignoreOffset {
+					offset = 0
+				}
+
+				var items []string
+				for i := int(offset); i < test.total && i < int(offset)+test.pageSize; i++ {
+					items = append(items, fmt.Sprintf(`{"id":"file%d","name":"file%d.txt"}`, i, i))
+				}
+				count := 0
+				if test.reportCount {
+					count = test.total
+				}
+				writeResult(w, fmt.Sprintf(`{"count":%d,"list":[%s]}`, count, strings.Join(items, ",")))
+			})
+
+			files, err := ListTrash("secret", "disk1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != test.wantFiles {
+				t.Fatalf("ListTrash returned %d files, want %d", len(files), test.wantFiles)
+			}
+			for i, file := range files {
+				if want := fmt.Sprintf("file%d", i); file.ID != want {
+					t.Errorf("file %d is %q, want %q", i, file.ID, want)
+				}
+			}
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package pkg
 
 import (
-	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/ProtonMail/gopenpgp/v2/crypto"
@@ -13,13 +15,95 @@ import (
 	"time"
 )
 
+// quotaExceededCode is the API error code returned when there is not enough space on the disk
+const quotaExceededCode = 507
+
+// ErrQuotaExceeded is returned by UploadFile when there is not enough space on the disk for the file
+var ErrQuotaExceeded = errors.New("disk quota exceeded")
+
+// isQuotaExceeded checks if the API error means that there is not enough space on the disk.
+// Older servers don't use the dedicated code, so the message is checked too
+func isQuotaExceeded(code int, message string) bool {
+	message = strings.ToLower(message)
+	return code == quotaExceededCode || strings.Contains(message, "quota") ||
+		strings.Contains(message, "not enough space") || strings.Contains(message, "insufficient space")
+}
+
+// UploadOptions are settings of UploadFileWithOptions
+type UploadOptions struct {
+	// Disk and Folder are where the file is uploaded. Empty disk is the default disk, empty folder is the disk root
+	Disk   string
+	Folder string
+	// Mime overrides the MIME type detected by the file name extension
+	Mime string
+	// CryptoInfo is used to encrypt the file. If it is nil, the file is uploaded without encryption
+	CryptoInfo *CryptoInfo
+	// Compress enables gzip compression before encryption. The name gets CompressedSuffix,
+	// so the file is decompressed on download
+	Compress bool
+	// IdempotencyKey identifies the upload, so the server can return the already created file instead of creating
+	// a duplicate when the same upload is retried (see IdempotencyKey function). Empty key is not sent
+	IdempotencyKey string
+}
+
+// IdempotencyKey builds the idempotency key of the upload from the SHA-256 hash of the content (hex),
+// the stored name, the disk and the folder. The same content uploaded to the same place gets the same key
+func IdempotencyKey(contentHash string, name string, disk string, folder string) string {
+	hash := sha256.Sum256([]byte(strings.Join([]string{contentHash, name, disk, folder}, "\x00")))
+	return hex.EncodeToString(hash[:])
+}
+
 // UploadFile uploads a file to the cloud.
 // If encryption is enabled, it will encrypt the file before uploading.
-// The file will be encrypted using the public key provided in the CryptoInfo struct.
-// You need public key to encrypt the file.
-// If you don't have the public key, you can get it from the server using the GetCryptoInfo function.
+//
+// Deprecated: use UploadFileWithOptions, which supports the context and more options
 func UploadFile(token string, name string, rewriteMime string, disk string, folder string, cryptoInfo *CryptoInfo, reader io.Reader) (fileId string, err error) {
-	currentLogger("Uploading file %s", name)
+	return UploadFileContext(context.Background(), token, name, rewriteMime, disk, folder, cryptoInfo, reader)
+}
+
+// UploadFileContext is UploadFile which stops when the context is done, e.g. cancelled on Ctrl-C
+func UploadFileContext(ctx context.Context, token string, name string, rewriteMime string, disk string, folder string, cryptoInfo *CryptoInfo, reader io.Reader) (fileId string, err error) {
+	opts := &UploadOptions{Disk: disk, Folder: folder, Mime: rewriteMime, CryptoInfo: cryptoInfo}
+	return UploadFileWithOptions(ctx, token, name, reader, opts)
+}
+
+// UploadFileWithOptions uploads the content of the reader as a file with the name and returns the id of the new file.
+// If the crypto info is set in options, the file is encrypted with its public key before uploading.
+// If you don't have the public key, you can get it from the server using the GetCryptoInfo function.
+// The context cancels the upload
+func UploadFileWithOptions(ctx context.Context, token string, name string, reader io.Reader, opts *UploadOptions) (fileId string, err error) {
+	if err := checkOnline(); err != nil {
+		return "", err
+	}
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	disk, folder, cryptoInfo := opts.Disk, opts.Folder, opts.CryptoInfo
+
+	plan := PlanChunks(reader, DefaultChunkSize)
+	if plan.Size == 0 {
+		currentLogger("Uploading empty file %s", name)
+	} else if plan.Size > 0 {
+		currentLogger("Uploading file %s (%d bytes, %d chunks)", name, plan.Size, plan.Chunks)
+	} else {
+		currentLogger("Uploading file %s (size is unknown)", name)
+	}
+
+	progress := startTransfer(TransferEvent{Kind: "upload", Name: name, Total: plan.Size})
+	defer func() {
+		progress.complete(fileId, err)
+	}()
+	reader = progress.reader(reader)
+	// The content is read before the request is sent, so the context is checked while reading it
+	reader = &contextReader{ctx: ctx, reader: reader}
+
+	if opts.Compress {
+		currentLogger("Compressing")
+		compressed := CompressReader(reader)
+		defer compressed.Close()
+		reader = compressed
+		name = CompressedName(name)
+	}
 
 	var cryptoVal string
 	var publicRing *crypto.KeyRing
@@ -37,13 +121,13 @@ func UploadFile(token string, name string, rewriteMime string, disk string, fold
 		currentLogger("Encrypting")
 
 		// If the crypto info is not ready, we need to get it. Nil check is not necessary because we have already checked it
-		if !cryptoInfo.IsCryptoReady() {
+		if !cryptoInfo.IsCryptoReadyFor(disk) {
 			if err := cryptoInfo.TryGetReady(token, disk); err != nil {
 				return "", fmt.Errorf("failed to encrypt file: %w", err)
 			}
 		}
 
-		publicRing, _, err = GetKeyRings(cryptoInfo.PublicKey, cryptoInfo.RawCryptoKey, []byte(cryptoInfo.Password))
+		publicRing, _, err = GetKeyRings(cryptoInfo.PublicKey, cryptoInfo.RawCryptoKey, []byte(cryptoInfo.PasswordFor(cryptoInfo.Disk)))
 		if err != nil {
 			return "", err
 		}
@@ -52,50 +136,20 @@ func UploadFile(token string, name string, rewriteMime string, disk string, fold
 		}
 	}
 
-	client := &http.Client{}
-	body := &bytes.Buffer{}
-	writerMultipart := multipart.NewWriter(body)
+	client := transferClient()
+	// The body is streamed through the pipe while the request is sent, so the content is never kept in memory
+	bodyReader, bodyWriter := io.Pipe()
+	defer bodyReader.Close()
+	writerMultipart := multipart.NewWriter(bodyWriter)
 
-	_ = writerMultipart.WriteField("token", token)
-	_ = writerMultipart.WriteField("disk", strings.TrimSpace(disk))
-	_ = writerMultipart.WriteField("folder", strings.TrimSpace(folder))
-	_ = writerMultipart.WriteField("crypto", strings.TrimSpace(cryptoVal))
-	part, err := writerMultipart.CreateFormFile("file", name)
-	if err != nil {
-		return "", err
-	}
-
-	if encrypt {
-		messageMeta := crypto.NewPlainMessageMetadata(true, name, time.Now().Unix())
-
-		plainWriter, err := publicRing.EncryptStreamWithCompression(part, messageMeta, nil)
-		if err != nil {
-			return "", err
-		}
-
-		_, err = io.Copy(plainWriter, reader)
-		_ = plainWriter.Close()
-	} else {
-		_, err = io.Copy(part, reader)
-	}
-
-	if err != nil {
-		return "", err
-	}
-
-	err = writerMultipart.Close()
-	if err != nil {
-		return "", err
-	}
-
-	req, err := http.NewRequest("POST", uploadUrl, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", uploadUrl, bodyReader)
 	if err != nil {
 		return "", err
 	}
 
 	var mime string
-	if rewriteMime != "" {
-		mime = rewriteMime
+	if opts.Mime != "" {
+		mime = opts.Mime
 	} else {
 		mime = mime2.TypeByExtension(name)
 		if mime == "" {
@@ -103,13 +157,45 @@ func UploadFile(token string, name string, rewriteMime string, disk string, fold
 		}
 	}
 	req.Header.Set("Content-Type", mime)
+	if opts.IdempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", opts.IdempotencyKey)
+	}
+
+	release, err := AcquireConcurrency(ctx, 1)
+	if err != nil {
+		return "", err
+	}
+	// The slot is released before waiting for the job, which is a separate API call
+	defer release()
+
+	var numBytes int64
+	written := make(chan error, 1)
+	go func() {
+		var writeErr error
+		numBytes, writeErr = writeUploadBody(writerMultipart, token, disk, folder, cryptoVal, name, opts.IdempotencyKey, publicRing, reader)
+		// The error of writing breaks the request, so it is never sent incomplete
+		_ = bodyWriter.CloseWithError(writeErr)
+		written <- writeErr
+	}()
 
 	currentLogger("Uploading file to server")
 	responseInfo, err := client.Do(req)
+	// The server may respond before reading the whole body, so the writer is unblocked before waiting for it
+	_ = bodyReader.Close()
+	writeErr := <-written
 	if err != nil {
+		traceTransfer("upload", uploadUrl, 0, err)
+		if writeErr != nil && !errors.Is(writeErr, io.ErrClosedPipe) {
+			return "", writeErr
+		}
 		return "", err
 	}
+	// Empty content is uploaded as is, the server creates an empty file
+	if writeErr == nil && numBytes == 0 && plan.Size != 0 {
+		currentLogger("Content is empty, uploading empty file %s", name)
+	}
 	defer responseInfo.Body.Close()
+	traceTransfer("upload", uploadUrl, responseInfo.StatusCode, nil)
 
 	rawResponse, err := readerToMap(responseInfo.Body)
 	if err != nil {
@@ -122,7 +208,12 @@ func UploadFile(token string, name string, rewriteMime string, disk string, fold
 	}
 
 	if response.Error.Code != 0 {
-		return "", fmt.Errorf("%s: %s (code %d)", responseInfo.Status, response.Error.Message, response.Error.Code)
+		if isQuotaExceeded(response.Error.Code, response.Error.Message) {
+			return "", fmt.Errorf("%w: %w", ErrQuotaExceeded, ResponseError(response))
+		}
+		return "", fmt.Errorf("%s: %w (code %d)", responseInfo.Status, ResponseError(response), response.Error.Code)
+	} else if responseInfo.StatusCode == http.StatusInsufficientStorage {
+		return "", fmt.Errorf("%w: %s", ErrQuotaExceeded, responseInfo.Status)
 	} else if responseInfo.StatusCode != http.StatusOK {
 		return "", errors.New(responseInfo.Status)
 	}
@@ -131,16 +222,80 @@ func UploadFile(token string, name string, rewriteMime string, disk string, fold
 	if err != nil {
 		return "", err
 	}
+	release()
 
 	if result.Ok {
 		fileId = result.FileID
+		if fileId == "" && result.JobID != "" {
+			fileId, err = waitJobFile(ctx, token, result.JobID)
+			if err != nil {
+				return "", err
+			}
+		}
 		if fileId == "" {
 			return "", errors.New("response file_id is empty")
 		}
 
-		currentLogger("File uploaded successfully. File ID: %s", fileId)
+		logWithFields(Fields{"file_id": fileId, "name": name, "bytes": numBytes}, "File uploaded successfully. File ID: %s", fileId)
 		return fileId, nil
 	}
 
 	return "", errors.New("upload failed (unknown reason)")
 }
+
+// writeUploadBody writes the multipart body of the upload: the form fields and the content of the reader,
+// encrypted with the public key ring if it is set. It returns the number of bytes read from the reader
+func writeUploadBody(writer *multipart.Writer, token string, disk string, folder string, cryptoVal string, name string, idempotencyKey string, publicRing *crypto.KeyRing, reader io.Reader) (int64, error) {
+	if token != "" {
+		_ = writer.WriteField("token", token)
+	}
+	_ = writer.WriteField("disk", strings.TrimSpace(disk))
+	_ = writer.WriteField("folder", strings.TrimSpace(folder))
+	_ = writer.WriteField("crypto", strings.TrimSpace(cryptoVal))
+	if idempotencyKey != "" {
+		_ = writer.WriteField("idempotency_key", idempotencyKey)
+	}
+	part, err := writer.CreateFormFile("file", name)
+	if err != nil {
+		return 0, err
+	}
+
+	var numBytes int64
+	if publicRing != nil {
+		messageMeta := crypto.NewPlainMessageMetadata(true, name, time.Now().Unix())
+
+		plainWriter, err := publicRing.EncryptStreamWithCompression(part, messageMeta, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		numBytes, err = CopyBuffered(plainWriter, reader)
+		if closeErr := plainWriter.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return numBytes, err
+		}
+	} else {
+		numBytes, err = CopyBuffered(part, reader)
+		if err != nil {
+			return numBytes, err
+		}
+	}
+
+	return numBytes, writer.Close()
+}
+
+// contextReader stops reading with the error of the context when the context is done
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.reader.Read(p)
+}
@@ -0,0 +1,203 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUploadFile(t *testing.T) {
+	var fields map[string]string
+	var content, fileName string
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/upload" {
+			t.Errorf("upload is sent to %s", r.URL.Path)
+		}
+
+		reader, err := r.MultipartReader()
+		if err != nil {
+			t.Errorf("upload is not multipart: %v", err)
+			return
+		}
+		fields = make(map[string]string)
+		for {
+			part, err := reader.NextPart()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				t.Errorf("failed to read part: %v", err)
+				return
+			}
+			value, _ := io.ReadAll(part)
+			if part.FormName() == "file" {
+				fileName, content = part.FileName(), string(value)
+				continue
+			}
+			fields[part.FormName()] = string(value)
+		}
+
+		writeResult(w, `{"ok":true,"file_id":"file1"}`)
+	})
+
+	opts := &UploadOptions{Disk: "disk1", Folder: "folder1", IdempotencyKey: "key1"}
+	fileId, err := UploadFileWithOptions(context.Background(), "secret", "notes.txt", strings.NewReader("hello"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fileId != "file1" {
+		t.Errorf("file id is %q, want file1", fileId)
+	}
+	if fileName != "notes.txt" || content != "hello" {
+		t.Errorf("uploaded %q with content %q", fileName, content)
+	}
+	want := map[string]string{"token": "secret", "disk": "disk1", "folder": "folder1", "crypto": "0", "idempotency_key": "key1"}
+	for name, value := range want {
+		if fields[name] != value {
+			t.Errorf("field %s is %q, want %q", name, fields[name], value)
+		}
+	}
+}
+
+func TestUploadFileQuotaExceeded(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{name: "quota code", status: http.StatusOK, body: `{"error":{"code":507,"message":"No space"}}`},
+		{name: "quota message", status: http.StatusOK, body: `{"error":{"code":1,"message":"Disk quota exceeded"}}`},
+		{name: "not enough space message", status: http.StatusOK, body: `{"error":{"code":1,"message":"Not enough space on the disk"}}`},
+		{name: "insufficient storage status", status: http.StatusInsufficientStorage, body: `{}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.Copy(io.Discard, r.Body)
+				w.WriteHeader(test.status)
+				_, _ = fmt.Fprint(w, test.body)
+			})
+
+			_, err := UploadFileWithOptions(context.Background(), "secret", "notes.txt", strings.NewReader("hello"), nil)
+			if !errors.Is(err, ErrQuotaExceeded) {
+				t.Fatalf("error is %v, want ErrQuotaExceeded", err)
+			}
+		})
+	}
+}
+
+func TestUploadFileErrors(t *testing.T) {
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		writeError(w, 403, "Access denied")
+	})
+
+	_, err := UploadFileWithOptions(context.Background(), "secret", "notes.txt", strings.NewReader("hello"), nil)
+	if err == nil || errors.Is(err, ErrQuotaExceeded) || !strings.Contains(err.Error(), "Access denied") {
+		t.Fatalf("error is %v, want the API error", err)
+	}
+}
+
+// failingReader returns the error after the first read, like a broken disk or an interrupted pipe
+type failingReader struct {
+	read bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.read {
+		return 0, errors.New("read failed")
+	}
+	r.read = true
+	return copy(p, "partial"), nil
+}
+
+func TestUploadFileReadError(t *testing.T) {
+	newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		writeResult(w, `{"ok":true,"file_id":"file1"}`)
+	})
+
+	_, err := UploadFileWithOptions(context.Background(), "secret", "notes.txt", &failingReader{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "read failed") {
+		t.Fatalf("error is %v, want the read error", err)
+	}
+}
+
+// readUploadedFile reads the name and the content of the file part of the upload request
+func readUploadedFile(t testing.TB, request *http.Request) (name string, content string, found bool) {
+	t.Helper()
+
+	reader, err := request.MultipartReader()
+	if err != nil {
+		t.Errorf("upload is not multipart: %v", err)
+		return "", "", false
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return name, content, found
+		}
+		if err != nil {
+			t.Errorf("failed to read part: %v", err)
+			return name, content, found
+		}
+		value, _ := io.ReadAll(part)
+		if part.FormName() == "file" {
+			name, content, found = part.FileName(), string(value), true
+		}
+	}
+}
+
+// unsizedReader hides the size of the reader, like a pipe
+type unsizedReader struct {
+	reader io.Reader
+}
+
+func (r unsizedReader) Read(p []byte) (int, error) {
+	return r.reader.Read(p)
+}
+
+func TestUploadFileEmpty(t *testing.T) {
+	tests := []struct {
+		name   string
+		reader io.Reader
+	}{
+		{name: "empty string", reader: strings.NewReader("")},
+		{name: "empty bytes", reader: bytes.NewReader(nil)},
+		{name: "empty stream of unknown size", reader: unsizedReader{reader: strings.NewReader("")}},
+		{name: "empty pipe", reader: func() io.Reader {
+			reader, writer := io.Pipe()
+			_ = writer.Close()
+			return reader
+		}()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var fileName, content string
+			var found bool
+			newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				fileName, content, found = readUploadedFile(t, r)
+				writeResult(w, `{"ok":true,"file_id":"file1"}`)
+			})
+
+			fileId, err := UploadFileWithOptions(context.Background(), "secret", "empty.txt", test.reader, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fileId != "file1" {
+				t.Errorf("file id is %q, want file1", fileId)
+			}
+			if !found || fileName != "empty.txt" || content != "" {
+				t.Errorf("uploaded %q (found %v) with content %q, want the empty file", fileName, found, content)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+)
+
+// UploadFromURL uploads the file from the URL and returns the id of the new file. If the file is not encrypted
+// or compressed, the server is asked to fetch the URL by itself. Otherwise, or if the server can't fetch URLs,
+// the content is downloaded by the client and streamed into UploadFileWithOptions without temporary files.
+// Redirects are followed. Empty name means the last segment of the URL path (of the final URL, after redirects)
+func UploadFromURL(ctx context.Context, token string, name string, sourceUrl string, opts *UploadOptions) (fileId string, err error) {
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+
+	parsed, err := url.Parse(sourceUrl)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "", fmt.Errorf("invalid URL %q: only http and https URLs are supported", sourceUrl)
+	}
+
+	// The server can't encrypt or compress the content, so it fetches only files stored as-is
+	if opts.CryptoInfo == nil && !opts.Compress {
+		serverName := name
+		if serverName == "" {
+			serverName = URLFileName(parsed)
+		}
+		if serverName == "" {
+			return "", urlFileNameError(sourceUrl)
+		}
+
+		fileId, err = uploadFromURLOnServer(ctx, token, serverName, sourceUrl, opts)
+		if err == nil {
+			return fileId, nil
+		}
+		if !errors.Is(err, ErrMethodNotSupported) {
+			return "", err
+		}
+		currentLogger("Server-side fetch is not supported, downloading the file through the client")
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "GET", sourceUrl, nil)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := transferClient().Do(request)
+	if err != nil {
+		traceTransfer("fetch", sourceUrl, 0, err)
+		return "", err
+	}
+	defer response.Body.Close()
+	traceTransfer("fetch", sourceUrl, response.StatusCode, nil)
+
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch %s: bad response status %s", redactUrl(sourceUrl), response.Status)
+	}
+
+	if name == "" {
+		name = URLFileName(response.Request.URL)
+	}
+	if name == "" {
+		return "", urlFileNameError(sourceUrl)
+	}
+
+	var content io.Reader = response.Body
+	if response.ContentLength >= 0 {
+		currentLogger("Fetching %s (%d bytes)", name, response.ContentLength)
+		content = &lengthReader{reader: response.Body, left: response.ContentLength}
+	}
+
+	return UploadFileWithOptions(ctx, token, name, content, opts)
+}
+
+// urlFileNameError is returned when the name is not set and the URL has no file name
+func urlFileNameError(sourceUrl string) error {
+	return fmt.Errorf("file name can't be detected from URL %s, set it explicitly", redactUrl(sourceUrl))
+}
+
+// uploadFromURLOnServer asks the server to fetch the URL into a new file.
+// The URL is sent as-is, because the server needs its query, and the trace writes it redacted (see redactParams)
+func uploadFromURLOnServer(ctx context.Context, token string, name string, sourceUrl string, opts *UploadOptions) (string, error) {
+	response, err := callMethodContext(ctx, token, "files.uploadUrl", map[string]interface{}{
+		"url":    sourceUrl,
+		"name":   name,
+		"disk":   opts.Disk,
+		"folder": opts.Folder,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	result, err := MapToStruct[UploadResult](response.Result)
+	if err != nil {
+		return "", err
+	}
+	if result.FileID == "" && result.JobID != "" {
+		result.FileID, err = waitJobFile(ctx, token, result.JobID)
+		if err != nil {
+			return "", err
+		}
+	}
+	if result.FileID == "" {
+		return "", errors.New("response file_id is empty")
+	}
+
+	currentLogger("File fetched by server. File ID: %s", result.FileID)
+	return result.FileID, nil
+}
+
+// URLFileName returns the last segment of the URL path, or empty string if the path has no file name
+func URLFileName(fileUrl *url.URL) string {
+	name := path.Base(fileUrl.Path)
+	if name == "." || name == "/" {
+		return ""
+	}
+
+	return name
+}
+
+// lengthReader is the reader with the known number of bytes left, so DetectSize knows the size of network streams
+type lengthReader struct {
+	reader io.Reader
+	left   int64
+}
+
+func (r *lengthReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.left -= int64(n)
+	return n, err
+}
+
+// Len returns the number of bytes left
+func (r *lengthReader) Len() int {
+	if r.left < 0 {
+		return 0
+	}
+
+	return int(r.left)
+}
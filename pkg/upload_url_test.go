@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUploadFromURLOnServer(t *testing.T) {
+	tests := []struct {
+		name      string
+		fileName  string
+		sourceUrl string
+		wantName  string
+		wantErr   bool
+	}{
+		{name: "name from URL", sourceUrl: "https://example.com/files/report.pdf?signature=secret", wantName: "report.pdf"},
+		{name: "explicit name", fileName: "my.pdf", sourceUrl: "https://example.com/?signature=secret", wantName: "my.pdf"},
+		{name: "URL without file name", sourceUrl: "https://example.com/?signature=secret", wantErr: true},
+		{name: "URL without path", sourceUrl: "https://example.com", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var received rpcRequest
+			requests := 0
+			newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				received = readRPCRequest(t, r)
+				writeResult(w, `{"ok":true,"file_id":"file1"}`)
+			})
+			var out bytes.Buffer
+			SetTraceWriter(&out)
+			defer SetTraceWriter(nil)
+
+			fileId, err := UploadFromURL(context.Background(), "secret", test.fileName, test.sourceUrl, nil)
+			if test.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "set it explicitly") {
+					t.Fatalf("UploadFromURL = %q, %v, want the file name error", fileId, err)
+				}
+				if requests != 0 {
+					t.Errorf("%d requests are sent, want none", requests)
+				}
+				if strings.Contains(err.Error(), "signature=secret") {
+					t.Errorf("error has the URL query: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if received.Method != "files.uploadUrl" || received.Params["name"] != test.wantName || received.Params["url"] != test.sourceUrl {
+				t.Errorf("request is %s %v, want name %q and the full URL", received.Method, received.Params, test.wantName)
+			}
+			if strings.Contains(out.String(), "signature=secret") {
+				t.Errorf("trace has the URL query: %s", out.String())
+			}
+		})
+	}
+}
@@ -38,8 +38,9 @@ func readerToMap(reader io.Reader) (map[string]interface{}, error) {
 	return data, nil
 }
 
-// MapToStruct converts a map to a struct. It is useful when we need to convert a json response to a struct
-func MapToStruct[Object any](m map[string]interface{}) (*Object, error) {
+// MapToStruct converts a decoded JSON value to a struct (or to a slice, for array results).
+// It is useful when we need to convert a json response to a struct
+func MapToStruct[Object any](m interface{}) (*Object, error) {
 	var result Object
 	err := mapstructure.Decode(m, &result)
 	if err != nil {